@@ -0,0 +1,348 @@
+// Command workshop runs the offline tools of the example package
+//
+//	workshop decode [-net regtest] [-json] [-prevout txid:vout:amount:pkscript]... <rawtx>
+//	workshop asm <asm>
+//	workshop disasm <script>
+//	workshop address [-net regtest] [-json] <address>
+//	workshop classify [-net regtest] [-json] <pkscript>
+//	workshop rbfcheck [-json] [-fullrbf] [-prevout txid:vout:amount:pkscript]... [-descendant rawtx]... <original> <replacement>
+//	workshop verifymessage [-net regtest] <address> <message> <signature>
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"github.com/islishude/bitcoin-workshop/example"
+)
+
+const usage = `usage: workshop <command> [flags] [args]
+
+commands:
+  decode    explain every field of a raw transaction in hex
+  asm       assemble the asm of a script to hex, # starts a comment
+  disasm    disassemble a script in hex like bitcoin-cli decodescript
+  address   validate an address and show its scriptPubKey
+  classify  show the type and the address of a scriptPubKey in hex
+  rbfcheck  check the bip125 rules of a replacement and its minimum fee
+  verifymessage
+            verify a bip322 or a legacy signmessage signature of an address
+
+- or no argument reads stdin
+`
+
+func main() {
+	if len(os.Args) < 2 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	var err error
+	switch os.Args[1] {
+	case "decode":
+		err = runDecode(os.Args[2:])
+	case "asm":
+		err = runAsm(os.Args[2:])
+	case "disasm":
+		err = runDisasm(os.Args[2:])
+	case "address":
+		err = runAddress(os.Args[2:])
+	case "classify":
+		err = runClassify(os.Args[2:])
+	case "rbfcheck":
+		err = runRBFCheck(os.Args[2:])
+	case "verifymessage":
+		err = runVerifyMessage(os.Args[2:])
+	case "-h", "-help", "--help", "help":
+		fmt.Print(usage)
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", os.Args[1], usage)
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+func runDecode(args []string) error {
+	fs := flag.NewFlagSet("decode", flag.ExitOnError)
+	netName := fs.String("net", "mainnet", "network: mainnet, testnet3, testnet4, signet or regtest")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	fetcher := prevoutFlag(fs)
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	netwk, err := networkParams(*netName)
+	if err != nil {
+		return err
+	}
+	rawTx, err := readArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+
+	decoded, err := example.DecodeTx(rawTx, netwk, fetcher)
+	if err != nil {
+		return err
+	}
+	if !*asJSON {
+		fmt.Print(decoded)
+		return nil
+	}
+	data, err := decoded.JSON()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+// runAsm takes the args as is, a number like -1 isn't a flag
+func runAsm(args []string) error {
+	asm, err := readArg(strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	script, err := example.AsmToScript(asm)
+	if err != nil {
+		return err
+	}
+	fmt.Println(hex.EncodeToString(script))
+	return nil
+}
+
+func runDisasm(args []string) error {
+	scriptHex, err := readArg(strings.Join(args, ""))
+	if err != nil {
+		return err
+	}
+	script, err := hex.DecodeString(strings.TrimSpace(scriptHex))
+	if err != nil {
+		return err
+	}
+	asm, err := example.ScriptToAsm(script)
+	fmt.Println(asm)
+	return err
+}
+
+// runAddress checks the address against the network only if -net is given
+func runAddress(args []string) error {
+	fs := flag.NewFlagSet("address", flag.ExitOnError)
+	netName := fs.String("net", "", "network the address must belong to: mainnet, testnet3, testnet4, signet or regtest")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	var netwk *chaincfg.Params
+	if *netName != "" {
+		var err error
+		if netwk, err = networkParams(*netName); err != nil {
+			return err
+		}
+	}
+	address, err := readArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	info, err := example.ParseAddress(address, netwk)
+	if err != nil {
+		return err
+	}
+	return printAddressInfo(info, *asJSON)
+}
+
+func runClassify(args []string) error {
+	fs := flag.NewFlagSet("classify", flag.ExitOnError)
+	netName := fs.String("net", "mainnet", "network of the address: mainnet, testnet3, testnet4, signet or regtest")
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	netwk, err := networkParams(*netName)
+	if err != nil {
+		return err
+	}
+	scriptHex, err := readArg(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	pkScript, err := hex.DecodeString(strings.TrimSpace(scriptHex))
+	if err != nil {
+		return err
+	}
+	return printAddressInfo(example.ClassifyScript(pkScript, netwk), *asJSON)
+}
+
+func printAddressInfo(info *example.AddressInfo, asJSON bool) error {
+	if !asJSON {
+		fmt.Print(info)
+		return nil
+	}
+	data, err := info.JSON()
+	if err != nil {
+		return err
+	}
+	fmt.Println(string(data))
+	return nil
+}
+
+func runVerifyMessage(args []string) error {
+	fs := flag.NewFlagSet("verifymessage", flag.ExitOnError)
+	netName := fs.String("net", "mainnet", "network of the address: mainnet, testnet3, testnet4, signet or regtest")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 3 {
+		return errors.New("verifymessage needs the address, the message and the signature")
+	}
+
+	netwk, err := networkParams(*netName)
+	if err != nil {
+		return err
+	}
+	format, err := example.VerifyMessage(fs.Arg(0), fs.Arg(1), fs.Arg(2), netwk)
+	if err != nil {
+		return err
+	}
+	fmt.Println("valid", format, "signature")
+	return nil
+}
+
+func runRBFCheck(args []string) error {
+	fs := flag.NewFlagSet("rbfcheck", flag.ExitOnError)
+	asJSON := fs.Bool("json", false, "print JSON instead of text")
+	opts := new(example.ReplacementOptions)
+	fs.BoolVar(&opts.FullRBF, "fullrbf", false, "replace the transactions not signaling bip125")
+	fetcher := prevoutFlag(fs)
+	fs.Func("descendant", "raw `tx` in the mempool spending the original, can be repeated", func(value string) error {
+		tx, err := parseRawTx(value)
+		if err != nil {
+			return err
+		}
+		opts.Descendants = append(opts.Descendants, tx)
+		return nil
+	})
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 2 {
+		return errors.New("rbfcheck needs the original and the replacement")
+	}
+
+	original, err := parseRawTx(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	replacement, err := parseRawTx(fs.Arg(1))
+	if err != nil {
+		return err
+	}
+	check, err := example.CheckReplacement(original, replacement, fetcher, opts)
+	if err != nil {
+		return err
+	}
+	if *asJSON {
+		data, err := check.JSON()
+		if err != nil {
+			return err
+		}
+		fmt.Println(string(data))
+	} else {
+		fmt.Print(check)
+	}
+	return check.Err()
+}
+
+// prevoutFlag adds the repeatable -prevout flag to the fetcher
+func prevoutFlag(fs *flag.FlagSet) *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	fs.Func("prevout", "spent output `txid:vout:amount:pkscript` to compute the fee, can be repeated",
+		func(value string) error {
+			outpoint, txout, err := parsePrevout(value)
+			if err != nil {
+				return err
+			}
+			fetcher.AddPrevOut(*outpoint, txout)
+			return nil
+		})
+	return fetcher
+}
+
+func parseRawTx(rawTx string) (*wire.MsgTx, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(rawTx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", example.ErrInvalidTx, err)
+	}
+	tx := new(wire.MsgTx)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("%w: %v", example.ErrInvalidTx, err)
+	}
+	return tx, nil
+}
+
+// parsePrevout parses `txid:vout:amount:pkscript`, the amount is in satoshis and the pkscript in hex
+func parsePrevout(value string) (*wire.OutPoint, *wire.TxOut, error) {
+	parts := strings.Split(value, ":")
+	if len(parts) != 4 {
+		return nil, nil, fmt.Errorf("prevout %q is not txid:vout:amount:pkscript", value)
+	}
+	outpoint, err := wire.NewOutPointFromString(parts[0] + ":" + parts[1])
+	if err != nil {
+		return nil, nil, fmt.Errorf("prevout %q: %v", value, err)
+	}
+	amount, err := strconv.ParseInt(parts[2], 10, 64)
+	if err != nil {
+		return nil, nil, fmt.Errorf("prevout %q: %v", value, err)
+	}
+	pkScript, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return nil, nil, fmt.Errorf("prevout %q: %v", value, err)
+	}
+	return outpoint, wire.NewTxOut(amount, pkScript), nil
+}
+
+func networkParams(name string) (*chaincfg.Params, error) {
+	switch name {
+	case "mainnet":
+		return &chaincfg.MainNetParams, nil
+	case "testnet3", "testnet":
+		return &chaincfg.TestNet3Params, nil
+	case "testnet4":
+		return &chaincfg.TestNet4Params, nil
+	case "signet":
+		return &chaincfg.SigNetParams, nil
+	case "regtest":
+		return &chaincfg.RegressionNetParams, nil
+	default:
+		return nil, fmt.Errorf("unknown network %q", name)
+	}
+}
+
+// readArg returns the argument, or the stdin if it's empty or -
+func readArg(arg string) (string, error) {
+	if arg != "" && arg != "-" {
+		return arg, nil
+	}
+	data, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return "", err
+	}
+	if len(strings.TrimSpace(string(data))) == 0 {
+		return "", errors.New("no input")
+	}
+	return string(data), nil
+}
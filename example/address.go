@@ -0,0 +1,248 @@
+package example
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil/base58"
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// AddressInfo describes an address or an output script
+type AddressInfo struct {
+	Address string `json:"address,omitempty"`
+	// Encoding is base58, bech32 or bech32m
+	Encoding string `json:"encoding,omitempty"`
+	// Networks are the networks sharing the prefix of the address, testnet3, testnet4, signet and regtest
+	// have the same base58 prefixes and the first three the same bech32 prefix
+	Networks       []string `json:"networks,omitempty"`
+	WitnessVersion *int     `json:"witness_version,omitempty"`
+	WitnessProgram string   `json:"witness_program,omitempty"`
+	// ScriptType is named like the output types of the decoder, p2pkh, p2sh, p2wpkh, p2wsh, p2tr...
+	ScriptType  string `json:"script_type"`
+	PkScript    string `json:"pk_script"`
+	PkScriptAsm string `json:"pk_script_asm"`
+}
+
+// addressNetworks are the networks recognized by ParseAddress
+var addressNetworks = []*chaincfg.Params{
+	&chaincfg.MainNetParams,
+	&chaincfg.TestNet3Params,
+	&chaincfg.TestNet4Params,
+	&chaincfg.SigNetParams,
+	&chaincfg.RegressionNetParams,
+}
+
+// ParseAddress decodes a base58 or a bech32/bech32m address, the netwk is optional, the address must belong
+// to it if given. The errors explain the common mistakes: a bech32 checksum for a taproot address or
+// bech32m for segwit v0, a mixed case bech32 address and an address of another network.
+func ParseAddress(address string, netwk *chaincfg.Params) (*AddressInfo, error) {
+	address = strings.TrimSpace(address)
+	if hrp, ok := bech32HRP(address); ok {
+		return parseSegwitAddress(address, hrp, netwk)
+	}
+	return parseBase58Address(address, netwk)
+}
+
+// bech32HRP returns the human readable part if it's one of the known networks
+func bech32HRP(address string) (string, bool) {
+	sep := strings.LastIndexByte(address, '1')
+	if sep < 1 {
+		return "", false
+	}
+	hrp := strings.ToLower(address[:sep])
+	for _, params := range addressNetworks {
+		if hrp == params.Bech32HRPSegwit {
+			return hrp, true
+		}
+	}
+	return "", false
+}
+
+func parseSegwitAddress(address, hrp string, netwk *chaincfg.Params) (*AddressInfo, error) {
+	_, data, checksum, err := bech32.DecodeGeneric(address)
+	if err != nil {
+		var mixedCase bech32.ErrMixedCase
+		if errors.As(err, &mixedCase) {
+			return nil, fmt.Errorf("%w: %s mixes upper and lower case, bech32 must be all in one case",
+				ErrInvalidAddress, address)
+		}
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if len(data) < 1 || data[0] > 16 {
+		return nil, fmt.Errorf("%w: no witness version", ErrInvalidAddress)
+	}
+
+	// bip350: the witness v0 uses the bech32 checksum, v1 and later use bech32m
+	version := int(data[0])
+	switch {
+	case version == 0 && checksum != bech32.Version0:
+		return nil, fmt.Errorf("%w: witness v0 address with a bech32m checksum, it must be bech32", ErrInvalidAddress)
+	case version > 0 && checksum != bech32.VersionM:
+		return nil, fmt.Errorf("%w: witness v%d address with a bech32 checksum, it must be bech32m (bip350)",
+			ErrInvalidAddress, version)
+	}
+
+	program, err := bech32.ConvertBits(data[1:], 5, 8, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if len(program) < 2 || len(program) > 40 {
+		return nil, fmt.Errorf("%w: witness program of %d bytes", ErrInvalidAddress, len(program))
+	}
+	if version == 0 && len(program) != 20 && len(program) != 32 {
+		return nil, fmt.Errorf("%w: witness v0 program of %d bytes, it must be 20 or 32", ErrInvalidAddress, len(program))
+	}
+
+	networks := addressNetworkNames(func(params *chaincfg.Params) bool { return params.Bech32HRPSegwit == hrp })
+	if err := checkAddressNetwork(netwk, networks); err != nil {
+		return nil, err
+	}
+
+	// OP_1 to OP_16 are not contiguous with OP_0
+	versionOp := byte(txscript.OP_0)
+	if version > 0 {
+		versionOp = txscript.OP_1 + byte(version) - 1
+	}
+	pkScript, err := txscript.NewScriptBuilder().AddOp(versionOp).AddData(program).Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+
+	info := newAddressInfo(pkScript)
+	info.Address = address
+	info.Encoding = "bech32"
+	if checksum == bech32.VersionM {
+		info.Encoding = "bech32m"
+	}
+	info.Networks = networks
+	return info, nil
+}
+
+func parseBase58Address(address string, netwk *chaincfg.Params) (*AddressInfo, error) {
+	hash, prefix, err := base58.CheckDecode(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrInvalidAddress, address, err)
+	}
+	if len(hash) != 20 {
+		return nil, fmt.Errorf("%w: hash of %d bytes, it must be 20", ErrInvalidAddress, len(hash))
+	}
+
+	var (
+		networks []string
+		builder  = txscript.NewScriptBuilder()
+	)
+	if networks = addressNetworkNames(func(params *chaincfg.Params) bool {
+		return params.PubKeyHashAddrID == prefix
+	}); len(networks) > 0 {
+		builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(hash).
+			AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG)
+	} else if networks = addressNetworkNames(func(params *chaincfg.Params) bool {
+		return params.ScriptHashAddrID == prefix
+	}); len(networks) > 0 {
+		builder.AddOp(txscript.OP_HASH160).AddData(hash).AddOp(txscript.OP_EQUAL)
+	} else {
+		return nil, fmt.Errorf("%w: unknown base58 prefix %#x", ErrInvalidAddress, prefix)
+	}
+	if err := checkAddressNetwork(netwk, networks); err != nil {
+		return nil, err
+	}
+
+	pkScript, err := builder.Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	info := newAddressInfo(pkScript)
+	info.Address = address
+	info.Encoding = "base58"
+	info.Networks = networks
+	return info, nil
+}
+
+func addressNetworkNames(match func(params *chaincfg.Params) bool) []string {
+	var names []string
+	for _, params := range addressNetworks {
+		if match(params) {
+			names = append(names, params.Name)
+		}
+	}
+	return names
+}
+
+// checkAddressNetwork rejects an address of another network, like a mainnet address on regtest
+func checkAddressNetwork(netwk *chaincfg.Params, networks []string) error {
+	if netwk == nil {
+		return nil
+	}
+	for _, name := range networks {
+		if name == netwk.Name {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: address of %s used on %s", ErrInvalidAddress, strings.Join(networks, "/"), netwk.Name)
+}
+
+// ClassifyScript describes the output script with its address on the network, the address is empty
+// if the script has none, like a bare multisig or an OP_RETURN output, or if the network is nil
+func ClassifyScript(pkScript []byte, netwk *chaincfg.Params) *AddressInfo {
+	info := newAddressInfo(pkScript)
+	if netwk == nil {
+		return info
+	}
+	// a bare multisig has no address of its own, a p2pk address is shown as its p2pkh
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(pkScript, netwk)
+	if err == nil && len(addrs) == 1 && class != txscript.MultiSigTy {
+		info.Address = addrs[0].EncodeAddress()
+		info.Networks = []string{netwk.Name}
+		switch {
+		case class == txscript.PubKeyHashTy || class == txscript.PubKeyTy || class == txscript.ScriptHashTy:
+			info.Encoding = "base58"
+		case info.WitnessVersion != nil && *info.WitnessVersion == 0:
+			info.Encoding = "bech32"
+		default:
+			info.Encoding = "bech32m"
+		}
+	}
+	return info
+}
+
+func newAddressInfo(pkScript []byte) *AddressInfo {
+	info := &AddressInfo{
+		ScriptType:  scriptTypeName(pkScript),
+		PkScript:    hex.EncodeToString(pkScript),
+		PkScriptAsm: disasm(pkScript),
+	}
+	if version, program, err := txscript.ExtractWitnessProgramInfo(pkScript); err == nil {
+		info.WitnessVersion = &version
+		info.WitnessProgram = hex.EncodeToString(program)
+	}
+	return info
+}
+
+// String renders the address info as text
+func (a *AddressInfo) String() string {
+	var buf strings.Builder
+	if a.Address != "" {
+		fmt.Fprintf(&buf, "address: %s\n", a.Address)
+		fmt.Fprintf(&buf, "encoding: %s\n", a.Encoding)
+		fmt.Fprintf(&buf, "networks: %s\n", strings.Join(a.Networks, ", "))
+	}
+	if a.WitnessVersion != nil {
+		fmt.Fprintf(&buf, "witness version: %d\n", *a.WitnessVersion)
+		fmt.Fprintf(&buf, "witness program: %s\n", a.WitnessProgram)
+	}
+	fmt.Fprintf(&buf, "script type: %s\n", a.ScriptType)
+	fmt.Fprintf(&buf, "pkScript: %s\n", a.PkScript)
+	fmt.Fprintf(&buf, "pkScript asm: %s\n", a.PkScriptAsm)
+	return buf.String()
+}
+
+// JSON renders the address info as indented JSON
+func (a *AddressInfo) JSON() ([]byte, error) {
+	return json.MarshalIndent(a, "", "  ")
+}
@@ -0,0 +1,146 @@
+package example
+
+import (
+	"encoding/hex"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/bech32"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestParseAddress(t *testing.T) {
+	tests := []struct {
+		address    string
+		netwk      *chaincfg.Params
+		encoding   string
+		scriptType string
+		pkScript   string
+		networks   []string
+	}{
+		// bip173 and bip350 vectors
+		{
+			address:    "BC1QW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4",
+			netwk:      &chaincfg.MainNetParams,
+			encoding:   "bech32",
+			scriptType: "p2wpkh",
+			pkScript:   "0014751e76e8199196d454941c45d1b3a323f1433bd6",
+			networks:   []string{"mainnet"},
+		},
+		{
+			address:    "tb1qrp33g0q5c5txsp9arysrx4k6zdkfs4nce4xj0gdcccefvpysxf3q0sl5k7",
+			encoding:   "bech32",
+			scriptType: "p2wsh",
+			pkScript:   "00201863143c14c5166804bd19203356da136c985678cd4d27a1b8c6329604903262",
+			networks:   []string{"testnet3", "testnet4", "signet"},
+		},
+		{
+			address:    "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0",
+			encoding:   "bech32m",
+			scriptType: "p2tr",
+			pkScript:   "512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798",
+			networks:   []string{"mainnet"},
+		},
+		{
+			address:    "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2",
+			netwk:      &chaincfg.MainNetParams,
+			encoding:   "base58",
+			scriptType: "p2pkh",
+			pkScript:   "76a91477bff20c60e522dfaa3350c39b030a5d004e839a88ac",
+			networks:   []string{"mainnet"},
+		},
+		{
+			address:    "3J98t1WpEZ73CNmQviecrnyiWrnqRhWNLy",
+			encoding:   "base58",
+			scriptType: "p2sh",
+			pkScript:   "a914b472a266d0bd89c13706a4132ccfb16f7c3b9fcb87",
+			networks:   []string{"mainnet"},
+		},
+	}
+	for _, test := range tests {
+		info, err := ParseAddress(test.address, test.netwk)
+		if err != nil {
+			t.Errorf("%s: %v", test.address, err)
+			continue
+		}
+		if info.Encoding != test.encoding || info.ScriptType != test.scriptType || info.PkScript != test.pkScript {
+			t.Errorf("%s: %s %s %s", test.address, info.Encoding, info.ScriptType, info.PkScript)
+		}
+		for _, name := range test.networks {
+			if !slices.Contains(info.Networks, name) {
+				t.Errorf("%s: networks %v, want %s", test.address, info.Networks, name)
+			}
+		}
+	}
+}
+
+func TestParseAddressInvalid(t *testing.T) {
+	// the same witness programs with the checksum of the other witness version
+	program, err := bech32.ConvertBits(make([]byte, 20), 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v0Bech32m, err := bech32.EncodeM("bc", append([]byte{0}, program...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	program, err = bech32.ConvertBits(make([]byte, 32), 8, 5, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1Bech32, err := bech32.Encode("bc", append([]byte{1}, program...))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		address string
+		netwk   *chaincfg.Params
+		reason  string
+	}{
+		{"v0 bech32m", v0Bech32m, nil, "witness v0 address with a bech32m checksum"},
+		{"v1 bech32", v1Bech32, nil, "witness v1 address with a bech32 checksum"},
+		{"v1 bech32 vector", "bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqh2y7hd", nil, "with a bech32 checksum"},
+		{"mixed case", "bc1qW508D6QEJXTDG4Y5R3ZARVARY0C5XW7KV8F3T4", nil, "mixes upper and lower case"},
+		{"mainnet on regtest", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4", testNet, "address of mainnet used on regtest"},
+		{"testnet on mainnet", "mipcBbFg9gMiCh81Kj8tqqdgoZub1ZJRfn", &chaincfg.MainNetParams, "used on mainnet"},
+		{"mainnet base58 on regtest", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN2", testNet, "address of mainnet used on regtest"},
+		{"bad checksum", "1BvBMSEYstWetqTFn5Au4m4GFg7xJaNVN3", nil, ""},
+	}
+	for _, test := range tests {
+		_, err := ParseAddress(test.address, test.netwk)
+		if !errors.Is(err, ErrInvalidAddress) || !strings.Contains(err.Error(), test.reason) {
+			t.Errorf("%s: got %v, want %q", test.name, err, test.reason)
+		}
+	}
+}
+
+func TestClassifyScript(t *testing.T) {
+	tests := []struct {
+		pkScript   string
+		scriptType string
+		address    string
+	}{
+		{"0014751e76e8199196d454941c45d1b3a323f1433bd6", "p2wpkh", "bc1qw508d6qejxtdg4y5r3zarvary0c5xw7kv8f3t4"},
+		{"512079be667ef9dcbbac55a06295ce870b07029bfcdb2dce28d959f2815b16f81798", "p2tr",
+			"bc1p0xlxvlhemja6c4dqv22uapctqupfhlxm9h8z3k2e72q4k9hcz7vqzk5jj0"},
+		{"6a0568656c6c6f", "nulldata", ""},
+	}
+	for _, test := range tests {
+		pkScript, _ := hex.DecodeString(test.pkScript)
+		info := ClassifyScript(pkScript, &chaincfg.MainNetParams)
+		if info.ScriptType != test.scriptType || info.Address != test.address {
+			t.Errorf("%s: %s %s", test.pkScript, info.ScriptType, info.Address)
+		}
+	}
+}
+
+func TestClassifyScriptWithoutNetwork(t *testing.T) {
+	info := ClassifyScript([]byte{0x51, 0x20}, nil)
+	if info.Address != "" || len(info.Networks) > 0 {
+		t.Errorf("%+v", info)
+	}
+}
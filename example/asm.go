@@ -0,0 +1,182 @@
+package example
+
+import (
+	"encoding/hex"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// asmOpNames are the names of Bitcoin Core from OP_NOP to OP_CHECKSIGADD, the opcodes are contiguous
+var asmOpNames = [...]string{
+	"OP_NOP", "OP_VER", "OP_IF", "OP_NOTIF", "OP_VERIF", "OP_VERNOTIF", "OP_ELSE", "OP_ENDIF",
+	"OP_VERIFY", "OP_RETURN", "OP_TOALTSTACK", "OP_FROMALTSTACK", "OP_2DROP", "OP_2DUP", "OP_3DUP", "OP_2OVER",
+	"OP_2ROT", "OP_2SWAP", "OP_IFDUP", "OP_DEPTH", "OP_DROP", "OP_DUP", "OP_NIP", "OP_OVER",
+	"OP_PICK", "OP_ROLL", "OP_ROT", "OP_SWAP", "OP_TUCK", "OP_CAT", "OP_SUBSTR", "OP_LEFT",
+	"OP_RIGHT", "OP_SIZE", "OP_INVERT", "OP_AND", "OP_OR", "OP_XOR", "OP_EQUAL", "OP_EQUALVERIFY",
+	"OP_RESERVED1", "OP_RESERVED2", "OP_1ADD", "OP_1SUB", "OP_2MUL", "OP_2DIV", "OP_NEGATE", "OP_ABS",
+	"OP_NOT", "OP_0NOTEQUAL", "OP_ADD", "OP_SUB", "OP_MUL", "OP_DIV", "OP_MOD", "OP_LSHIFT",
+	"OP_RSHIFT", "OP_BOOLAND", "OP_BOOLOR", "OP_NUMEQUAL", "OP_NUMEQUALVERIFY", "OP_NUMNOTEQUAL", "OP_LESSTHAN", "OP_GREATERTHAN",
+	"OP_LESSTHANOREQUAL", "OP_GREATERTHANOREQUAL", "OP_MIN", "OP_MAX", "OP_WITHIN", "OP_RIPEMD160", "OP_SHA1", "OP_SHA256",
+	"OP_HASH160", "OP_HASH256", "OP_CODESEPARATOR", "OP_CHECKSIG", "OP_CHECKSIGVERIFY", "OP_CHECKMULTISIG", "OP_CHECKMULTISIGVERIFY", "OP_NOP1",
+	"OP_CHECKLOCKTIMEVERIFY", "OP_CHECKSEQUENCEVERIFY", "OP_NOP4", "OP_NOP5", "OP_NOP6", "OP_NOP7", "OP_NOP8", "OP_NOP9",
+	"OP_NOP10", "OP_CHECKSIGADD",
+}
+
+// asmOpcodes maps the names with and without the OP_ prefix to the opcodes, with the common aliases
+var asmOpcodes = func() map[string]byte {
+	opcodes := map[string]byte{
+		"OP_RESERVED": txscript.OP_RESERVED, "OP_INVALIDOPCODE": txscript.OP_INVALIDOPCODE,
+		"OP_0": txscript.OP_0, "OP_FALSE": txscript.OP_FALSE, "OP_TRUE": txscript.OP_TRUE,
+		"OP_1NEGATE": txscript.OP_1NEGATE, "OP_NOP2": txscript.OP_NOP2, "OP_NOP3": txscript.OP_NOP3,
+	}
+	for i := 1; i <= 16; i++ {
+		opcodes[fmt.Sprintf("OP_%d", i)] = byte(txscript.OP_1 + i - 1)
+	}
+	for i, name := range asmOpNames {
+		opcodes[name] = byte(txscript.OP_NOP + i)
+	}
+	for name, op := range opcodes {
+		// the names without the prefix are not numbers, "1" is the number 1
+		if short := strings.TrimPrefix(name, "OP_"); short[0] < '0' || short[0] > '9' {
+			opcodes[short] = op
+		}
+	}
+	return opcodes
+}()
+
+// asmOpName is the name of the opcode in the asm of Bitcoin Core
+func asmOpName(op byte) string {
+	switch {
+	case op == txscript.OP_1NEGATE:
+		return "-1"
+	case op >= txscript.OP_1 && op <= txscript.OP_16:
+		return strconv.Itoa(int(op - txscript.OP_1 + 1))
+	case op == txscript.OP_RESERVED:
+		return "OP_RESERVED"
+	case op >= txscript.OP_NOP && op <= txscript.OP_CHECKSIGADD:
+		return asmOpNames[op-txscript.OP_NOP]
+	case op == txscript.OP_INVALIDOPCODE:
+		return "OP_INVALIDOPCODE"
+	default:
+		return "OP_UNKNOWN"
+	}
+}
+
+// ScriptToAsm disassembles the script like the asm of `bitcoin-cli decodescript`, a push of up to
+// 4 bytes is shown as a number and a longer one in hex, or in `<hex>` if the hex reads as a number
+// like `<1234567890>`. A malformed script ends with [error].
+func ScriptToAsm(script []byte) (string, error) {
+	var ops []string
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for tokenizer.Next() {
+		op := tokenizer.Opcode()
+		if op > txscript.OP_PUSHDATA4 {
+			ops = append(ops, asmOpName(op))
+			continue
+		}
+		if data := tokenizer.Data(); len(data) <= 4 {
+			ops = append(ops, strconv.FormatInt(asmNumber(data), 10))
+		} else if _, ok := asmNumberToken(hex.EncodeToString(data)); ok {
+			ops = append(ops, "<"+hex.EncodeToString(data)+">")
+		} else {
+			ops = append(ops, hex.EncodeToString(data))
+		}
+	}
+	if err := tokenizer.Err(); err != nil {
+		ops = append(ops, "[error]")
+		return strings.Join(ops, " "), fmt.Errorf("%w: %v", ErrInvalidScript, err)
+	}
+	return strings.Join(ops, " "), nil
+}
+
+// asmNumber decodes the little endian number with the sign bit without the minimal encoding check
+func asmNumber(data []byte) int64 {
+	var n int64
+	for i, b := range data {
+		n |= int64(b) << (8 * i)
+	}
+	if len(data) > 0 && data[len(data)-1]&0x80 != 0 {
+		return -(n &^ (0x80 << (8 * (len(data) - 1))))
+	}
+	return n
+}
+
+// AsmToScript assembles the asm of ScriptToAsm back to the script with the minimal pushes, the tokens are
+//   - a number up to 4 bytes like `10` or `-1`, pushed in the minimal encoding, OP_0 to OP_16 if possible,
+//     it has at most 10 digits without a leading zero so `0102030405` is data
+//   - an opcode name with or without the OP_ prefix like `OP_CHECKSIG` or `CHECKSIG`
+//   - any other hex like a pubkey or a hash, pushed as data
+//   - hex in angle brackets like `<1234567890>`, always pushed as data
+//   - `0x` followed by hex, inserted as raw bytes to write a non-minimal push
+//   - a quoted string without spaces like `'data'`, pushed as data
+//
+// The text after # to the end of the line is a comment, so a script can be written in a file line by line.
+func AsmToScript(asm string) ([]byte, error) {
+	builder := txscript.NewScriptBuilder()
+	for i, line := range strings.Split(asm, "\n") {
+		line, _, _ = strings.Cut(line, "#")
+		for _, token := range strings.Fields(line) {
+			if err := addAsmToken(builder, token); err != nil {
+				return nil, fmt.Errorf("%w: line %d: %v", ErrInvalidScript, i+1, err)
+			}
+		}
+	}
+	script, err := builder.Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidScript, err)
+	}
+	return script, nil
+}
+
+func addAsmToken(builder *txscript.ScriptBuilder, token string) error {
+	if n, ok := asmNumberToken(token); ok {
+		builder.AddInt64(n)
+		return nil
+	}
+	if op, ok := asmOpcodes[token]; ok {
+		builder.AddOp(op)
+		return nil
+	}
+
+	switch {
+	case strings.HasPrefix(token, "0x"):
+		raw, err := hex.DecodeString(token[2:])
+		if err != nil {
+			return fmt.Errorf("bad raw bytes %q", token)
+		}
+		builder.AddOps(raw)
+	case len(token) >= 2 && token[0] == '<' && token[len(token)-1] == '>':
+		data, err := hex.DecodeString(token[1 : len(token)-1])
+		if err != nil {
+			return fmt.Errorf("bad data %q", token)
+		}
+		builder.AddData(data)
+	case len(token) >= 2 && token[0] == '\'' && token[len(token)-1] == '\'':
+		builder.AddData([]byte(token[1 : len(token)-1]))
+	default:
+		data, err := hex.DecodeString(token)
+		if err != nil {
+			return fmt.Errorf("unknown token %q", token)
+		}
+		builder.AddData(data)
+	}
+	return nil
+}
+
+// asmNumberToken parses a decimal number of 4 bytes at most. Bitcoin Core shows the pushes longer than
+// 4 bytes in hex, so a hex of digits with a leading zero or more than 10 digits is data.
+func asmNumberToken(token string) (int64, bool) {
+	digits := strings.TrimPrefix(token, "-")
+	if digits == "" || len(digits) > 10 || (len(digits) > 1 && digits[0] == '0') {
+		return 0, false
+	}
+	n, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || n < -math.MaxInt32 || n > math.MaxInt32 {
+		return 0, false
+	}
+	return n, true
+}
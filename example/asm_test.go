@@ -0,0 +1,97 @@
+package example
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+)
+
+func TestScriptToAsm(t *testing.T) {
+	for _, v := range []struct{ script, asm string }{
+		{"76a91489abcdefabbaabbaabbaabbaabbaabbaabbaabba88ac", "OP_DUP OP_HASH160 89abcdefabbaabbaabbaabbaabbaabbaabbaabba OP_EQUALVERIFY OP_CHECKSIG"},
+		{"001489abcdefabbaabbaabbaabbaabbaabbaabbaabba", "0 89abcdefabbaabbaabbaabbaabbaabbaabbaabba"},
+		{"02b40d", "3508"},
+		{"0181", "-1"},
+		{"4f", "-1"},
+		{"60", "16"},
+		{"03ffff00", "65535"},
+		{"01ff", "-127"},
+		{"020000", "0"},
+		{"b1b2ba", "OP_CHECKLOCKTIMEVERIFY OP_CHECKSEQUENCEVERIFY OP_CHECKSIGADD"},
+		{"bbfe50ff", "OP_UNKNOWN OP_UNKNOWN OP_RESERVED OP_INVALIDOPCODE"},
+		{"6a0b68656c6c6f20776f726c64", "OP_RETURN 68656c6c6f20776f726c64"},
+		{"050102030405", "0102030405"},
+	} {
+		script, _ := hex.DecodeString(v.script)
+		asm, err := ScriptToAsm(script)
+		if err != nil || asm != v.asm {
+			t.Errorf("%s: got %q %v, want %q", v.script, asm, err, v.asm)
+		}
+	}
+
+	asm, err := ScriptToAsm([]byte{0x76, 0x05, 1, 2})
+	if !errors.Is(err, ErrInvalidScript) || asm != "OP_DUP [error]" {
+		t.Errorf("truncated push: %q %v", asm, err)
+	}
+}
+
+func TestAsmRoundTrip(t *testing.T) {
+	// the minimal scripts assemble back to the same bytes
+	for _, raw := range []string{
+		"76a91489abcdefabbaabbaabbaabbaabbaabbaabbaabba88ac",
+		"050102030405",
+		"051234567890",
+		"050000000000",
+		"0a01234567890123456789",
+		"06303132333435",
+		"04ffffff7f",
+		"04ffffffff",
+		"4f0051608f",
+		"6a0b68656c6c6f20776f726c64",
+	} {
+		script, _ := hex.DecodeString(raw)
+		asm, err := ScriptToAsm(script)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := AsmToScript(asm)
+		if err != nil {
+			t.Fatalf("%s: %q: %v", raw, asm, err)
+		}
+		if hex.EncodeToString(back) != raw {
+			t.Errorf("%s -> %q -> %x", raw, asm, back)
+		}
+	}
+
+	for _, asm := range []string{
+		"2 02c624f1ae84056c2777afc11c84227b959dbeef97b90ca26d48d436515a072152 02f250b65ce010db2687a9276b1bf45da6a16176403e132779cbb3403402f6f919 2 OP_CHECKMULTISIG",
+		"-1 0 1 16 17 -17 127 128 255 256 -32768 2147483647 -2147483647 OP_NOP10",
+		"0102030405 1234567890 00000000000000000000",
+		"<1234567890> 9999999999 123456789012 OP_DROP",
+	} {
+		script, err := AsmToScript(asm)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if back, err := ScriptToAsm(script); err != nil || back != asm {
+			t.Errorf("%q -> %x -> %q %v", asm, script, back, err)
+		}
+	}
+}
+
+func TestAsmToScript(t *testing.T) {
+	script, err := AsmToScript("DUP HASH160 OP_TRUE OP_FALSE 'data' 0x4c0105 # comment\n OP_NOP2 2147483648")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 2147483648 doesn't fit 4 bytes, it's the hex data of 5 bytes
+	if got := hex.EncodeToString(script); got != "76a9510004646174614c0105b1052147483648" {
+		t.Errorf("got %s", got)
+	}
+
+	for _, bad := range []string{"OP_FOO", "0xzz", "abc", "'x", "12345678901"} {
+		if _, err := AsmToScript(bad); !errors.Is(err, ErrInvalidScript) {
+			t.Errorf("%q: got %v, want ErrInvalidScript", bad, err)
+		}
+	}
+}
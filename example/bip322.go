@@ -0,0 +1,283 @@
+package example
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MessageFormat is the encoding of a message signature
+type MessageFormat uint8
+
+const (
+	// MessageSimple is the witness of the bip322 to_sign transaction, the address must be segwit
+	MessageSimple MessageFormat = iota + 1
+	// MessageFull is the whole bip322 to_sign transaction, it works for any script
+	MessageFull
+	// MessageLegacy is the bip137 compact signature of `bitcoin-cli signmessage`, the address must be p2pkh
+	MessageLegacy
+)
+
+func (f MessageFormat) String() string {
+	switch f {
+	case MessageSimple:
+		return "bip322-simple"
+	case MessageFull:
+		return "bip322-full"
+	case MessageLegacy:
+		return "bip137"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(f))
+	}
+}
+
+// compactSigSize is the size of a bip137 signature, the header byte, r and s
+const compactSigSize = 65
+
+// legacyMessageMagic prefixes the message of bip137 so a signature can't be a transaction signature
+const legacyMessageMagic = "Bitcoin Signed Message:\n"
+
+// Bip322MessageHash is the tagged hash of the message committed to by the to_spend transaction
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0322.mediawiki
+func Bip322MessageHash(message string) chainhash.Hash {
+	return *chainhash.TaggedHash([]byte("BIP0322-signed-message"), []byte(message))
+}
+
+// bip322ToSpend is the virtual transaction paying to the pkScript, its input can't be a real one
+// and commits to the message
+func bip322ToSpend(pkScript []byte, message string) (*wire.MsgTx, error) {
+	msgHash := Bip322MessageHash(message)
+	sigScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(msgHash[:]).Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{
+		PreviousOutPoint: wire.OutPoint{Index: math.MaxUint32},
+		SignatureScript:  sigScript,
+	})
+	tx.AddTxOut(wire.NewTxOut(0, pkScript))
+	return tx, nil
+}
+
+// bip322ToSign is the unsigned virtual transaction spending the output of to_spend to OP_RETURN
+func bip322ToSign(toSpend *wire.MsgTx) *wire.MsgTx {
+	tx := wire.NewMsgTx(0)
+	tx.AddTxIn(&wire.TxIn{PreviousOutPoint: wire.OutPoint{Hash: toSpend.TxHash()}})
+	tx.AddTxOut(wire.NewTxOut(0, []byte{txscript.OP_RETURN}))
+	return tx
+}
+
+// SignMessage proves the ownership of the address of the utxo by signing the to_sign transaction like
+// a spend of the utxo, so every spend type of the builders works. The outpoint and the amount of the utxo
+// are ignored, it can come from WalletAddress.UTXO or DescriptorOutput.UTXO with the keys.
+// The simple format needs a segwit address without a scriptSig, a utxo with a sequence like the
+// bip112 timelock needs the full format, and the legacy format signs with the key of a p2pkh utxo,
+// the uncompressed pubkey of the utxo is flagged in the header byte.
+func SignMessage(utxo *UTXO, message string, format MessageFormat) (string, error) {
+	if format == MessageLegacy {
+		if utxo.SpendType != SpendP2PKH || len(utxo.Keys) == 0 {
+			return "", fmt.Errorf("%w: the legacy format signs with the key of a p2pkh address, not %s",
+				ErrInvalidSignature, utxo.SpendType)
+		}
+		return SignMessageLegacy(utxo.Keys[0], message, !utxo.UncompressedPubKey), nil
+	}
+
+	toSpend, err := bip322ToSpend(utxo.PkScript, message)
+	if err != nil {
+		return "", err
+	}
+	toSign := bip322ToSign(toSpend)
+
+	spend := *utxo
+	spend.OutPoint = toSign.TxIn[0].PreviousOutPoint
+	spend.Amount = 0
+	if utxo.Sequence != 0 {
+		// OP_CHECKSEQUENCEVERIFY needs the version 2, only the full format can change the version
+		if format != MessageFull {
+			return "", fmt.Errorf("%w: the sequence of a timelock needs the full format", ErrInvalidSignature)
+		}
+		toSign.Version = 2
+		toSign.TxIn[0].Sequence = utxo.Sequence
+	}
+
+	fetcher := prevOutFetcher([]*UTXO{&spend})
+	if err := signInput(toSign, fetcher, txscript.NewTxSigHashes(toSign, fetcher), 0, &spend); err != nil {
+		return "", err
+	}
+	if err := VerifyTx(toSign, fetcher); err != nil {
+		return "", err
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case MessageSimple:
+		if len(toSign.TxIn[0].SignatureScript) > 0 {
+			return "", fmt.Errorf("%w: %s has a scriptSig, it needs the full format",
+				ErrInvalidSignature, utxo.SpendType)
+		}
+		err = writeWitness(&buf, toSign.TxIn[0].Witness)
+	case MessageFull:
+		err = toSign.Serialize(&buf)
+	default:
+		return "", fmt.Errorf("%w: unknown format %s", ErrInvalidSignature, format)
+	}
+	if err != nil {
+		return "", err
+	}
+	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+}
+
+// VerifyMessage verifies a signature of SignMessage or `bitcoin-cli signmessage` by the address and returns
+// its format: a 65 bytes signature of a p2pkh address is legacy, a whole transaction is full and a
+// witness is simple. The full format must spend only to_spend, the proof of funds isn't supported.
+func VerifyMessage(address, message, signature string, netwk *chaincfg.Params) (MessageFormat, error) {
+	info, err := ParseAddress(address, netwk)
+	if err != nil {
+		return 0, err
+	}
+	pkScript, err := hex.DecodeString(info.PkScript)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(signature))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+
+	if len(raw) == compactSigSize && info.ScriptType == "p2pkh" {
+		return MessageLegacy, verifyLegacyMessage(pkScript, message, raw)
+	}
+
+	toSpend, err := bip322ToSpend(pkScript, message)
+	if err != nil {
+		return 0, err
+	}
+	toSign := bip322ToSign(toSpend)
+	format := MessageSimple
+	if witness, err := readWitness(raw); err == nil {
+		toSign.TxIn[0].Witness = witness
+	} else {
+		format = MessageFull
+		if toSign, err = parseBip322ToSign(raw, toSign.TxIn[0].PreviousOutPoint); err != nil {
+			return format, err
+		}
+	}
+
+	fetcher := txscript.NewMultiPrevOutFetcher(map[wire.OutPoint]*wire.TxOut{
+		toSign.TxIn[0].PreviousOutPoint: toSpend.TxOut[0],
+	})
+	if err := VerifyTx(toSign, fetcher); err != nil {
+		return format, fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	return format, nil
+}
+
+// parseBip322ToSign decodes the to_sign transaction of the full format, the version, the lock time
+// and the sequence are up to the signer
+func parseBip322ToSign(raw []byte, toSpend wire.OutPoint) (*wire.MsgTx, error) {
+	tx := new(wire.MsgTx)
+	reader := bytes.NewReader(raw)
+	if err := tx.Deserialize(reader); err != nil || reader.Len() > 0 {
+		return nil, fmt.Errorf("%w: neither a witness nor a transaction", ErrInvalidSignature)
+	}
+	if len(tx.TxIn) != 1 || tx.TxIn[0].PreviousOutPoint != toSpend {
+		return nil, fmt.Errorf("%w: to_sign must spend only %s", ErrInvalidSignature, toSpend)
+	}
+	if len(tx.TxOut) != 1 || tx.TxOut[0].Value != 0 ||
+		!bytes.Equal(tx.TxOut[0].PkScript, []byte{txscript.OP_RETURN}) {
+		return nil, fmt.Errorf("%w: to_sign must have a single OP_RETURN output of 0", ErrInvalidSignature)
+	}
+	return tx, nil
+}
+
+// writeWitness encodes the witness stack like in a transaction, the item count then the items
+func writeWitness(w io.Writer, witness wire.TxWitness) error {
+	if err := wire.WriteVarInt(w, 0, uint64(len(witness))); err != nil {
+		return err
+	}
+	for _, item := range witness {
+		if err := wire.WriteVarBytes(w, 0, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readWitness decodes the witness stack of writeWitness, all the bytes must be used
+func readWitness(raw []byte) (wire.TxWitness, error) {
+	reader := bytes.NewReader(raw)
+	count, err := wire.ReadVarInt(reader, 0)
+	if err != nil {
+		return nil, err
+	}
+	// every item has at least its size byte
+	if count > uint64(len(raw)) {
+		return nil, fmt.Errorf("%w: %d witness items", ErrInvalidSignature, count)
+	}
+	witness := make(wire.TxWitness, 0, count)
+	for i := uint64(0); i < count; i++ {
+		item, err := wire.ReadVarBytes(reader, 0, uint32(len(raw)), "witness item")
+		if err != nil {
+			return nil, err
+		}
+		witness = append(witness, item)
+	}
+	if reader.Len() > 0 {
+		return nil, fmt.Errorf("%w: %d bytes after the witness", ErrInvalidSignature, reader.Len())
+	}
+	return witness, nil
+}
+
+// legacyMessageHash is the double sha256 of the magic and the message, both prefixed by their size
+func legacyMessageHash(message string) []byte {
+	var buf bytes.Buffer
+	_ = wire.WriteVarString(&buf, 0, legacyMessageMagic)
+	_ = wire.WriteVarString(&buf, 0, message)
+	return chainhash.DoubleHashB(buf.Bytes())
+}
+
+// SignMessageLegacy signs the message like `bitcoin-cli signmessage`, the p2pkh address of the
+// compressed or the uncompressed pubkey verifies it
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0137.mediawiki
+func SignMessageLegacy(prvkey *btcec.PrivateKey, message string, compressed bool) string {
+	sig := ecdsa.SignCompact(prvkey, legacyMessageHash(message), compressed)
+	return base64.StdEncoding.EncodeToString(sig)
+}
+
+// verifyLegacyMessage recovers the pubkey from the signature, the header byte tells
+// whether the p2pkh address has the compressed pubkey
+func verifyLegacyMessage(pkScript []byte, message string, sig []byte) error {
+	pubkey, compressed, err := ecdsa.RecoverCompact(sig, legacyMessageHash(message))
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidSignature, err)
+	}
+	rawPubkey := pubkey.SerializeUncompressed()
+	if compressed {
+		rawPubkey = pubkey.SerializeCompressed()
+	}
+	script, err := txscript.NewScriptBuilder().AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).
+		AddData(btcutil.Hash160(rawPubkey)).AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG).Script()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	if !bytes.Equal(script, pkScript) {
+		return fmt.Errorf("%w: signed by another key", ErrInvalidSignature)
+	}
+	return nil
+}
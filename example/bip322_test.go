@@ -0,0 +1,221 @@
+package example
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// bip322 test vectors
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0322.mediawiki#test-vectors
+const (
+	bip322WIF     = "L3VFeEujGtevx9w18HD1fhRbCH67Az2dpCymeRE1SoPK6XQtaN2k"
+	bip322Address = "bc1q9vza2e8x573nczrlzms0wvx3gsqjx7vavgkx0l"
+	bip322Taproot = "bc1ppv609nr0vr25u07u95waq5lucwfm6tde4nydujnu8npg4q75mr5sxq8lt3"
+)
+
+var bip322Vectors = []struct {
+	message   string
+	msgHash   string
+	toSpend   string
+	toSign    string
+	signature string
+}{
+	{
+		message:   "",
+		msgHash:   "c90c269c4f8fcbe6880f72a721ddfbf1914268a794cbb21cfafee13770ae19f1",
+		toSpend:   "c5680aa69bb8d860bf82d4e9cd3504b55dde018de765a91bb566283c545a99a7",
+		toSign:    "1e9654e951a5ba44c8604c4de6c67fd78a27e81dcadcfe1edf638ba3aaebaed6",
+		signature: "AkcwRAIgM2gBAQqvZX15ZiysmKmQpDrG83avLIT492QBzLnQIxYCIBaTpOaD20qRlEylyxFSeEA2ba9YOixpX8z46TSDtS40ASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+	},
+	{
+		message:   "Hello World",
+		msgHash:   "f0eb03b1a75ac6d9847f55c624a99169b5dccba2a31f5b23bea77ba270de0a7a",
+		toSpend:   "b79d196740ad5217771c1098fc4a4b51e0535c32236c71f1ea4d61a2d603352b",
+		toSign:    "88737ae86f2077145f93cc4b153ae9a1cb8d56afa511988c149c5c8c9d93bddf",
+		signature: "AkcwRAIgZRfIY3p7/DoVTty6YZbWS71bc5Vct9p9Fia83eRmw2QCICK/ENGfwLtptFluMGs2KsqoNSk89pO7F29zJLUx9a/sASECx/EgAxlkQpQ9hYjgGu6EBCPMVPwVIVJqO4XCsMvViHI=",
+	},
+}
+
+// bip322UTXO is the p2wpkh output of the vector address with its key
+func bip322UTXO(t *testing.T) *UTXO {
+	t.Helper()
+	wif, err := btcutil.DecodeWIF(bip322WIF)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if address.String() != bip322Address {
+		t.Fatalf("address %s, want %s", address, bip322Address)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &UTXO{PkScript: pkScript, SpendType: SpendP2WPKH, Keys: []*btcec.PrivateKey{wif.PrivKey}}
+}
+
+func TestBip322Vectors(t *testing.T) {
+	utxo := bip322UTXO(t)
+	for _, vector := range bip322Vectors {
+		if msgHash := Bip322MessageHash(vector.message); hex.EncodeToString(msgHash[:]) != vector.msgHash {
+			t.Errorf("%q: message hash %x", vector.message, msgHash)
+		}
+		toSpend, err := bip322ToSpend(utxo.PkScript, vector.message)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if txid := toSpend.TxHash().String(); txid != vector.toSpend {
+			t.Errorf("%q: to_spend %s, want %s", vector.message, txid, vector.toSpend)
+		}
+		if txid := bip322ToSign(toSpend).TxHash().String(); txid != vector.toSign {
+			t.Errorf("%q: to_sign %s, want %s", vector.message, txid, vector.toSign)
+		}
+
+		// bitcoin core grinds a low r, the signature differs from the vector but verifies too
+		signature, err := SignMessage(utxo, vector.message, MessageSimple)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := VerifyMessage(bip322Address, vector.message, signature, &chaincfg.MainNetParams); err != nil {
+			t.Errorf("%q: %v", vector.message, err)
+		}
+		format, err := VerifyMessage(bip322Address, vector.message, vector.signature, &chaincfg.MainNetParams)
+		if err != nil || format != MessageSimple {
+			t.Errorf("%q: %s %v", vector.message, format, err)
+		}
+		if _, err := VerifyMessage(bip322Address, vector.message+"!", vector.signature,
+			&chaincfg.MainNetParams); !errors.Is(err, ErrInvalidSignature) {
+			t.Errorf("%q: another message got %v", vector.message, err)
+		}
+	}
+}
+
+func TestBip322TaprootVector(t *testing.T) {
+	const signature = "AUHd69PrJQEv+oKTfZ8l+WROBHuy9HKrbFCJu7U1iK2iiEy1vMU5EfMtjc+VSHM7aU0SDbak5IUZRVno2P5mjSafAQ=="
+	format, err := VerifyMessage(bip322Taproot, "Hello World", signature, &chaincfg.MainNetParams)
+	if err != nil || format != MessageSimple {
+		t.Errorf("%s %v", format, err)
+	}
+}
+
+func TestBip322Full(t *testing.T) {
+	// the full format of the vector key verifies like the simple one
+	utxo := bip322UTXO(t)
+	signature, err := SignMessage(utxo, "Hello World", MessageFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := VerifyMessage(bip322Address, "Hello World", signature, &chaincfg.MainNetParams)
+	if err != nil || format != MessageFull {
+		t.Errorf("%s %v", format, err)
+	}
+
+	// a bip112 timelock needs the version and the sequence of the full format
+	alice := testKey(1)
+	builder, err := newBip112P2wshBuilder(testNet, alice.PubKey(), testKey(2).PubKey(), testPool(100000), 50000, 2,
+		10, true, []byte("timelock"), []byte("multisig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	timelock := builder.Pool[0]
+	timelock.Keys = []*btcec.PrivateKey{alice}
+	if _, err := SignMessage(timelock, "timelock", MessageSimple); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("simple format of a timelock got %v", err)
+	}
+	signature, err = SignMessage(timelock, "timelock", MessageFull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := btcutil.NewAddressWitnessScriptHash(timelock.PkScript[2:], testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if format, err := VerifyMessage(address.String(), "timelock", signature, testNet); err != nil || format != MessageFull {
+		t.Errorf("timelock: %s %v", format, err)
+	}
+}
+
+func TestBip137(t *testing.T) {
+	utxo := testUTXOs(t, 1000)[0]
+	address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(testKey(1).PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := SignMessage(utxo, "Hello World", MessageLegacy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	format, err := VerifyMessage(address.String(), "Hello World", signature, testNet)
+	if err != nil || format != MessageLegacy {
+		t.Errorf("%s %v", format, err)
+	}
+	// the p2pkh address can't sign the simple format, it has a scriptSig
+	if _, err := SignMessage(utxo, "Hello World", MessageSimple); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("simple format of p2pkh got %v", err)
+	}
+	if _, err := SignMessage(bip322UTXO(t), "Hello World", MessageLegacy); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("legacy format of p2wpkh got %v", err)
+	}
+}
+
+func TestBip137WIF(t *testing.T) {
+	for _, vector := range []struct {
+		wif        string
+		compressed bool
+	}{
+		{"5HueCGU8rMjxEXxiPuD5BDku4MkFqeZyd4dZ1jvhTVqvbTLvyTJ", false},
+		{"KwdMAjGmerYanjeui5SHS7JkmpZvVipYvB2LJGU1ZxJwYvP98617", true},
+	} {
+		wif, err := btcutil.DecodeWIF(vector.wif)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxo, err := P2PKHUTXO(&chaincfg.MainNetParams, wif, wire.OutPoint{}, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		signature, err := SignMessage(utxo, "Hello World", MessageLegacy)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// the header byte is 27 to 30 for an uncompressed pubkey and 31 to 34 for a compressed one
+		raw, err := base64.StdEncoding.DecodeString(signature)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if compressed := raw[0] >= 31; compressed != vector.compressed {
+			t.Errorf("%s: header %d", vector.wif, raw[0])
+		}
+
+		for _, compressed := range []bool{true, false} {
+			pubkey := wif.PrivKey.PubKey().SerializeUncompressed()
+			if compressed {
+				pubkey = wif.PrivKey.PubKey().SerializeCompressed()
+			}
+			address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(pubkey), &chaincfg.MainNetParams)
+			if err != nil {
+				t.Fatal(err)
+			}
+			format, err := VerifyMessage(address.String(), "Hello World", signature, &chaincfg.MainNetParams)
+			if compressed == vector.compressed && (err != nil || format != MessageLegacy) {
+				t.Errorf("%s: %s %v", vector.wif, format, err)
+			}
+			if compressed != vector.compressed && !errors.Is(err, ErrInvalidSignature) {
+				t.Errorf("%s: the address of the other pubkey got %v", vector.wif, err)
+			}
+		}
+	}
+}
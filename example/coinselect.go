@@ -0,0 +1,387 @@
+package example
+
+import (
+	"cmp"
+	"errors"
+	"math"
+	"math/rand/v2"
+	"slices"
+
+	"github.com/btcsuite/btcd/blockchain"
+)
+
+const (
+	// DefaultLongTermFeeRate is the fee rate in sat/vB expected to spend the utxos in the future
+	DefaultLongTermFeeRate = 10
+
+	// bnbMaxTries bounds the depth first search of branch and bound, the same as bitcoin core
+	bnbMaxTries = 100_000
+	// knapsackIterations is the rounds of the stochastic approximation of knapsack
+	knapsackIterations = 1000
+)
+
+// CoinSelectParams describes the payment that the coin selection should fund
+type CoinSelectParams struct {
+	// Target is the amount to fund, the recipients plus the fee of the transaction without inputs
+	Target int64
+
+	// FeeRate in sat/vB
+	FeeRate int64
+
+	// LongTermFeeRate in sat/vB, the inputs spent now instead of later are counted as waste
+	// against it, DefaultLongTermFeeRate if zero
+	LongTermFeeRate int64
+
+	// ChangeFee is the fee to add the change output
+	ChangeFee int64
+
+	// CostOfChange is ChangeFee plus the fee to spend the change at the long term fee rate
+	CostOfChange int64
+
+	// MinChange is the smallest change worth to create, usually the dust threshold of the change
+	MinChange int64
+}
+
+func (p *CoinSelectParams) longTermFeeRate() int64 {
+	if p.LongTermFeeRate == 0 {
+		return DefaultLongTermFeeRate
+	}
+	return p.LongTermFeeRate
+}
+
+// CoinSelection is the result of a coin selection
+type CoinSelection struct {
+	Inputs []*UTXO
+
+	// Change is the value of the change output after paying its fee, zero for changeless selection
+	Change int64
+
+	// Waste is the cost of spending the inputs now rather than at the long term fee rate,
+	// plus the cost of change or the excess dropped to the fee
+	//
+	// https://github.com/bitcoin/bitcoin/blob/master/src/wallet/coinselection.h
+	Waste int64
+}
+
+// CoinSelector picks the utxos from the pool to fund the params
+type CoinSelector func(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error)
+
+// coin is an utxo together with its fee at the current and the long term fee rate
+type coin struct {
+	utxo        *UTXO
+	fee         int64
+	longTermFee int64
+	// effValue is the amount minus the fee to spend it
+	effValue int64
+}
+
+// feeForWeight returns the fee of weight units at the fee rate in sat/vB, rounded up
+func feeForWeight(weight, feeRate int64) int64 {
+	return (weight*feeRate + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+}
+
+// prepareCoins computes the effective value of every utxo, the ones that cost more than they're worth are skipped
+func prepareCoins(pool []*UTXO, params *CoinSelectParams) ([]*coin, error) {
+	coins := make([]*coin, 0, len(pool))
+	for _, utxo := range pool {
+		weight, err := inputWeight(utxo)
+		if err != nil {
+			return nil, err
+		}
+
+		c := &coin{
+			utxo:        utxo,
+			fee:         feeForWeight(weight, params.FeeRate),
+			longTermFee: feeForWeight(weight, params.longTermFeeRate()),
+		}
+		c.effValue = utxo.Amount - c.fee
+		if c.effValue > 0 {
+			coins = append(coins, c)
+		}
+	}
+	return coins, nil
+}
+
+// newSelection computes the change and the waste of the coins
+func newSelection(coins []*coin, params *CoinSelectParams, changeless bool) *CoinSelection {
+	selection := &CoinSelection{Inputs: make([]*UTXO, 0, len(coins))}
+
+	var effValue int64
+	for _, c := range coins {
+		selection.Inputs = append(selection.Inputs, c.utxo)
+		selection.Waste += c.fee - c.longTermFee
+		effValue += c.effValue
+	}
+
+	excess := effValue - params.Target
+	if change := excess - params.ChangeFee; !changeless && change >= params.MinChange {
+		selection.Change = change
+		selection.Waste += params.CostOfChange
+	} else {
+		selection.Waste += excess
+	}
+	return selection
+}
+
+func sumEffValue(coins []*coin) int64 {
+	var sum int64
+	for _, c := range coins {
+		sum += c.effValue
+	}
+	return sum
+}
+
+func sortCoinsDesc(coins []*coin) {
+	slices.SortStableFunc(coins, func(a, b *coin) int {
+		return cmp.Compare(b.effValue, a.effValue)
+	})
+}
+
+// SelectBranchAndBound searches for a changeless selection whose effective value is in
+// [target, target + cost of change], it minimizes the waste
+//
+// https://github.com/bitcoin/bitcoin/blob/master/src/wallet/coinselection.cpp
+func SelectBranchAndBound(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error) {
+	coins, err := prepareCoins(pool, params)
+	if err != nil {
+		return nil, err
+	}
+	sortCoinsDesc(coins)
+
+	currAvailable := sumEffValue(coins)
+	if currAvailable < params.Target {
+		return nil, ErrInsufficientFunds
+	}
+
+	var (
+		target     = params.Target
+		upperBound = params.Target + params.CostOfChange
+		// when the fee rate is higher than the long term one, adding inputs only increases the waste
+		feeRateHigh = params.FeeRate > params.longTermFeeRate()
+
+		currValue, currWaste int64
+		currSelection        []int
+		bestSelection        []int
+		bestWaste            int64 = math.MaxInt64
+	)
+
+	for tries, idx := 0, 0; tries < bnbMaxTries; tries, idx = tries+1, idx+1 {
+		backtrack := false
+		if currValue+currAvailable < target || currValue > upperBound || (currWaste > bestWaste && feeRateHigh) {
+			backtrack = true
+		} else if currValue >= target {
+			// the excess is counted as waste for the changeless solution
+			if waste := currWaste + currValue - target; waste <= bestWaste {
+				bestSelection = slices.Clone(currSelection)
+				bestWaste = waste
+			}
+			backtrack = true
+		}
+
+		if backtrack {
+			if len(currSelection) == 0 {
+				// all the branches are searched
+				break
+			}
+
+			// add the omitted coins back before trying the omission branch of the last included coin
+			for idx--; idx > currSelection[len(currSelection)-1]; idx-- {
+				currAvailable += coins[idx].effValue
+			}
+
+			c := coins[idx]
+			currValue -= c.effValue
+			currWaste -= c.fee - c.longTermFee
+			currSelection = currSelection[:len(currSelection)-1]
+		} else {
+			c := coins[idx]
+			currAvailable -= c.effValue
+
+			// skip the inclusion branch if the previous coin is the same and it was excluded
+			if len(currSelection) == 0 || idx-1 == currSelection[len(currSelection)-1] ||
+				c.effValue != coins[idx-1].effValue || c.fee != coins[idx-1].fee {
+				currSelection = append(currSelection, idx)
+				currValue += c.effValue
+				currWaste += c.fee - c.longTermFee
+			}
+		}
+	}
+
+	if bestSelection == nil {
+		return nil, ErrInsufficientFunds
+	}
+
+	selected := make([]*coin, 0, len(bestSelection))
+	for _, idx := range bestSelection {
+		selected = append(selected, coins[idx])
+	}
+	return newSelection(selected, params, true), nil
+}
+
+// SelectSingleRandomDraw picks random utxos until the target and the minimal change are funded
+func SelectSingleRandomDraw(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error) {
+	coins, err := prepareCoins(pool, params)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(coins), func(i, j int) {
+		coins[i], coins[j] = coins[j], coins[i]
+	})
+
+	target := params.Target + params.ChangeFee + params.MinChange
+	var value int64
+	for i, c := range coins {
+		value += c.effValue
+		if value >= target {
+			return newSelection(coins[:i+1], params, false), nil
+		}
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// SelectLargestFirst picks the largest utxos until the target and the minimal change are funded,
+// it falls back to a changeless selection if all the utxos only fund the target
+func SelectLargestFirst(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error) {
+	coins, err := prepareCoins(pool, params)
+	if err != nil {
+		return nil, err
+	}
+	sortCoinsDesc(coins)
+
+	target := params.Target + params.ChangeFee + params.MinChange
+	var value int64
+	for i, c := range coins {
+		value += c.effValue
+		if value >= target {
+			return newSelection(coins[:i+1], params, false), nil
+		}
+	}
+	if value >= params.Target {
+		return newSelection(coins, params, true), nil
+	}
+	return nil, ErrInsufficientFunds
+}
+
+// SelectKnapsack is the stochastic approximation of the subset sum used by bitcoin core before branch and bound,
+// it looks for the smallest subset above the target, or above the target plus the minimal change
+func SelectKnapsack(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error) {
+	coins, err := prepareCoins(pool, params)
+	if err != nil {
+		return nil, err
+	}
+	rand.Shuffle(len(coins), func(i, j int) {
+		coins[i], coins[j] = coins[j], coins[i]
+	})
+
+	target := params.Target + params.ChangeFee
+	changeTarget := params.MinChange
+
+	var (
+		applicable    []*coin
+		totalLower    int64
+		lowestLarger  *coin
+		selectedCoins []*coin
+	)
+	for _, c := range coins {
+		switch {
+		case c.effValue == target:
+			return newSelection([]*coin{c}, params, false), nil
+		case c.effValue < target+changeTarget:
+			applicable = append(applicable, c)
+			totalLower += c.effValue
+		case lowestLarger == nil || c.effValue < lowestLarger.effValue:
+			lowestLarger = c
+		}
+	}
+
+	switch {
+	case totalLower == target:
+		return newSelection(applicable, params, false), nil
+	case totalLower < target:
+		if lowestLarger == nil {
+			return nil, ErrInsufficientFunds
+		}
+		return newSelection([]*coin{lowestLarger}, params, false), nil
+	}
+
+	sortCoinsDesc(applicable)
+	best, bestValue := approximateBestSubset(applicable, totalLower, target)
+	if bestValue != target && totalLower >= target+changeTarget {
+		best, bestValue = approximateBestSubset(applicable, totalLower, target+changeTarget)
+	}
+
+	// the lowest larger coin is preferred if the subset doesn't leave enough change or it's even smaller
+	if lowestLarger != nil &&
+		((bestValue != target && bestValue < target+changeTarget) || lowestLarger.effValue <= bestValue) {
+		return newSelection([]*coin{lowestLarger}, params, false), nil
+	}
+
+	for i, included := range best {
+		if included {
+			selectedCoins = append(selectedCoins, applicable[i])
+		}
+	}
+	return newSelection(selectedCoins, params, false), nil
+}
+
+func approximateBestSubset(coins []*coin, totalLower, target int64) ([]bool, int64) {
+	best := make([]bool, len(coins))
+	for i := range best {
+		best[i] = true
+	}
+	bestValue := totalLower
+
+	included := make([]bool, len(coins))
+	for rep := 0; rep < knapsackIterations && bestValue != target; rep++ {
+		clear(included)
+
+		var total int64
+		reachedTarget := false
+		for pass := 0; pass < 2 && !reachedTarget; pass++ {
+			for i, c := range coins {
+				// the first pass picks randomly, the second pass picks all the rest
+				if (pass == 0 && rand.IntN(2) == 0) || (pass == 1 && !included[i]) {
+					total += c.effValue
+					included[i] = true
+					if total >= target {
+						reachedTarget = true
+						if total < bestValue {
+							bestValue = total
+							copy(best, included)
+						}
+						total -= c.effValue
+						included[i] = false
+					}
+				}
+			}
+		}
+	}
+	return best, bestValue
+}
+
+// SelectCoins runs all the strategies and returns the selection with the least waste
+func SelectCoins(pool []*UTXO, params *CoinSelectParams) (*CoinSelection, error) {
+	var best *CoinSelection
+	for _, selector := range []CoinSelector{
+		SelectBranchAndBound,
+		SelectKnapsack,
+		SelectSingleRandomDraw,
+		SelectLargestFirst,
+	} {
+		selection, err := selector(pool, params)
+		if errors.Is(err, ErrInsufficientFunds) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || selection.Waste < best.Waste {
+			best = selection
+		}
+	}
+
+	if best == nil {
+		return nil, ErrInsufficientFunds
+	}
+	return best, nil
+}
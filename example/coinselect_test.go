@@ -0,0 +1,170 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+const testCoinFeeRate = 10
+
+// testCoins are p2wpkh utxos with the effective values at testCoinFeeRate
+func testCoins(t *testing.T, effValues ...int64) []*UTXO {
+	t.Helper()
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(testKey(1).PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pool := testPool(effValues...)
+	for _, utxo := range pool {
+		utxo.PkScript = pkScript
+		utxo.SpendType = SpendP2WPKH
+		weight, err := inputWeight(utxo)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxo.Amount += feeForWeight(weight, testCoinFeeRate)
+	}
+	return pool
+}
+
+// testCoinParams has the same current and long term fee rate, so only the change or the excess is waste
+func testCoinParams(target, minChange int64) *CoinSelectParams {
+	return &CoinSelectParams{
+		Target:          target,
+		FeeRate:         testCoinFeeRate,
+		LongTermFeeRate: testCoinFeeRate,
+		ChangeFee:       20,
+		CostOfChange:    50,
+		MinChange:       minChange,
+	}
+}
+
+func selectedEffValue(t *testing.T, selection *CoinSelection) int64 {
+	t.Helper()
+	coins, err := prepareCoins(selection.Inputs, &CoinSelectParams{FeeRate: testCoinFeeRate})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sumEffValue(coins)
+}
+
+func TestSelectBranchAndBound(t *testing.T) {
+	pool := testCoins(t, 1000, 2000, 3000, 5000)
+
+	selection, err := SelectBranchAndBound(pool, testCoinParams(5000, 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := selectedEffValue(t, selection); value != 5000 || selection.Change != 0 || selection.Waste != 0 {
+		t.Errorf("value %d, change %d, waste %d", value, selection.Change, selection.Waste)
+	}
+
+	// the excess within the cost of change is dropped to the fee
+	selection, err = SelectBranchAndBound(pool, testCoinParams(5970, 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := selectedEffValue(t, selection); value != 6000 || selection.Change != 0 || selection.Waste != 30 {
+		t.Errorf("value %d, change %d, waste %d", value, selection.Change, selection.Waste)
+	}
+
+	// no subset in [target, target + cost of change]
+	if _, err := SelectBranchAndBound(pool, testCoinParams(4500, 500)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSelectKnapsack(t *testing.T) {
+	pool := testCoins(t, 1000, 2000, 3000, 5000)
+
+	// a single coin matches the target plus the change fee
+	selection, err := SelectKnapsack(pool, testCoinParams(2980, 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(selection.Inputs) != 1 || selectedEffValue(t, selection) != 3000 {
+		t.Errorf("selected %d inputs", len(selection.Inputs))
+	}
+
+	// the subset sum of 1000+5000 or 1000+2000+3000
+	selection, err = SelectKnapsack(pool, testCoinParams(5980, 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := selectedEffValue(t, selection); value != 6000 {
+		t.Errorf("value %d, want 6000", value)
+	}
+
+	if _, err := SelectKnapsack(pool, testCoinParams(11000, 500)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSelectSingleRandomDraw(t *testing.T) {
+	pool := testCoins(t, 1000, 2000, 3000, 5000)
+	params := testCoinParams(4000, 500)
+	for range 10 {
+		selection, err := SelectSingleRandomDraw(pool, params)
+		if err != nil {
+			t.Fatal(err)
+		}
+		value := selectedEffValue(t, selection)
+		if value < params.Target+params.ChangeFee+params.MinChange || selection.Change != value-params.Target-params.ChangeFee {
+			t.Errorf("value %d, change %d", value, selection.Change)
+		}
+	}
+
+	if _, err := SelectSingleRandomDraw(pool, testCoinParams(10800, 500)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSelectLargestFirst(t *testing.T) {
+	pool := testCoins(t, 1000, 2000, 3000, 5000)
+
+	for _, test := range []struct {
+		target, inputs, change, waste int64
+	}{
+		{4000, 1, 980, 50},
+		{10000, 4, 980, 50},
+		// not enough for the minimal change, the rest is dropped to the fee
+		{10800, 4, 0, 200},
+	} {
+		selection, err := SelectLargestFirst(pool, testCoinParams(test.target, 500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int64(len(selection.Inputs)) != test.inputs || selection.Change != test.change || selection.Waste != test.waste {
+			t.Errorf("target %d: %d inputs, change %d, waste %d", test.target, len(selection.Inputs), selection.Change, selection.Waste)
+		}
+	}
+
+	if _, err := SelectLargestFirst(pool, testCoinParams(11001, 500)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestSelectCoins(t *testing.T) {
+	pool := testCoins(t, 1000, 2000, 3000, 5000)
+
+	// only branch and bound finds the selection without waste
+	selection, err := SelectCoins(pool, testCoinParams(5000, 500))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := selectedEffValue(t, selection); value != 5000 || selection.Change != 0 || selection.Waste != 0 {
+		t.Errorf("value %d, change %d, waste %d", value, selection.Change, selection.Waste)
+	}
+
+	if _, err := SelectCoins(pool, testCoinParams(12000, 500)); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
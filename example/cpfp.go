@@ -0,0 +1,86 @@
+package example
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ChildPaysForParent bumps a stuck parent by a child spending our output of it, it works when we are
+// the recipient or the parent doesn't signal bip125. The miners take the package of both, so the child
+// pays its own vsize at the fee rate plus what the parent lacks:
+//
+//	(parentFee + childFee) / (parentVSize + childVSize) >= feeRate
+//
+// Ours are the templates of our outputs like the pool of the builders, the script, the spend type and
+// the keys, the largest output of the parent paying to one of them is spent. The pool funds the child
+// if that output is too small and the rest goes to the change address, the child fails if the change is dust
+// since it would have no output.
+func ChildPaysForParent(parent *wire.MsgTx, parentFee int64, ours, pool []*UTXO,
+	changeAddress btcutil.Address, feeRate int64) (*wire.MsgTx, error) {
+	if changeAddress == nil {
+		return nil, fmt.Errorf("%w: the child needs a change address", ErrInvalidAddress)
+	}
+	output, err := cpfpOutput(parent, ours)
+	if err != nil {
+		return nil, err
+	}
+
+	parentVSize := mempool.GetTxVirtualSize(btcutil.NewTx(parent))
+	deficit := parentVSize*feeRate - parentFee
+	if deficit <= 0 {
+		return nil, fmt.Errorf("parent pays %d for %d vbytes, it already reaches %d sat/vB",
+			parentFee, parentVSize, feeRate)
+	}
+
+	child, err := (&TxBuilder{
+		Inputs:        []*UTXO{output},
+		Pool:          pool,
+		ChangeAddress: changeAddress,
+		FeeRate:       feeRate,
+		ExtraFee:      deficit,
+	}).Build()
+	if err != nil {
+		return nil, err
+	}
+
+	// the estimator never counts less than the signed size, check the package anyway
+	inputs, err := spentUTXOs(child, append([]*UTXO{output}, pool...))
+	if err != nil {
+		return nil, err
+	}
+	packageFee := parentFee + txFee(child, inputs)
+	packageVSize := parentVSize + mempool.GetTxVirtualSize(btcutil.NewTx(child))
+	if packageFee < packageVSize*feeRate {
+		return nil, fmt.Errorf("%w: package fee %d for %d vbytes is below %d sat/vB",
+			ErrFeeExceedsInput, packageFee, packageVSize, feeRate)
+	}
+	return child, nil
+}
+
+// cpfpOutput returns the utxo of the largest output of the parent paying to one of our scripts
+func cpfpOutput(parent *wire.MsgTx, ours []*UTXO) (*UTXO, error) {
+	parentHash := parent.TxHash()
+	var found *UTXO
+	for idx, txout := range parent.TxOut {
+		if found != nil && txout.Value <= found.Amount {
+			continue
+		}
+		for _, template := range ours {
+			if bytes.Equal(template.PkScript, txout.PkScript) {
+				spend := *template
+				spend.OutPoint = wire.OutPoint{Hash: parentHash, Index: uint32(idx)}
+				spend.Amount = txout.Value
+				found = &spend
+				break
+			}
+		}
+	}
+	if found == nil {
+		return nil, fmt.Errorf("%w: no output of %s pays to us", ErrInsufficientFunds, parentHash)
+	}
+	return found, nil
+}
@@ -0,0 +1,48 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+)
+
+func TestChildPaysForParent(t *testing.T) {
+	prvkey := testKey(1)
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(prvkey.PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := testPool(60000)
+	parent, err := Pay2WitnessPubkeyHashAddr(testNet, prvkey, pool, 20000, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	parentFee := txFee(parent, pool)
+	parentVSize := mempool.GetTxVirtualSize(btcutil.NewTx(parent))
+	ours := []*UTXO{{PkScript: parent.TxOut[0].PkScript, SpendType: SpendP2WPKH, Keys: []*btcec.PrivateKey{prvkey}}}
+
+	child, err := ChildPaysForParent(parent, parentFee, ours, nil, address, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(child.TxIn) != 1 || child.TxIn[0].PreviousOutPoint.Hash != parent.TxHash() || len(child.TxOut) != 1 {
+		t.Fatalf("child %+v", child)
+	}
+	// the largest output of the parent is spent
+	spent := parent.TxOut[child.TxIn[0].PreviousOutPoint.Index].Value
+	packageFee := parentFee + spent - child.TxOut[0].Value
+	packageVSize := parentVSize + mempool.GetTxVirtualSize(btcutil.NewTx(child))
+	if spent != max(parent.TxOut[0].Value, parent.TxOut[1].Value) || packageFee < packageVSize*10 {
+		t.Errorf("spent %d, package fee %d for %d vbytes", spent, packageFee, packageVSize)
+	}
+
+	if _, err := ChildPaysForParent(parent, parentFee, ours, nil, nil, 10); !errors.Is(err, ErrInvalidAddress) {
+		t.Errorf("no change address: got %v, want ErrInvalidAddress", err)
+	}
+	if _, err := ChildPaysForParent(parent, parentFee, ours, nil, address, 1); err == nil {
+		t.Error("the parent already pays the fee rate")
+	}
+}
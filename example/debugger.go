@@ -0,0 +1,280 @@
+package example
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// ScriptTrace is the opcode by opcode execution of an input
+type ScriptTrace struct {
+	Input int `json:"input"`
+	// Scripts are executed in order: the scriptSig, the pkScript, then the redeem script,
+	// the witness script or the tapscript leaf if any
+	Scripts []*TraceScript `json:"scripts"`
+	Steps   []*TraceStep   `json:"steps"`
+	// Stack is the stack after the last step
+	Stack []string `json:"stack"`
+	// Error is the reason of the failure, empty if the input is valid
+	Error string `json:"error,omitempty"`
+}
+
+// TraceScript is a script run by the engine
+type TraceScript struct {
+	Name string `json:"name"`
+	Asm  string `json:"asm"`
+}
+
+// TraceStep is the state of the engine before the opcode executes, the stack items are in hex
+// from the bottom to the top
+type TraceStep struct {
+	Script int    `json:"script"`
+	Index  int    `json:"index"`
+	Opcode string `json:"opcode"`
+	// Executing is false if the opcode is in a branch not taken, the conditional opcodes always execute
+	Executing bool     `json:"executing"`
+	Stack     []string `json:"stack"`
+	AltStack  []string `json:"alt_stack"`
+	// CondStack is the OP_IF branches from the outermost one, true if the branch is taken
+	CondStack []bool `json:"cond_stack"`
+}
+
+// the states of the condition stack, a skipped branch is nested in a branch not taken
+const (
+	condFalse int8 = iota
+	condTrue
+	condSkip
+)
+
+// TraceInput executes the input of the transaction step by step with the standard verification flags,
+// the fetcher has the outputs spent by all the inputs. A script failure is recorded in the trace,
+// the error is returned only if the input can't be executed at all.
+func TraceInput(tx *wire.MsgTx, idx int, fetcher txscript.PrevOutputFetcher) (*ScriptTrace, error) {
+	if idx < 0 || idx >= len(tx.TxIn) {
+		return nil, fmt.Errorf("%w: no input %d", ErrScriptVerify, idx)
+	}
+	for i, txin := range tx.TxIn {
+		if fetcher.FetchPrevOutput(txin.PreviousOutPoint) == nil {
+			return nil, fmt.Errorf("%w: no output %s spent by input %d", ErrScriptVerify, txin.PreviousOutPoint, i)
+		}
+	}
+
+	txin := tx.TxIn[idx]
+	prevOut := fetcher.FetchPrevOutput(txin.PreviousOutPoint)
+	trace := &ScriptTrace{Input: idx}
+	vm, err := txscript.NewEngine(prevOut.PkScript, tx, idx, txscript.StandardVerifyFlags, nil,
+		txscript.NewTxSigHashes(tx, fetcher), prevOut.Value, fetcher)
+	if err != nil {
+		trace.Error = err.Error()
+		return trace, nil
+	}
+
+	var (
+		condStack  []int8
+		lastScript = -1
+	)
+	for done := false; !done; {
+		pc, err := vm.DisasmPC()
+		if err != nil {
+			trace.Error = err.Error()
+			break
+		}
+		step, err := parseTracePC(pc)
+		if err != nil {
+			return nil, err
+		}
+		if step.Script != lastScript {
+			condStack, lastScript = nil, step.Script
+		}
+
+		executing := !slices.Contains(condStack, condFalse) && !slices.Contains(condStack, condSkip)
+		// the conditional opcodes run in the branches not taken to track the nesting
+		step.Executing = executing || isConditionalOpcode(step.Opcode)
+		step.Stack = hexStack(vm.GetStack())
+		step.AltStack = hexStack(vm.GetAltStack())
+		step.CondStack = make([]bool, 0, len(condStack))
+		for _, cond := range condStack {
+			step.CondStack = append(step.CondStack, cond == condTrue)
+		}
+		trace.Steps = append(trace.Steps, step)
+
+		condStack = nextCondStack(condStack, step.Opcode, executing, vm.GetStack())
+		if done, err = vm.Step(); err != nil {
+			trace.Error = err.Error()
+			break
+		}
+	}
+
+	// the final check pops the top item
+	trace.Stack = hexStack(vm.GetStack())
+	if trace.Error == "" {
+		if err := vm.CheckErrorCondition(true); err != nil {
+			trace.Error = err.Error()
+		}
+	}
+
+	names := traceScriptNames(txin, prevOut.PkScript)
+	for i := 0; ; i++ {
+		asm, err := vm.DisasmScript(i)
+		if err != nil {
+			break
+		}
+		script := &TraceScript{Name: fmt.Sprintf("script %d", i), Asm: traceAsm(asm)}
+		if i < len(names) {
+			script.Name = names[i]
+		}
+		trace.Scripts = append(trace.Scripts, script)
+	}
+	return trace, nil
+}
+
+// parseTracePC parses `<script index>:<opcode index>: <opcode>` of DisasmPC
+func parseTracePC(pc string) (*TraceStep, error) {
+	step := new(TraceStep)
+	parts := strings.SplitN(pc, ": ", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("%w: bad program counter %q", ErrScriptVerify, pc)
+	}
+	if _, err := fmt.Sscanf(parts[0], "%x:%x", &step.Script, &step.Index); err != nil {
+		return nil, fmt.Errorf("%w: bad program counter %q", ErrScriptVerify, pc)
+	}
+	step.Opcode = parts[1]
+	return step, nil
+}
+
+func isConditionalOpcode(opcode string) bool {
+	switch opcode {
+	case "OP_IF", "OP_NOTIF", "OP_ELSE", "OP_ENDIF":
+		return true
+	}
+	return false
+}
+
+// nextCondStack mirrors the condition stack of the engine after the opcode, the engine doesn't expose it
+func nextCondStack(condStack []int8, opcode string, executing bool, stack [][]byte) []int8 {
+	switch opcode {
+	case "OP_IF", "OP_NOTIF":
+		cond := condSkip
+		if executing && len(stack) > 0 {
+			cond = condFalse
+			if scriptBool(stack[len(stack)-1]) == (opcode == "OP_IF") {
+				cond = condTrue
+			}
+		}
+		return append(condStack, cond)
+	case "OP_ELSE":
+		if n := len(condStack); n > 0 && condStack[n-1] != condSkip {
+			condStack[n-1] = condTrue - condStack[n-1]
+		}
+	case "OP_ENDIF":
+		if n := len(condStack); n > 0 {
+			return condStack[:n-1]
+		}
+	}
+	return condStack
+}
+
+// scriptBool is false for the empty vector, zeros and the negative zero
+func scriptBool(data []byte) bool {
+	for i, b := range data {
+		if b != 0 {
+			return i != len(data)-1 || b != 0x80
+		}
+	}
+	return false
+}
+
+// traceScriptNames names the scripts in the order the engine runs them
+func traceScriptNames(txin *wire.TxIn, pkScript []byte) []string {
+	names := []string{"scriptSig", "pkScript"}
+	program := pkScript
+	if txscript.IsPayToScriptHash(pkScript) {
+		names = append(names, "redeemScript")
+		if pushes, err := txscript.PushedData(txin.SignatureScript); err == nil && len(pushes) > 0 {
+			program = pushes[len(pushes)-1]
+		}
+	}
+
+	switch {
+	case txscript.IsPayToWitnessPubKeyHash(program):
+		// the engine runs the p2pkh script of the pubkey hash
+		names = append(names, "p2wpkh")
+	case txscript.IsPayToWitnessScriptHash(program):
+		names = append(names, "witnessScript")
+	case txscript.IsPayToTaproot(program):
+		names = append(names, "tapscript")
+	}
+	return names
+}
+
+// traceAsm joins the opcodes of DisasmScript in a line
+func traceAsm(disasm string) string {
+	var ops []string
+	for _, line := range strings.Split(strings.TrimSpace(disasm), "\n") {
+		if _, op, ok := strings.Cut(line, ": "); ok {
+			ops = append(ops, op)
+		}
+	}
+	return strings.Join(ops, " ")
+}
+
+func hexStack(stack [][]byte) []string {
+	items := make([]string, 0, len(stack))
+	for _, item := range stack {
+		items = append(items, hex.EncodeToString(item))
+	}
+	return items
+}
+
+// String renders the trace as text, an empty stack item is shown as <>
+func (t *ScriptTrace) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "input %d\n", t.Input)
+	for i, script := range t.Scripts {
+		fmt.Fprintf(&buf, "  %02x %s: %s\n", i, script.Name, script.Asm)
+	}
+
+	for _, step := range t.Steps {
+		skipped := ""
+		if !step.Executing {
+			skipped = " (skipped)"
+		}
+		fmt.Fprintf(&buf, "%02x:%04x %s%s\n", step.Script, step.Index, step.Opcode, skipped)
+		fmt.Fprintf(&buf, "        stack: %s\n", traceItems(step.Stack))
+		if len(step.AltStack) > 0 {
+			fmt.Fprintf(&buf, "        alt stack: %s\n", traceItems(step.AltStack))
+		}
+		if len(step.CondStack) > 0 {
+			fmt.Fprintf(&buf, "        cond stack: %v\n", step.CondStack)
+		}
+	}
+
+	fmt.Fprintf(&buf, "final stack: %s\n", traceItems(t.Stack))
+	if t.Error != "" {
+		fmt.Fprintf(&buf, "error: %s\n", t.Error)
+	} else {
+		buf.WriteString("ok\n")
+	}
+	return buf.String()
+}
+
+// JSON renders the trace as indented JSON
+func (t *ScriptTrace) JSON() ([]byte, error) {
+	return json.MarshalIndent(t, "", "  ")
+}
+
+func traceItems(items []string) string {
+	shown := make([]string, 0, len(items))
+	for _, item := range items {
+		if item == "" {
+			item = "<>"
+		}
+		shown = append(shown, item)
+	}
+	return "[" + strings.Join(shown, " ") + "]"
+}
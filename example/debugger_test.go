@@ -0,0 +1,172 @@
+package example
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testCheckBranch checks the steps of the script with a single OP_IF/OP_ELSE/OP_ENDIF,
+// the if branch is taken or not
+func testCheckBranch(t *testing.T, trace *ScriptTrace, name string, takeIf bool) {
+	t.Helper()
+	var (
+		branch string
+		seen   int
+	)
+	for _, step := range trace.Steps {
+		if trace.Scripts[step.Script].Name != name {
+			continue
+		}
+		seen++
+		switch step.Opcode {
+		case "OP_IF", "OP_NOTIF":
+			branch = "if"
+			if len(step.CondStack) != 0 || !step.Executing {
+				t.Errorf("%s: cond stack %v before OP_IF", step.Opcode, step.CondStack)
+			}
+			continue
+		case "OP_ELSE":
+			branch = "else"
+			if !slices.Equal(step.CondStack, []bool{takeIf}) || !step.Executing {
+				t.Errorf("OP_ELSE: cond stack %v", step.CondStack)
+			}
+			continue
+		case "OP_ENDIF":
+			branch = "end"
+			continue
+		}
+
+		switch branch {
+		case "if", "else":
+			taken := takeIf == (branch == "if")
+			if !slices.Equal(step.CondStack, []bool{taken}) || step.Executing != taken {
+				t.Errorf("%s in the %s branch: executing %t, cond stack %v", step.Opcode, branch, step.Executing, step.CondStack)
+			}
+		default:
+			if len(step.CondStack) != 0 || !step.Executing {
+				t.Errorf("%s out of the branches: executing %t, cond stack %v", step.Opcode, step.Executing, step.CondStack)
+			}
+		}
+	}
+	if seen == 0 || branch != "end" {
+		t.Errorf("%d steps of %s, last branch %q", seen, name, branch)
+	}
+}
+
+func TestTraceBip112(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	for _, useTimelock := range []bool{true, false} {
+		builder, err := newBip112P2wshBuilder(testNet, alice.PubKey(), bob.PubKey(), testPool(100000), 50000, 2,
+			10, useTimelock, []byte("timelock"), []byte("multisig"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := CreateBip112P2wsh(testNet, alice, bob, testPool(100000), 50000, 2,
+			10, useTimelock, []byte("timelock"), []byte("multisig"))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		trace, err := TraceInput(tx, 0, prevOutFetcher(builder.Pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trace.Error != "" {
+			t.Fatalf("timelock %t: %s", useTimelock, trace)
+		}
+		names := make([]string, 0, len(trace.Scripts))
+		for _, script := range trace.Scripts {
+			names = append(names, script.Name)
+		}
+		if !slices.Equal(names, []string{"scriptSig", "pkScript", "witnessScript"}) {
+			t.Errorf("scripts %v", names)
+		}
+		testCheckBranch(t, trace, "witnessScript", useTimelock)
+
+		// the first step of the witness script has the witness items on the stack
+		for _, step := range trace.Steps {
+			if trace.Scripts[step.Script].Name == "witnessScript" {
+				if want := len(tx.TxIn[0].Witness) - 1; len(step.Stack) != want {
+					t.Errorf("%d items on the stack, want %d", len(step.Stack), want)
+				}
+				break
+			}
+		}
+
+		// a wrong preimage fails in the trace, not as an error
+		tx.TxIn[0].Witness[len(tx.TxIn[0].Witness)-2] = []byte("wrong")
+		trace, err = TraceInput(tx, 0, prevOutFetcher(builder.Pool))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if trace.Error == "" || !strings.Contains(trace.String(), "error: ") {
+			t.Errorf("timelock %t: the wrong preimage passes\n%s", useTimelock, trace)
+		}
+	}
+}
+
+func TestTraceTapscript(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	leafScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_IF).
+		AddData(schnorr.SerializePubKey(alice.PubKey())).AddOp(txscript.OP_CHECKSIG).
+		AddOp(txscript.OP_ELSE).
+		AddData(schnorr.SerializePubKey(bob.PubKey())).AddOp(txscript.OP_CHECKSIG).
+		AddOp(txscript.OP_ENDIF).
+		Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaf := txscript.NewBaseTapLeaf(leafScript)
+	tree, err := NewTapTree(leaf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend, err := tree.spend(NothingInMySleeve, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxo := spendFrom(testPool(100000), *spend)[0]
+
+	tx := wire.NewMsgTx(2)
+	tx.AddTxIn(wire.NewTxIn(&utxo.OutPoint, nil, nil))
+	tx.AddTxOut(wire.NewTxOut(90000, utxo.PkScript))
+	fetcher := prevOutFetcher([]*UTXO{utxo})
+	sig, err := txscript.RawTxInTapscriptSignature(tx, txscript.NewTxSigHashes(tx, fetcher), 0, utxo.Amount,
+		utxo.PkScript, leaf, txscript.SigHashDefault, bob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bob signs the else branch
+	tx.TxIn[0].Witness = wire.TxWitness{sig, nil, leafScript, utxo.ControlBlock}
+
+	trace, err := TraceInput(tx, 0, fetcher)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if trace.Error != "" || !slices.Equal(trace.Stack, []string{"01"}) {
+		t.Fatalf("%s", trace)
+	}
+	if name := trace.Scripts[len(trace.Scripts)-1].Name; name != "tapscript" {
+		t.Errorf("the leaf is named %s", name)
+	}
+	testCheckBranch(t, trace, "tapscript", false)
+
+	data, err := trace.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded ScriptTrace
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded.Steps) != len(trace.Steps) || decoded.Scripts[len(decoded.Scripts)-1].Asm != trace.Scripts[len(trace.Scripts)-1].Asm {
+		t.Errorf("json %s", data)
+	}
+}
@@ -0,0 +1,517 @@
+package example
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/btcec/v2/ecdsa"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// DecodedTx explains every field of a raw transaction
+type DecodedTx struct {
+	Txid    string `json:"txid"`
+	Wtxid   string `json:"wtxid"`
+	Version int32  `json:"version"`
+	// Segwit is true if the transaction has the marker 0x00 and the flag 0x01 after the version
+	Segwit bool  `json:"segwit"`
+	Size   int   `json:"size"`
+	Weight int64 `json:"weight"`
+	VSize  int64 `json:"vsize"`
+	// Replaceable is true if any input signals bip125 replaceability
+	Replaceable     bool             `json:"replaceable"`
+	Inputs          []*DecodedInput  `json:"inputs"`
+	Outputs         []*DecodedOutput `json:"outputs"`
+	LockTime        uint32           `json:"locktime"`
+	LockTimeMeaning string           `json:"locktime_meaning"`
+	// Fee and FeeRate are known only if the outputs spent by all the inputs are supplied
+	Fee     *int64   `json:"fee,omitempty"`
+	FeeRate *float64 `json:"fee_rate,omitempty"`
+}
+
+// DecodedInput is an input with the meaning of its sequence and the roles of its witness items
+type DecodedInput struct {
+	Index    int    `json:"index"`
+	Outpoint string `json:"outpoint"`
+	// SpendType is guessed from the spent output if supplied, otherwise from the scriptSig and the witness
+	SpendType       string         `json:"spend_type"`
+	ScriptSig       string         `json:"script_sig"`
+	Sequence        uint32         `json:"sequence"`
+	SequenceMeaning string         `json:"sequence_meaning"`
+	Witness         []*WitnessItem `json:"witness,omitempty"`
+	Prevout         *DecodedOutput `json:"prevout,omitempty"`
+}
+
+// WitnessItem is a witness stack item labelled by its role in the spend
+type WitnessItem struct {
+	Role string `json:"role"`
+	Hex  string `json:"hex"`
+	// Asm is the disassembly of the witness script or the tapscript leaf
+	Asm string `json:"asm,omitempty"`
+}
+
+// DecodedOutput is an output with its script type and address
+type DecodedOutput struct {
+	Index      int    `json:"index"`
+	Value      int64  `json:"value"`
+	ScriptType string `json:"script_type"`
+	Address    string `json:"address,omitempty"`
+	PkScript   string `json:"pk_script"`
+}
+
+// DecodeTx decodes the raw transaction in hex, the fetcher has the spent outputs to compute the fee,
+// it can be nil or miss some outputs, the addresses are left out if the network is nil
+func DecodeTx(rawTx string, netwk *chaincfg.Params, fetcher txscript.PrevOutputFetcher) (*DecodedTx, error) {
+	raw, err := hex.DecodeString(strings.TrimSpace(rawTx))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTx, err)
+	}
+	tx := new(wire.MsgTx)
+	if err := tx.Deserialize(bytes.NewReader(raw)); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidTx, err)
+	}
+	return decodeMsgTx(tx, netwk, fetcher), nil
+}
+
+func decodeMsgTx(tx *wire.MsgTx, netwk *chaincfg.Params, fetcher txscript.PrevOutputFetcher) *DecodedTx {
+	utx := btcutil.NewTx(tx)
+	decoded := &DecodedTx{
+		Txid:     tx.TxHash().String(),
+		Wtxid:    tx.WitnessHash().String(),
+		Version:  tx.Version,
+		Segwit:   tx.HasWitness(),
+		Size:     tx.SerializeSize(),
+		Weight:   blockchain.GetTransactionWeight(utx),
+		VSize:    mempool.GetTxVirtualSize(utx),
+		LockTime: tx.LockTime,
+	}
+
+	var (
+		inputAmount int64
+		allFinal    = true
+		allPrevouts = fetcher != nil
+	)
+	for i, txin := range tx.TxIn {
+		input := &DecodedInput{
+			Index:     i,
+			Outpoint:  txin.PreviousOutPoint.String(),
+			ScriptSig: disasm(txin.SignatureScript),
+			Sequence:  txin.Sequence,
+		}
+		var replaceable bool
+		replaceable, input.SequenceMeaning = sequenceMeaning(tx.Version, txin.Sequence)
+		decoded.Replaceable = decoded.Replaceable || replaceable
+		allFinal = allFinal && txin.Sequence == wire.MaxTxInSequenceNum
+
+		var pkScript []byte
+		if fetcher != nil {
+			if prevOut := fetcher.FetchPrevOutput(txin.PreviousOutPoint); prevOut != nil {
+				pkScript = prevOut.PkScript
+				inputAmount += prevOut.Value
+				input.Prevout = decodeOutput(int(txin.PreviousOutPoint.Index), prevOut, netwk)
+			} else {
+				allPrevouts = false
+			}
+		}
+		input.SpendType, input.Witness = explainInput(txin, pkScript)
+		decoded.Inputs = append(decoded.Inputs, input)
+	}
+
+	var outputAmount int64
+	for i, txout := range tx.TxOut {
+		outputAmount += txout.Value
+		decoded.Outputs = append(decoded.Outputs, decodeOutput(i, txout, netwk))
+	}
+
+	decoded.LockTimeMeaning = lockTimeMeaning(tx.LockTime, allFinal)
+	if allPrevouts && len(tx.TxIn) > 0 {
+		fee := inputAmount - outputAmount
+		feeRate := float64(fee) / float64(decoded.VSize)
+		decoded.Fee, decoded.FeeRate = &fee, &feeRate
+	}
+	return decoded
+}
+
+func decodeOutput(idx int, txout *wire.TxOut, netwk *chaincfg.Params) *DecodedOutput {
+	info := ClassifyScript(txout.PkScript, netwk)
+	return &DecodedOutput{
+		Index:      idx,
+		Value:      txout.Value,
+		ScriptType: info.ScriptType,
+		Address:    info.Address,
+		PkScript:   info.PkScriptAsm,
+	}
+}
+
+// scriptTypeName names the output script like the spend types of the example package
+func scriptTypeName(pkScript []byte) string {
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyTy:
+		return "p2pk"
+	case txscript.PubKeyHashTy:
+		return "p2pkh"
+	case txscript.ScriptHashTy:
+		return "p2sh"
+	case txscript.WitnessV0PubKeyHashTy:
+		return "p2wpkh"
+	case txscript.WitnessV0ScriptHashTy:
+		return "p2wsh"
+	case txscript.WitnessV1TaprootTy:
+		return "p2tr"
+	case txscript.MultiSigTy:
+		return "multisig"
+	case txscript.NullDataTy:
+		return "nulldata"
+	case txscript.WitnessUnknownTy:
+		return "witness-unknown"
+	default:
+		return "nonstandard"
+	}
+}
+
+// disasm is the one line disassembly of the script, a malformed script ends with [error]
+func disasm(script []byte) string {
+	asm, _ := ScriptToAsm(script)
+	return asm
+}
+
+// sequenceMeaning explains the bip125 signal and the bip68 relative locktime of the sequence
+func sequenceMeaning(version int32, sequence uint32) (bool, string) {
+	var (
+		meanings    []string
+		replaceable = sequence < wire.MaxTxInSequenceNum-1
+	)
+	switch {
+	case sequence == wire.MaxTxInSequenceNum:
+		meanings = append(meanings, "final")
+	case replaceable:
+		meanings = append(meanings, "replaceable (bip125)")
+	default:
+		meanings = append(meanings, "locktime enabled, not replaceable")
+	}
+
+	// bip68 applies to the version 2 transactions only
+	if version >= 2 && sequence&sequenceLockTimeDisabled == 0 {
+		value := sequence & sequenceLockTimeMask
+		if sequence&sequenceLockTimeIsTime != 0 {
+			seconds := value << wire.SequenceLockTimeGranularity
+			meanings = append(meanings, fmt.Sprintf("relative locktime %d seconds (%s)",
+				seconds, time.Duration(seconds)*time.Second))
+		} else {
+			meanings = append(meanings, fmt.Sprintf("relative locktime %d blocks", value))
+		}
+	}
+	return replaceable, strings.Join(meanings, ", ")
+}
+
+// lockTimeMeaning explains the locktime as a block height or a unix time, it's ignored if all the inputs are final
+func lockTimeMeaning(lockTime uint32, allFinal bool) string {
+	var meaning string
+	switch {
+	case lockTime == 0:
+		return "no locktime"
+	case lockTime < lockTimeThreshold:
+		meaning = fmt.Sprintf("block height %d", lockTime)
+	default:
+		meaning = "time " + time.Unix(int64(lockTime), 0).UTC().Format(time.RFC3339)
+	}
+	if allFinal {
+		meaning += " (disabled, all inputs are final)"
+	}
+	return meaning
+}
+
+// explainInput guesses the spend type of the input and labels its witness items,
+// the pkScript of the spent output is optional
+func explainInput(txin *wire.TxIn, pkScript []byte) (string, []*WitnessItem) {
+	witness := txin.Witness
+	pushes, _ := txscript.PushedData(txin.SignatureScript)
+
+	// the witness program of a native output, or the redeem script of p2sh
+	var program []byte
+	nested := false
+	switch {
+	case pkScript != nil && txscript.IsPayToScriptHash(pkScript):
+		nested = true
+		if len(pushes) > 0 {
+			program = pushes[len(pushes)-1]
+		}
+	case pkScript != nil:
+		program = pkScript
+	case len(pushes) == 1 && txscript.IsWitnessProgram(pushes[0]):
+		nested, program = true, pushes[0]
+	}
+
+	if len(witness) == 0 {
+		switch {
+		case pkScript != nil && txscript.IsPayToPubKeyHash(pkScript),
+			pkScript == nil && len(pushes) == 2 && isPubKey(pushes[1]):
+			return "p2pkh", nil
+		case pkScript == nil && len(pushes) == 1 && isDERSignature(pushes[0]):
+			return "p2pk", nil
+		case nested || pkScript == nil && len(pushes) > 0:
+			if len(pushes) > 0 && isMultiSigScript(pushes[len(pushes)-1]) {
+				return "p2sh-multisig", nil
+			}
+			return "p2sh", nil
+		case pkScript != nil:
+			return scriptTypeName(pkScript), nil
+		default:
+			return "unknown", nil
+		}
+	}
+
+	prefix := ""
+	if nested {
+		prefix = "p2sh-"
+	}
+	switch {
+	case txscript.IsPayToWitnessPubKeyHash(program),
+		program == nil && len(witness) == 2 && isPubKey(witness[1]):
+		items := make([]*WitnessItem, 0, len(witness))
+		for _, item := range witness {
+			items = append(items, &WitnessItem{Role: itemRole(item), Hex: hex.EncodeToString(item)})
+		}
+		return prefix + "p2wpkh", items
+	case txscript.IsPayToTaproot(program),
+		program == nil && isTaprootWitness(witness):
+		return explainTaprootWitness(witness)
+	default:
+		spendType, items := explainWitnessScript(witness)
+		return prefix + spendType, items
+	}
+}
+
+// explainWitnessScript labels the witness of p2wsh, the last item is the witness script
+func explainWitnessScript(witness wire.TxWitness) (string, []*WitnessItem) {
+	witnessScript := witness[len(witness)-1]
+	stack := witness[:len(witness)-1]
+	items := make([]*WitnessItem, 0, len(witness))
+
+	spendType := "p2wsh"
+	switch {
+	case isMultiSigScript(witnessScript):
+		spendType = "p2wsh-multisig"
+	case isBip112Script(witnessScript):
+		// the timelock branch is unlocked by a signature, the multisig branch by the dummy and two signatures
+		spendType = "bip112-multisig"
+		if len(stack) == 2 {
+			spendType = "bip112-timelock"
+		}
+	}
+
+	for i, item := range stack {
+		role := itemRole(item)
+		switch {
+		case i == 0 && len(item) == 0 && (spendType == "p2wsh-multisig" || spendType == "bip112-multisig"):
+			role = "dummy (OP_CHECKMULTISIG bug)"
+		case i == len(stack)-1 && len(witnessScript) > 0 && witnessScript[0] == txscript.OP_HASH160:
+			role = "preimage"
+		}
+		items = append(items, &WitnessItem{Role: role, Hex: hex.EncodeToString(item)})
+	}
+	items = append(items, &WitnessItem{
+		Role: "witness script",
+		Hex:  hex.EncodeToString(witnessScript),
+		Asm:  disasm(witnessScript),
+	})
+	return spendType, items
+}
+
+// explainTaprootWitness labels the key path signature, or the leaf inputs, the leaf and the control block
+// of the script path, the annex starting with 0x50 is the last item if any
+func explainTaprootWitness(witness wire.TxWitness) (string, []*WitnessItem) {
+	var annex []byte
+	if len(witness) > 1 && len(witness[len(witness)-1]) > 0 && witness[len(witness)-1][0] == txscript.TaprootAnnexTag {
+		annex, witness = witness[len(witness)-1], witness[:len(witness)-1]
+	}
+
+	var (
+		spendType string
+		items     []*WitnessItem
+	)
+	if len(witness) == 1 {
+		// musig2 is a key path spend too, the aggregate signature can't be told from a single one
+		spendType = "p2tr-keypath"
+		items = []*WitnessItem{{
+			Role: "schnorr signature (" + sigHashName(witness[0], true) + ")",
+			Hex:  hex.EncodeToString(witness[0]),
+		}}
+	} else {
+		spendType = "p2tr-scriptpath"
+		leaf, controlBlock := witness[len(witness)-2], witness[len(witness)-1]
+		for _, item := range witness[:len(witness)-2] {
+			role := "data"
+			switch {
+			case len(item) == 0:
+				role = "empty signature"
+			case len(item) == schnorrSigSize || len(item) == schnorrSigSize+1:
+				role = "schnorr signature (" + sigHashName(item, true) + ")"
+			}
+			items = append(items, &WitnessItem{Role: role, Hex: hex.EncodeToString(item)})
+		}
+
+		leafRole := "tapscript"
+		if _, _, ok := parseTapscriptMulti(leaf); ok {
+			leafRole = "tapscript multi_a"
+		}
+		items = append(items, &WitnessItem{
+			Role: leafRole,
+			Hex:  hex.EncodeToString(leaf),
+			Asm:  disasm(leaf),
+		})
+
+		cbRole := "control block"
+		if cb, err := txscript.ParseControlBlock(controlBlock); err == nil {
+			cbRole = fmt.Sprintf("control block (leaf version %#x, internal key %x, depth %d)",
+				uint8(cb.LeafVersion), cb.InternalKey.SerializeCompressed()[1:],
+				len(cb.InclusionProof)/txscript.ControlBlockNodeSize)
+		}
+		items = append(items, &WitnessItem{Role: cbRole, Hex: hex.EncodeToString(controlBlock)})
+	}
+
+	if annex != nil {
+		items = append(items, &WitnessItem{Role: "annex", Hex: hex.EncodeToString(annex)})
+	}
+	return spendType, items
+}
+
+// the size of a schnorr signature with the default sighash
+const schnorrSigSize = 64
+
+// isTaprootWitness guesses a taproot spend without the spent output,
+// a single schnorr signature or a control block as the last item
+func isTaprootWitness(witness wire.TxWitness) bool {
+	if len(witness) > 1 && len(witness[len(witness)-1]) > 0 && witness[len(witness)-1][0] == txscript.TaprootAnnexTag {
+		witness = witness[:len(witness)-1]
+	}
+	if len(witness) == 1 {
+		return len(witness[0]) == schnorrSigSize || len(witness[0]) == schnorrSigSize+1
+	}
+	_, err := txscript.ParseControlBlock(witness[len(witness)-1])
+	return len(witness) > 1 && err == nil
+}
+
+// isBip112Script matches the script of CreateBip112P2wsh, the preimage selects the timelock or the multisig branch
+func isBip112Script(script []byte) bool {
+	return len(script) > 2 && script[0] == txscript.OP_HASH160 && script[1] == txscript.OP_DUP &&
+		bytes.Contains(script, []byte{txscript.OP_CHECKSEQUENCEVERIFY}) &&
+		bytes.Contains(script, []byte{txscript.OP_CHECKMULTISIG})
+}
+
+func isPubKey(data []byte) bool {
+	return len(data) == 33 && (data[0] == 0x02 || data[0] == 0x03) || len(data) == 65 && data[0] == 0x04
+}
+
+// itemRole guesses the role of a stack item by its shape
+func itemRole(item []byte) string {
+	switch {
+	case len(item) == 0:
+		return "empty"
+	case isPubKey(item):
+		return "pubkey"
+	case isDERSignature(item):
+		return "signature (" + sigHashName(item, false) + ")"
+	default:
+		return "data"
+	}
+}
+
+// isDERSignature checks the ecdsa signature followed by the sighash byte
+func isDERSignature(item []byte) bool {
+	if len(item) < 9 {
+		return false
+	}
+	_, err := ecdsa.ParseDERSignature(item[:len(item)-1])
+	return err == nil
+}
+
+// sigHashName names the sighash type at the end of the signature, a schnorr signature of 64 bytes is SIGHASH_DEFAULT
+func sigHashName(sig []byte, schnorr bool) string {
+	if schnorr && len(sig) == schnorrSigSize {
+		return "SIGHASH_DEFAULT"
+	}
+	if len(sig) == 0 {
+		return "no sighash"
+	}
+
+	hashType := txscript.SigHashType(sig[len(sig)-1])
+	var name string
+	switch hashType & sigHashMask {
+	case txscript.SigHashAll:
+		name = "SIGHASH_ALL"
+	case txscript.SigHashNone:
+		name = "SIGHASH_NONE"
+	case txscript.SigHashSingle:
+		name = "SIGHASH_SINGLE"
+	default:
+		return fmt.Sprintf("unknown sighash %#x", uint8(hashType))
+	}
+	if hashType&txscript.SigHashAnyOneCanPay != 0 {
+		name += "|ANYONECANPAY"
+	}
+	return name
+}
+
+// sigHashMask is the base sighash type without ANYONECANPAY
+const sigHashMask = 0x1f
+
+// String renders the decoded transaction as text
+func (d *DecodedTx) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "txid: %s\n", d.Txid)
+	fmt.Fprintf(&buf, "wtxid: %s\n", d.Wtxid)
+	fmt.Fprintf(&buf, "version: %d\n", d.Version)
+	if d.Segwit {
+		buf.WriteString("marker: 0x00, flag: 0x01 (segwit)\n")
+	}
+	fmt.Fprintf(&buf, "size: %d bytes, weight: %d wu, vsize: %d vbytes\n", d.Size, d.Weight, d.VSize)
+	fmt.Fprintf(&buf, "replaceable: %t\n", d.Replaceable)
+
+	fmt.Fprintf(&buf, "inputs: %d\n", len(d.Inputs))
+	for _, input := range d.Inputs {
+		fmt.Fprintf(&buf, "  #%d %s %s\n", input.Index, input.Outpoint, input.SpendType)
+		fmt.Fprintf(&buf, "     sequence: %#08x (%s)\n", input.Sequence, input.SequenceMeaning)
+		if input.ScriptSig != "" {
+			fmt.Fprintf(&buf, "     scriptSig: %s\n", input.ScriptSig)
+		}
+		if len(input.Witness) > 0 {
+			buf.WriteString("     witness:\n")
+			for _, item := range input.Witness {
+				fmt.Fprintf(&buf, "       %s: %s\n", item.Role, item.Hex)
+				if item.Asm != "" {
+					fmt.Fprintf(&buf, "         asm: %s\n", item.Asm)
+				}
+			}
+		}
+		if prevout := input.Prevout; prevout != nil {
+			fmt.Fprintf(&buf, "     prevout: %s %s %s\n", btcutil.Amount(prevout.Value), prevout.ScriptType, prevout.Address)
+		}
+	}
+
+	fmt.Fprintf(&buf, "outputs: %d\n", len(d.Outputs))
+	for _, output := range d.Outputs {
+		fmt.Fprintf(&buf, "  #%d %s %s %s\n", output.Index, btcutil.Amount(output.Value), output.ScriptType, output.Address)
+		fmt.Fprintf(&buf, "     pkScript: %s\n", output.PkScript)
+	}
+
+	fmt.Fprintf(&buf, "locktime: %d (%s)\n", d.LockTime, d.LockTimeMeaning)
+	if d.Fee != nil {
+		fmt.Fprintf(&buf, "fee: %d satoshis (%.2f sat/vB)\n", *d.Fee, *d.FeeRate)
+	}
+	return buf.String()
+}
+
+// JSON renders the decoded transaction as indented JSON
+func (d *DecodedTx) JSON() ([]byte, error) {
+	return json.MarshalIndent(d, "", "  ")
+}
@@ -0,0 +1,132 @@
+package example
+
+import (
+	"encoding/json"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+)
+
+func TestDecodeTx(t *testing.T) {
+	utxos := testUTXOs(t, 30000, 40000, 50000)
+	builder := &TxBuilder{
+		Inputs:        utxos,
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 60000}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	decoded, err := DecodeTx(txHex(t, tx), testNet, prevOutFetcher(utxos))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Txid != tx.TxHash().String() || decoded.Wtxid != tx.WitnessHash().String() || !decoded.Segwit {
+		t.Errorf("txid %s, wtxid %s, segwit %t", decoded.Txid, decoded.Wtxid, decoded.Segwit)
+	}
+	if vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx)); decoded.VSize != vsize {
+		t.Errorf("vsize %d, want %d", decoded.VSize, vsize)
+	}
+	fee := int64(30000 + 40000 + 50000)
+	for _, txout := range tx.TxOut {
+		fee -= txout.Value
+	}
+	if decoded.Fee == nil || *decoded.Fee != fee || decoded.Replaceable {
+		t.Errorf("fee %v, want %d, replaceable %t", decoded.Fee, fee, decoded.Replaceable)
+	}
+
+	var spendTypes []string
+	for _, input := range decoded.Inputs {
+		spendTypes = append(spendTypes, input.SpendType)
+	}
+	if !slices.Equal(spendTypes, []string{"p2pkh", "p2wpkh", "p2tr-keypath"}) {
+		t.Errorf("spend types %v", spendTypes)
+	}
+	if witness := decoded.Inputs[1].Witness; len(witness) != 2 ||
+		!strings.HasPrefix(witness[0].Role, "signature") || witness[1].Role != "pubkey" {
+		t.Errorf("p2wpkh witness %+v", witness)
+	}
+	for idx, address := range []string{testAddress(t, 2).String(), testAddress(t, 1).String()} {
+		if output := decoded.Outputs[idx]; output.ScriptType != "p2wpkh" || output.Address != address {
+			t.Errorf("output %d: %s %s, want %s", idx, output.ScriptType, output.Address, address)
+		}
+	}
+
+	data, err := decoded.JSON()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back DecodedTx
+	if err := json.Unmarshal(data, &back); err != nil || back.Txid != decoded.Txid {
+		t.Errorf("json %s: %v", data, err)
+	}
+}
+
+func TestDecodeTxWithoutPrevouts(t *testing.T) {
+	tx, err := CreateBip112P2wsh(testNet, testKey(1), testKey(2), testPool(100000), 50000, 2,
+		10, true, []byte("timelock"), []byte("multisig"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the relative locktime of the sequence signals bip125 too
+	decoded, err := DecodeTx(txHex(t, tx), testNet, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Fee != nil || decoded.FeeRate != nil || !decoded.Replaceable {
+		t.Errorf("fee %v, replaceable %t", decoded.Fee, decoded.Replaceable)
+	}
+	if input := decoded.Inputs[0]; input.Prevout != nil || len(input.Witness) != 3 {
+		t.Errorf("input %+v", input)
+	}
+
+	if _, err := DecodeTx("0200", testNet, nil); err == nil {
+		t.Error("decoded a truncated tx")
+	}
+}
+
+func TestDecodeTxNetwork(t *testing.T) {
+	tx, err := Pay2WitnessPubkeyHashAddr(testNet, testKey(1), testPool(60000), 30000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := spendFrom(testPool(60000), UTXO{PkScript: tx.TxOut[0].PkScript})
+
+	decoded, err := DecodeTx(txHex(t, tx), testNet, prevOutFetcher(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded.Fee == nil || *decoded.Fee <= 0 {
+		t.Fatalf("fee %v", decoded.Fee)
+	}
+	for _, output := range decoded.Outputs {
+		if output.ScriptType != "p2wpkh" || !strings.HasPrefix(output.Address, "bcrt1q") {
+			t.Errorf("output %d: %s %q", output.Index, output.ScriptType, output.Address)
+		}
+	}
+
+	// without the network the addresses are left out
+	decoded, err = DecodeTx(txHex(t, tx), nil, prevOutFetcher(pool))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, output := range decoded.Outputs {
+		if output.ScriptType != "p2wpkh" || output.Address != "" {
+			t.Errorf("output %d: %s %q", output.Index, output.ScriptType, output.Address)
+		}
+	}
+	if prevout := decoded.Inputs[0].Prevout; prevout == nil || prevout.Address != "" {
+		t.Errorf("prevout %+v", prevout)
+	}
+
+	if _, err := DecodeTx("zz", nil, nil); err == nil {
+		t.Error("decoded a bad hex")
+	}
+}
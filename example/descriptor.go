@@ -0,0 +1,836 @@
+package example
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki#checksum
+const (
+	descInputCharset    = "0123456789()[],'/*abcdefgh@:$%{}IJKLMNOPQRSTUVWXYZ&+-.;<=>?!^_|~ijklmnopqrstuvwxyzABCDEFGH`#\"\\ "
+	descChecksumCharset = "qpzry9x8gf2tvdw0s3jn54khce6mua7l"
+	descChecksumLen     = 8
+)
+
+var descGenerator = [5]uint64{0xf5dee51989, 0xa9fdca3312, 0x1bab10e32d, 0x3706b1677a, 0x644d626ffd}
+
+func descPolymod(symbols []uint64) uint64 {
+	chk := uint64(1)
+	for _, value := range symbols {
+		top := chk >> 35
+		chk = (chk&0x7ffffffff)<<5 ^ value
+		for i, generator := range descGenerator {
+			if top>>i&1 == 1 {
+				chk ^= generator
+			}
+		}
+	}
+	return chk
+}
+
+// DescriptorChecksum computes the 8 characters checksum of a descriptor without the checksum,
+// it's the one after the '#' of Bitcoin Core's getdescriptorinfo
+func DescriptorChecksum(desc string) (string, error) {
+	var symbols, groups []uint64
+	for _, c := range desc {
+		v := strings.IndexRune(descInputCharset, c)
+		if v < 0 {
+			return "", fmt.Errorf("%w: invalid character %q", ErrInvalidDescriptor, c)
+		}
+		symbols = append(symbols, uint64(v&31))
+		groups = append(groups, uint64(v>>5))
+		if len(groups) == 3 {
+			symbols = append(symbols, groups[0]*9+groups[1]*3+groups[2])
+			groups = groups[:0]
+		}
+	}
+	switch len(groups) {
+	case 1:
+		symbols = append(symbols, groups[0])
+	case 2:
+		symbols = append(symbols, groups[0]*3+groups[1])
+	}
+
+	checksum := descPolymod(append(symbols, make([]uint64, descChecksumLen)...)) ^ 1
+	var sb strings.Builder
+	for i := range descChecksumLen {
+		sb.WriteByte(descChecksumCharset[checksum>>(5*(7-i))&31])
+	}
+	return sb.String(), nil
+}
+
+// descContext is where a script expression is, it decides the allowed expressions and keys
+type descContext uint8
+
+const (
+	descTop descContext = iota
+	descP2SH
+	descP2WSH
+	descTapscript
+)
+
+const (
+	// the redeem script is at most 520 bytes, it fits 15 compressed pubkeys
+	maxP2SHMultiSigKeys = 15
+	// bare multisig is only standard up to 3 pubkeys
+	maxBareMultiSigKeys = 3
+	// multi_a is limited by the 999 stack items of tapscript
+	maxMultiAKeys = 999
+)
+
+// Descriptor is an output script descriptor of BIP380 to BIP386
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0380.mediawiki
+type Descriptor struct {
+	desc  string
+	netwk *chaincfg.Params
+	expr  *descExpr
+}
+
+// descExpr is a script expression, like pkh(KEY) or wsh(SCRIPT)
+type descExpr struct {
+	name      string
+	keys      []*descKey
+	threshold int
+	// the script of sh and wsh
+	sub *descExpr
+	// the script tree of tr, nil for key path only
+	tree    *descTree
+	address btcutil.Address
+	raw     []byte
+	// the miniscript of wsh and the tapscript leaves
+	ms *msNode
+}
+
+// descTree is either a leaf or a branch of the taproot script tree
+type descTree struct {
+	leaf        *descExpr
+	left, right *descTree
+}
+
+// descKey is a key expression, a hex pubkey, a WIF or an extended key with the derivation steps
+type descKey struct {
+	// raw is the key expression as it's written
+	raw string
+
+	// the origin in [fingerprint/path]
+	hasOrigin   bool
+	fingerprint uint32
+	originPath  []uint32
+
+	pubkey       *btcec.PublicKey
+	uncompressed bool
+
+	extkey *hdkeychain.ExtendedKey
+	steps  []uint32
+	// the last step is * or *' with the index of Expand
+	wildcard         bool
+	hardenedWildcard bool
+}
+
+// ParseDescriptor parses the descriptor and verifies the checksum if there is one,
+// the keys and the addresses must belong to the network
+func ParseDescriptor(desc string, netwk *chaincfg.Params) (*Descriptor, error) {
+	body, checksum, hasChecksum := strings.Cut(desc, "#")
+	want, err := DescriptorChecksum(body)
+	if err != nil {
+		return nil, err
+	}
+	if hasChecksum && checksum != want {
+		return nil, fmt.Errorf("%w: checksum %q, want %q", ErrInvalidDescriptor, checksum, want)
+	}
+
+	expr, err := parseDescExpr(body, descTop, netwk)
+	if err != nil {
+		return nil, err
+	}
+	return &Descriptor{desc: body, netwk: netwk, expr: expr}, nil
+}
+
+// String returns the descriptor with its checksum
+func (d *Descriptor) String() string {
+	checksum, _ := DescriptorChecksum(d.desc)
+	return d.desc + "#" + checksum
+}
+
+// IsRange reports whether the descriptor has a wildcard key
+func (d *Descriptor) IsRange() bool {
+	return d.expr.isRange()
+}
+
+func (e *descExpr) isRange() bool {
+	if slices.ContainsFunc(e.keys, func(key *descKey) bool { return key.wildcard }) {
+		return true
+	}
+	if e.ms != nil && e.ms.hasWildcard() {
+		return true
+	}
+	if e.sub != nil && e.sub.isRange() {
+		return true
+	}
+	return e.tree != nil && e.tree.isRange()
+}
+
+func (t *descTree) isRange() bool {
+	if t.leaf != nil {
+		return t.leaf.isRange()
+	}
+	return t.left.isRange() || t.right.isRange()
+}
+
+// splitDescCall splits `name(args)` into the name and the arguments at the top level
+func splitDescCall(s string) (string, []string, error) {
+	open := strings.IndexByte(s, '(')
+	if open <= 0 || !strings.HasSuffix(s, ")") {
+		return "", nil, fmt.Errorf("%w: %q is not a script expression", ErrInvalidDescriptor, s)
+	}
+	args, err := splitDescArgs(s[open+1 : len(s)-1])
+	if err != nil {
+		return "", nil, err
+	}
+	return s[:open], args, nil
+}
+
+// splitDescArgs splits by the commas out of any brackets
+func splitDescArgs(s string) ([]string, error) {
+	var args []string
+	depth, start := 0, 0
+	for i := range len(s) {
+		switch s[i] {
+		case '(', '[', '{':
+			depth++
+		case ')', ']', '}':
+			depth--
+			if depth < 0 {
+				return nil, fmt.Errorf("%w: unbalanced %q", ErrInvalidDescriptor, s)
+			}
+		case ',':
+			if depth == 0 {
+				args = append(args, s[start:i])
+				start = i + 1
+			}
+		}
+	}
+	if depth != 0 {
+		return nil, fmt.Errorf("%w: unbalanced %q", ErrInvalidDescriptor, s)
+	}
+	return append(args, s[start:]), nil
+}
+
+func parseDescExpr(s string, ctx descContext, netwk *chaincfg.Params) (*descExpr, error) {
+	allowed := map[descContext][]string{
+		descTop:       {"pk", "pkh", "wpkh", "sh", "wsh", "tr", "multi", "sortedmulti", "addr", "raw"},
+		descP2SH:      {"pk", "pkh", "wpkh", "wsh", "multi", "sortedmulti"},
+		descP2WSH:     {"pk", "pkh", "multi", "sortedmulti"},
+		descTapscript: {"pk", "pkh", "multi_a", "sortedmulti_a"},
+	}
+
+	// the other scripts of wsh and the tapscript leaves are miniscript
+	name, _, _ := strings.Cut(s, "(")
+	if (ctx == descP2WSH || ctx == descTapscript) && !slices.Contains(allowed[ctx], name) {
+		node, err := parseMiniscript(s, ctx, netwk)
+		if err != nil {
+			return nil, err
+		}
+		return &descExpr{name: "miniscript", ms: node}, nil
+	}
+
+	name, args, err := splitDescCall(s)
+	if err != nil {
+		return nil, err
+	}
+	expr := &descExpr{name: name}
+	if !slices.Contains(allowed[ctx], name) {
+		return nil, fmt.Errorf("%w: %s() is not allowed here", ErrInvalidDescriptor, name)
+	}
+
+	switch name {
+	case "pk", "pkh", "wpkh":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s() takes one key", ErrInvalidDescriptor, name)
+		}
+		keyCtx := ctx
+		if name == "wpkh" {
+			keyCtx = descP2WSH
+		}
+		key, err := parseDescKey(args[0], keyCtx, netwk)
+		if err != nil {
+			return nil, err
+		}
+		expr.keys = []*descKey{key}
+	case "sh", "wsh":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s() takes one script", ErrInvalidDescriptor, name)
+		}
+		subCtx := descP2SH
+		if name == "wsh" {
+			subCtx = descP2WSH
+		}
+		if expr.sub, err = parseDescExpr(args[0], subCtx, netwk); err != nil {
+			return nil, err
+		}
+		// the signer has no spend type of the miniscript nested in p2sh-p2wsh
+		if name == "sh" && expr.sub.name == "wsh" && expr.sub.sub.ms != nil {
+			return nil, fmt.Errorf("%w: sh(wsh()) of miniscript isn't supported, use wsh()", ErrInvalidDescriptor)
+		}
+	case "multi", "sortedmulti", "multi_a", "sortedmulti_a":
+		if err := parseDescMulti(expr, args, ctx, netwk); err != nil {
+			return nil, err
+		}
+	case "tr":
+		if len(args) != 1 && len(args) != 2 {
+			return nil, fmt.Errorf("%w: tr() takes a key and an optional tree", ErrInvalidDescriptor)
+		}
+		key, err := parseDescKey(args[0], descTapscript, netwk)
+		if err != nil {
+			return nil, err
+		}
+		expr.keys = []*descKey{key}
+		if len(args) == 2 {
+			if expr.tree, err = parseDescTree(args[1], netwk); err != nil {
+				return nil, err
+			}
+		}
+	case "addr":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: addr() takes one address", ErrInvalidDescriptor)
+		}
+		address, err := btcutil.DecodeAddress(args[0], netwk)
+		if err != nil || !address.IsForNet(netwk) {
+			return nil, fmt.Errorf("%w: %q is not an address of %s", ErrInvalidAddress, args[0], netwk.Name)
+		}
+		expr.address = address
+	case "raw":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: raw() takes one script", ErrInvalidDescriptor)
+		}
+		if expr.raw, err = hex.DecodeString(args[0]); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidDescriptor, err)
+		}
+	}
+	return expr, nil
+}
+
+func parseDescMulti(expr *descExpr, args []string, ctx descContext, netwk *chaincfg.Params) error {
+	if len(args) < 2 {
+		return fmt.Errorf("%w: %s() takes a threshold and keys", ErrInvalidDescriptor, expr.name)
+	}
+	threshold, err := strconv.Atoi(args[0])
+	if err != nil {
+		return fmt.Errorf("%w: threshold %q", ErrInvalidDescriptor, args[0])
+	}
+
+	limit := txscript.MaxPubKeysPerMultiSig
+	switch ctx {
+	case descTop:
+		limit = maxBareMultiSigKeys
+	case descP2SH:
+		limit = maxP2SHMultiSigKeys
+	case descTapscript:
+		limit = maxMultiAKeys
+	}
+	n := len(args) - 1
+	if threshold < 1 || threshold > n || n > limit {
+		return fmt.Errorf("%w: %s() of %d-of-%d, at most %d keys", ErrInvalidDescriptor, expr.name, threshold, n, limit)
+	}
+
+	for _, arg := range args[1:] {
+		key, err := parseDescKey(arg, ctx, netwk)
+		if err != nil {
+			return err
+		}
+		expr.keys = append(expr.keys, key)
+	}
+	expr.threshold = threshold
+	return nil
+}
+
+// parseDescTree parses `SCRIPT` or `{TREE,TREE}`
+func parseDescTree(s string, netwk *chaincfg.Params) (*descTree, error) {
+	if !strings.HasPrefix(s, "{") {
+		leaf, err := parseDescExpr(s, descTapscript, netwk)
+		if err != nil {
+			return nil, err
+		}
+		return &descTree{leaf: leaf}, nil
+	}
+
+	if !strings.HasSuffix(s, "}") {
+		return nil, fmt.Errorf("%w: unbalanced %q", ErrInvalidDescriptor, s)
+	}
+	branches, err := splitDescArgs(s[1 : len(s)-1])
+	if err != nil {
+		return nil, err
+	}
+	if len(branches) != 2 {
+		return nil, fmt.Errorf("%w: a branch has two children, got %d", ErrInvalidDescriptor, len(branches))
+	}
+	left, err := parseDescTree(branches[0], netwk)
+	if err != nil {
+		return nil, err
+	}
+	right, err := parseDescTree(branches[1], netwk)
+	if err != nil {
+		return nil, err
+	}
+	return &descTree{left: left, right: right}, nil
+}
+
+// parseDescKey parses `[fingerprint/path]KEY`, the KEY is a hex pubkey, a WIF or `xpub/path/*`
+func parseDescKey(s string, ctx descContext, netwk *chaincfg.Params) (*descKey, error) {
+	key := &descKey{raw: s}
+	if strings.HasPrefix(s, "[") {
+		end := strings.IndexByte(s, ']')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unbalanced %q", ErrInvalidDescriptor, s)
+		}
+		fingerprintHex, path, _ := strings.Cut(s[1:end], "/")
+		fingerprint, err := hex.DecodeString(fingerprintHex)
+		if err != nil || len(fingerprint) != 4 {
+			return nil, fmt.Errorf("%w: fingerprint %q", ErrInvalidDescriptor, fingerprintHex)
+		}
+		key.hasOrigin = true
+		key.fingerprint = binary.LittleEndian.Uint32(fingerprint)
+		if path != "" {
+			if key.originPath, err = ParseDerivationPath(path); err != nil {
+				return nil, err
+			}
+		}
+		s = s[end+1:]
+	}
+
+	elems := strings.Split(s, "/")
+	switch {
+	case len(elems) > 1 || strings.HasPrefix(s, "xp") || strings.HasPrefix(s, "tp"):
+		extkey, err := ParseExtendedKey(elems[0], netwk)
+		if err != nil {
+			return nil, err
+		}
+		key.extkey = extkey
+
+		steps := elems[1:]
+		if len(steps) > 0 {
+			switch steps[len(steps)-1] {
+			case "*":
+				key.wildcard = true
+			case "*'", "*h":
+				key.wildcard, key.hardenedWildcard = true, true
+			}
+			if key.wildcard {
+				steps = steps[:len(steps)-1]
+			}
+		}
+		if len(steps) > 0 {
+			if key.steps, err = ParseDerivationPath(strings.Join(steps, "/")); err != nil {
+				return nil, err
+			}
+		}
+		return key, nil
+	case len(s) == 2*xonlyPubKeySize:
+		if ctx != descTapscript {
+			return nil, fmt.Errorf("%w: x-only key out of tr()", ErrInvalidDescriptor)
+		}
+		raw, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		if key.pubkey, err = schnorr.ParsePubKey(raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+	case len(s) == 2*compressedPubKeySize || len(s) == 2*uncompressedPubKeySize:
+		raw, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		if key.pubkey, err = btcec.ParsePubKey(raw); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		key.uncompressed = len(raw) == uncompressedPubKeySize
+	default:
+		wif, err := DecodeWIF(s, netwk)
+		if err != nil {
+			return nil, err
+		}
+		key.pubkey = wif.PrivKey.PubKey()
+		key.uncompressed = !wif.CompressPubKey
+	}
+
+	// segwit and tapscript only accept compressed keys
+	if key.uncompressed && (ctx == descP2WSH || ctx == descTapscript) {
+		return nil, fmt.Errorf("%w: uncompressed key in segwit", ErrInvalidDescriptor)
+	}
+	return key, nil
+}
+
+// derive returns the pubkey at the index of the wildcard with its origin
+func (k *descKey) derive(index uint32) (*btcec.PublicKey, *KeyOrigin, error) {
+	origin := &KeyOrigin{Fingerprint: k.fingerprint, Path: slices.Clone(k.originPath)}
+	if k.extkey == nil {
+		if !k.hasOrigin {
+			origin.Fingerprint = pubkeyFingerprint(k.pubkey)
+		}
+		origin.PubKey = k.pubkey
+		return k.pubkey, origin, nil
+	}
+
+	steps := slices.Clone(k.steps)
+	if k.wildcard {
+		if index >= hdkeychain.HardenedKeyStart {
+			return nil, nil, fmt.Errorf("%w: index %d out of range", ErrInvalidDescriptor, index)
+		}
+		if k.hardenedWildcard {
+			index += hdkeychain.HardenedKeyStart
+		}
+		steps = append(steps, index)
+	}
+	child, err := DeriveKey(k.extkey, steps)
+	if err != nil {
+		return nil, nil, err
+	}
+	pubkey, err := child.ECPubKey()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	if !k.hasOrigin {
+		if origin.Fingerprint, err = Fingerprint(k.extkey); err != nil {
+			return nil, nil, err
+		}
+	}
+	origin.PubKey = pubkey
+	origin.Path = append(origin.Path, steps...)
+	return pubkey, origin, nil
+}
+
+// DescriptorTapLeaf is a leaf of the taproot script tree with its control block
+type DescriptorTapLeaf struct {
+	Script       []byte
+	ControlBlock []byte
+	// Miniscript is the leaf if it's written in miniscript
+	Miniscript *Miniscript
+}
+
+// DescriptorOutput is the output script of the descriptor at an index,
+// with the scripts and the origins to spend it
+type DescriptorOutput struct {
+	PkScript []byte
+	// Address is nil for the scripts without address, like the bare multisig
+	Address btcutil.Address
+	// SpendType is zero if the builders can't sign the output
+	SpendType SpendType
+
+	RedeemScript  []byte
+	WitnessScript []byte
+	// Miniscript is the witness script of wsh if it's written in miniscript
+	Miniscript *Miniscript
+
+	TapInternalKey *btcec.PublicKey
+	TapMerkleRoot  []byte
+	// TapTree is the script tree as it's written, nil for the key path only outputs
+	TapTree   *TapTree
+	TapLeaves []*DescriptorTapLeaf
+
+	Origins []*KeyOrigin
+}
+
+// Expand derives the output at the index, the index is ignored by the descriptors without wildcard
+func (d *Descriptor) Expand(index uint32) (*DescriptorOutput, error) {
+	out := new(DescriptorOutput)
+	expr := d.expr
+
+	var err error
+	switch expr.name {
+	case "sh":
+		if out.RedeemScript, err = expr.sub.script(index, descP2SH, out); err != nil {
+			return nil, err
+		}
+		switch {
+		case expr.sub.name == "wpkh":
+			out.SpendType = SpendP2SHP2WPKH
+		case expr.sub.name == "wsh" && spendTypeOfWitnessScript(out.WitnessScript) == SpendP2WSHMultiSig:
+			out.SpendType = SpendP2SHP2WSHMultiSig
+		case isMultiSigScript(out.RedeemScript):
+			out.SpendType = SpendP2SHMultiSig
+		}
+		out.Address, err = btcutil.NewAddressScriptHash(out.RedeemScript, d.netwk)
+	case "wsh":
+		if out.WitnessScript, err = expr.sub.script(index, descP2WSH, out); err != nil {
+			return nil, err
+		}
+		out.SpendType = spendTypeOfWitnessScript(out.WitnessScript)
+		if expr.sub.ms != nil {
+			out.SpendType = SpendMiniscript
+			out.Miniscript = &Miniscript{node: expr.sub.ms, index: index}
+		}
+		witnessProg := sha256.Sum256(out.WitnessScript)
+		out.Address, err = btcutil.NewAddressWitnessScriptHash(witnessProg[:], d.netwk)
+	case "tr":
+		if err := d.expandTaproot(index, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case "addr":
+		out.Address = expr.address
+	case "raw", "pk", "multi", "sortedmulti":
+		if out.PkScript, err = expr.script(index, descTop, out); err != nil {
+			return nil, err
+		}
+		return out, nil
+	case "pkh":
+		if out.PkScript, err = expr.script(index, descTop, out); err != nil {
+			return nil, err
+		}
+		out.SpendType = SpendP2PKH
+		out.Address, err = btcutil.NewAddressPubKeyHash(out.PkScript[3:23], d.netwk)
+	case "wpkh":
+		if out.PkScript, err = expr.script(index, descTop, out); err != nil {
+			return nil, err
+		}
+		out.SpendType = SpendP2WPKH
+		out.Address, err = btcutil.NewAddressWitnessPubKeyHash(out.PkScript[2:], d.netwk)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	if out.PkScript, err = txscript.PayToAddrScript(out.Address); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return out, nil
+}
+
+// ExpandRange derives the outputs from the index start to end, end is excluded
+func (d *Descriptor) ExpandRange(start, end uint32) ([]*DescriptorOutput, error) {
+	outs := make([]*DescriptorOutput, 0, end-start)
+	for index := start; index < end; index++ {
+		out, err := d.Expand(index)
+		if err != nil {
+			return nil, err
+		}
+		outs = append(outs, out)
+	}
+	return outs, nil
+}
+
+func spendTypeOfWitnessScript(witnessScript []byte) SpendType {
+	if isMultiSigScript(witnessScript) {
+		return SpendP2WSHMultiSig
+	}
+	return 0
+}
+
+// script returns the script of the expression and collects the origins of the keys
+func (e *descExpr) script(index uint32, ctx descContext, out *DescriptorOutput) ([]byte, error) {
+	pubkeys := make([][]byte, 0, len(e.keys))
+	for _, key := range e.keys {
+		pubkey, origin, err := key.derive(index)
+		if err != nil {
+			return nil, err
+		}
+		out.Origins = append(out.Origins, origin)
+
+		switch {
+		case ctx == descTapscript:
+			pubkeys = append(pubkeys, schnorr.SerializePubKey(pubkey))
+		case key.uncompressed:
+			pubkeys = append(pubkeys, pubkey.SerializeUncompressed())
+		default:
+			pubkeys = append(pubkeys, pubkey.SerializeCompressed())
+		}
+	}
+	if strings.HasPrefix(e.name, "sorted") {
+		slices.SortFunc(pubkeys, bytes.Compare)
+	}
+
+	builder := txscript.NewScriptBuilder()
+	switch e.name {
+	case "pk":
+		builder.AddData(pubkeys[0]).AddOp(txscript.OP_CHECKSIG)
+	case "pkh":
+		builder.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(pubkeys[0])).
+			AddOp(txscript.OP_EQUALVERIFY).AddOp(txscript.OP_CHECKSIG)
+	case "wpkh":
+		builder.AddOp(txscript.OP_0).AddData(btcutil.Hash160(pubkeys[0]))
+	case "multi", "sortedmulti":
+		builder.AddInt64(int64(e.threshold))
+		for _, pubkey := range pubkeys {
+			builder.AddData(pubkey)
+		}
+		builder.AddInt64(int64(len(pubkeys))).AddOp(txscript.OP_CHECKMULTISIG)
+	case "multi_a", "sortedmulti_a":
+		for i, pubkey := range pubkeys {
+			builder.AddData(pubkey)
+			if i == 0 {
+				builder.AddOp(txscript.OP_CHECKSIG)
+			} else {
+				builder.AddOp(txscript.OP_CHECKSIGADD)
+			}
+		}
+		builder.AddInt64(int64(e.threshold)).AddOp(txscript.OP_NUMEQUAL)
+	case "wsh":
+		witnessScript, err := e.sub.script(index, descP2WSH, out)
+		if err != nil {
+			return nil, err
+		}
+		out.WitnessScript = witnessScript
+		witnessProg := sha256.Sum256(witnessScript)
+		builder.AddOp(txscript.OP_0).AddData(witnessProg[:])
+	case "raw":
+		return e.raw, nil
+	case "miniscript":
+		return e.ms.script(ctx, func(key *descKey) ([]byte, error) {
+			pubkey, origin, err := key.derive(index)
+			if err != nil {
+				return nil, err
+			}
+			out.Origins = append(out.Origins, origin)
+			if ctx == descTapscript {
+				return schnorr.SerializePubKey(pubkey), nil
+			}
+			return pubkey.SerializeCompressed(), nil
+		})
+	default:
+		return nil, fmt.Errorf("%w: %s() has no script", ErrInvalidDescriptor, e.name)
+	}
+
+	script, err := builder.Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	if ctx == descP2SH && len(script) > txscript.MaxScriptElementSize {
+		return nil, fmt.Errorf("%w: redeem script of %d bytes", ErrScriptBuild, len(script))
+	}
+	return script, nil
+}
+
+// tapTree builds the tree as it's written, it doesn't rebalance like AssembleTaprootScriptTree.
+// It also returns the miniscript of the leaves from left to right, nil if the leaf isn't miniscript.
+func (t *descTree) tapTree(index uint32, out *DescriptorOutput) (*TapTree, []*msNode, error) {
+	if t.leaf != nil {
+		script, err := t.leaf.script(index, descTapscript, out)
+		if err != nil {
+			return nil, nil, err
+		}
+		leaf := txscript.NewBaseTapLeaf(script)
+		return &TapTree{Leaf: &leaf}, []*msNode{t.leaf.ms}, nil
+	}
+
+	left, leftMs, err := t.left.tapTree(index, out)
+	if err != nil {
+		return nil, nil, err
+	}
+	right, rightMs, err := t.right.tapTree(index, out)
+	if err != nil {
+		return nil, nil, err
+	}
+	return &TapTree{Left: left, Right: right}, append(leftMs, rightMs...), nil
+}
+
+func (d *Descriptor) expandTaproot(index uint32, out *DescriptorOutput) error {
+	internalKey, origin, err := d.expr.keys[0].derive(index)
+	if err != nil {
+		return err
+	}
+	out.Origins = append(out.Origins, origin)
+	out.TapInternalKey = internalKey
+	out.SpendType = SpendP2TRKeyPath
+
+	var (
+		leaves []txscript.TapLeaf
+		leafMs []*msNode
+	)
+	if d.expr.tree != nil {
+		if out.TapTree, leafMs, err = d.expr.tree.tapTree(index, out); err != nil {
+			return err
+		}
+		rootHash := out.TapTree.RootHash()
+		out.TapMerkleRoot = rootHash[:]
+		leaves = out.TapTree.Leaves()
+	}
+
+	outputKey := txscript.ComputeTaprootOutputKey(internalKey, out.TapMerkleRoot)
+	for i, ms := range leafMs {
+		controlBlock, err := out.TapTree.ControlBlock(internalKey, i)
+		if err != nil {
+			return err
+		}
+		controlBlockWitness, err := controlBlock.ToBytes()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		tapLeaf := &DescriptorTapLeaf{
+			Script:       leaves[i].Script,
+			ControlBlock: controlBlockWitness,
+		}
+		if ms != nil {
+			tapLeaf.Miniscript = &Miniscript{node: ms, tapscript: true, index: index}
+		}
+		out.TapLeaves = append(out.TapLeaves, tapLeaf)
+	}
+
+	if out.Address, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), d.netwk); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	if out.PkScript, err = txscript.PayToAddrScript(out.Address); err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return nil
+}
+
+// UTXO returns the utxo of the output for the TxBuilder without keys, it's signed by SignPsbt.
+// Taproot is spent by the key path, the legacy outputs need the PrevTx for the psbt.
+func (o *DescriptorOutput) UTXO(outpoint wire.OutPoint, amount int64) (*UTXO, error) {
+	if o.SpendType == 0 {
+		return nil, fmt.Errorf("%w: the builders can't spend %x", ErrInvalidDescriptor, o.PkScript)
+	}
+	utxo := &UTXO{
+		OutPoint:   outpoint,
+		Amount:     amount,
+		PkScript:   o.PkScript,
+		SpendType:  o.SpendType,
+		Script:     orBytes(o.WitnessScript, o.RedeemScript),
+		Origins:    o.Origins,
+		Miniscript: o.Miniscript,
+	}
+	if o.SpendType == SpendP2TRKeyPath {
+		utxo.TapInternalKey = o.TapInternalKey
+		utxo.TapMerkleRoot = o.TapMerkleRoot
+	}
+	return utxo, nil
+}
+
+// LeafUTXO returns the utxo spending the taproot output by the script path of the leaf
+func (o *DescriptorOutput) LeafUTXO(outpoint wire.OutPoint, amount int64, leaf int) (*UTXO, error) {
+	if leaf < 0 || leaf >= len(o.TapLeaves) {
+		return nil, fmt.Errorf("%w: no leaf %d", ErrInvalidDescriptor, leaf)
+	}
+	tapLeaf := o.TapLeaves[leaf]
+	utxo := &UTXO{
+		OutPoint:     outpoint,
+		Amount:       amount,
+		PkScript:     o.PkScript,
+		SpendType:    SpendP2TRScriptPath,
+		Script:       tapLeaf.Script,
+		ControlBlock: tapLeaf.ControlBlock,
+		Origins:      o.Origins,
+	}
+	if tapLeaf.Miniscript != nil {
+		utxo.SpendType = SpendMiniscript
+		utxo.Miniscript = tapLeaf.Miniscript
+	}
+	return utxo, nil
+}
@@ -0,0 +1,137 @@
+package example
+
+import (
+	"encoding/hex"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+// https://github.com/bitcoin/bitcoin/blob/master/doc/descriptors.md
+func TestDescriptorChecksum(t *testing.T) {
+	for _, desc := range []string{
+		"raw(deadbeef)#89f8spxm",
+		"pkh([d34db33f/44'/0'/0']xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL/1/*)#ml40v0wf",
+		"sh(multi(2,[00000000/111'/222]xprvA1RpRA33e1JQ7ifknakTFpgNXPmW2YvmhqLQYMmrj4xJXXWYpDPS3xz7iAxn8L39njGVyuoseXzU6rcxFLJ8HFsTjSyQbLYnMpCqE2VbFWc,xprv9uPDJpEQgRQfDcW7BkF7eTya6RPxXeJCqCJGHuCJ4GiRVLzkTXBAJMu2qaMWPrS7AANYqdq6vcBcBUdJCVVFceUvJFjaPdGZ2y9WACViL4L/0))#ggrsrxfy",
+	} {
+		body, want, _ := strings.Cut(desc, "#")
+		got, err := DescriptorChecksum(body)
+		if err != nil || got != want {
+			t.Errorf("%s: checksum %s %v, want %s", body, got, err, want)
+		}
+		if _, err := ParseDescriptor(desc, &chaincfg.MainNetParams); err != nil {
+			t.Errorf("%s: %v", desc, err)
+		}
+	}
+
+	// a flipped character of the checksum is rejected
+	if _, err := ParseDescriptor("raw(deadbeef)#89f8spxn", &chaincfg.MainNetParams); !errors.Is(err, ErrInvalidDescriptor) {
+		t.Errorf("got %v, want ErrInvalidDescriptor", err)
+	}
+}
+
+func TestDescriptorExpand(t *testing.T) {
+	for _, vector := range []struct {
+		desc     string
+		pkScript string
+	}{
+		{"wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9)",
+			"00147dd65592d0ab2fe0d0257d571abf032cd9db93dc"},
+		{"sh(wpkh(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556))",
+			"a914cc6ffbc0bf31af759451068f90ba7a0272b6b33287"},
+		{"wsh(pkh(02e493dbf1c10d80f3581e4904930b1404cc6c13900ee0758474fa94abe8c4cd13))",
+			"0020fc5acc302aab97f821f9a61e1cc572e7968a603551e95d4ba12b51df6581482f"},
+		{"sh(multi(2,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01,03acd484e2f0c7f65309ad178a9f559abde09796974c57e714c35f110dfc27ccbe))",
+			"a914a6a8b030a38762f4c1f5cbe387b61a3c5da5cd2687"},
+		{"tr(a34b99f22c790c4e36b2b3c2c35a36db06226e41c692fc82b8b56ac1c540c5bd)",
+			"512077aab6e066f8a7419c5ab714c12c67d25007ed55a43cadcacb4d7a970a093f11"},
+	} {
+		desc, err := ParseDescriptor(vector.desc, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatalf("%s: %v", vector.desc, err)
+		}
+		out, err := desc.Expand(0)
+		if err != nil {
+			t.Fatalf("%s: %v", vector.desc, err)
+		}
+		if got := hex.EncodeToString(out.PkScript); got != vector.pkScript {
+			t.Errorf("%s: script %s, want %s", vector.desc, got, vector.pkScript)
+		}
+		// the string has the checksum and parses back to the same descriptor
+		again, err := ParseDescriptor(desc.String(), &chaincfg.MainNetParams)
+		if err != nil || again.String() != desc.String() {
+			t.Errorf("%s: round trip %v", desc, err)
+		}
+	}
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0084.mediawiki#test-vectors
+func TestDescriptorRange(t *testing.T) {
+	seed, err := MnemonicToSeed("abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := NewMasterKey(seed, &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path, err := ParseDerivationPath("m/84'/0'/0'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	account, err := DeriveKey(master, path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	xpub, err := account.Neuter()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc, err := ParseDescriptor("wpkh([73c5da0a/84h/0h/0h]"+xpub.String()+"/0/*)", &chaincfg.MainNetParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	outs, err := desc.ExpandRange(0, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for idx, want := range []string{
+		"bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu",
+		"bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g",
+	} {
+		if got := outs[idx].Address.EncodeAddress(); got != want {
+			t.Errorf("address %d: %s, want %s", idx, got, want)
+		}
+	}
+	// the fingerprint is little endian like the bip32 derivation of the psbt package
+	if origin := outs[1].Origins[0]; origin.Fingerprint != 0x0adac573 || FormatDerivationPath(origin.Path) != "m/84'/0'/0'/0/1" {
+		t.Errorf("origin %08x %s", origin.Fingerprint, FormatDerivationPath(origin.Path))
+	}
+}
+
+func TestDescriptorInvalid(t *testing.T) {
+	for _, test := range []struct {
+		desc string
+		want error
+	}{
+		{"foo(deadbeef)", ErrInvalidDescriptor},
+		{"wpkh(02f9308a019258c31049344f85f89d5229b531c845836f99b08601f113bce036f9", ErrInvalidDescriptor},
+		{"sh(sh(wpkh(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556)))", ErrInvalidDescriptor},
+		{"sh(wsh(and_v(v:pk(03fff97bd5755eeea420453a14355235d382f6472f8568a18b2f057a1460297556),older(144))))", ErrInvalidDescriptor},
+		{"multi(3,022f01e5e15cca351daff3843fb70f3c2f0a1bdd05e5af888a67784ef3e10a2a01,03acd484e2f0c7f65309ad178a9f559abde09796974c57e714c35f110dfc27ccbe)", ErrInvalidDescriptor},
+		{"wpkh(deadbeef)", ErrInvalidKey},
+		// the hardened child of an xpub
+		{"pkh(xpub6ERApfZwUNrhLCkDtcHTcxd75RbzS1ed54G1LkBUHQVHQKqhMkhgbmJbZRkrgZw4koxb5JaHWkY4ALHY2grBGRjaDMzQLcgJvLJuZZvRcEL/1h/*)", ErrInvalidKey},
+	} {
+		desc, err := ParseDescriptor(test.desc, &chaincfg.MainNetParams)
+		if err == nil {
+			_, err = desc.Expand(0)
+		}
+		if !errors.Is(err, test.want) {
+			t.Errorf("%s: got %v, want %v", test.desc, err, test.want)
+		}
+	}
+}
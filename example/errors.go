@@ -0,0 +1,69 @@
+package example
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var (
+	// ErrInvalidKey is returned when a private key can't be decoded or is out of the curve order
+	ErrInvalidKey = errors.New("invalid key")
+	// ErrInvalidAddress is returned when an address can't be created from the given key or script
+	ErrInvalidAddress = errors.New("invalid address")
+	// ErrDustOutput is returned when an output value is below the dust threshold of its script
+	ErrDustOutput = errors.New("dust output")
+	// ErrFeeExceedsInput is returned when the fee is larger than or equal to the input amount
+	ErrFeeExceedsInput = errors.New("fee exceeds input")
+	// ErrScriptBuild is returned when a script can't be built
+	ErrScriptBuild = errors.New("script build failure")
+	// ErrInsufficientFunds is returned when the utxo pool can't fund the payment
+	ErrInsufficientFunds = errors.New("insufficient funds")
+	// ErrInvalidPsbt is returned when a psbt can't be decoded, combined or finalized
+	ErrInvalidPsbt = errors.New("invalid psbt")
+	// ErrInvalidDerivationPath is returned when a bip32 derivation path can't be parsed
+	ErrInvalidDerivationPath = errors.New("invalid derivation path")
+	// ErrInvalidMnemonic is returned when a bip39 mnemonic has a bad word, length or checksum
+	ErrInvalidMnemonic = errors.New("invalid mnemonic")
+	// ErrInvalidDescriptor is returned when an output script descriptor can't be parsed or expanded
+	ErrInvalidDescriptor = errors.New("invalid descriptor")
+	// ErrInvalidMiniscript is returned when a miniscript or a policy can't be parsed, type checked or satisfied
+	ErrInvalidMiniscript = errors.New("invalid miniscript")
+	// ErrScriptVerify is returned when a signed input doesn't pass the script engine
+	ErrScriptVerify = errors.New("script verification failure")
+	// ErrInvalidTx is returned when a raw transaction can't be decoded
+	ErrInvalidTx = errors.New("invalid transaction")
+	// ErrInvalidScript is returned when a script or its asm can't be parsed
+	ErrInvalidScript = errors.New("invalid script")
+	// ErrInvalidSignature is returned when a message signature can't be created, decoded or verified
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrReplacementRejected is returned when a replacement transaction breaks a rule of bip125
+	ErrReplacementRejected = errors.New("replacement rejected")
+)
+
+// Must is a thin wrapper for the workshop snippets, it panics if err is not nil
+func Must[T any](v T, err error) T {
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// subtractFee returns the output value after paying the fee from the input amount
+func subtractFee(prevAmount, fee int64) (int64, error) {
+	if fee < 0 || fee >= prevAmount {
+		return 0, fmt.Errorf("%w: fee %d, input %d", ErrFeeExceedsInput, fee, prevAmount)
+	}
+	return prevAmount - fee, nil
+}
+
+// newTxOut creates a txout and rejects it if the value is dust under the default relay fee
+func newTxOut(value int64, pkScript []byte) (*wire.TxOut, error) {
+	txout := wire.NewTxOut(value, pkScript)
+	if mempool.IsDust(txout, mempool.DefaultMinRelayTxFee) {
+		return nil, fmt.Errorf("%w: %d satoshis", ErrDustOutput, value)
+	}
+	return txout, nil
+}
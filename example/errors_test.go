@@ -0,0 +1,54 @@
+package example
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestFromKey(t *testing.T) {
+	for _, rawHex := range []string{
+		"zz",
+		"0102",
+		strings.Repeat("00", 32),
+		// the curve order
+		"fffffffffffffffffffffffffffffffebaaedce6af48a03bbfd25e8cd0364141",
+	} {
+		if _, err := FromKey(rawHex); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("%s: got %v, want ErrInvalidKey", rawHex, err)
+		}
+	}
+
+	prvkey, err := FromKey(strings.Repeat("01", 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !prvkey.Key.Equals(&testKey(1).Key) {
+		t.Error("another key")
+	}
+}
+
+func TestBuilderErrors(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+
+	if _, err := Pay2PubkeyHash(testNet, alice, testPool(1000), 1000, 1); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+	if _, err := Pay2PubkeyHash(testNet, alice, testPool(100000), 1000, -1); !errors.Is(err, ErrFeeExceedsInput) {
+		t.Errorf("got %v, want ErrFeeExceedsInput", err)
+	}
+	if _, err := Pay2WitnessPubkeyHashAddr(testNet, alice, testPool(100000), 100, 1); !errors.Is(err, ErrDustOutput) {
+		t.Errorf("got %v, want ErrDustOutput", err)
+	}
+	if _, err := CreateP2WSHMultiSigTx(testNet, alice, bob, cario, testPool(1000), 1000, 5000); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+
+	tx, err := Pay2PubkeyHash(testNet, alice, testPool(100000), 50000, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxOut) != 2 || tx.TxOut[0].Value != 50000 || tx.TxOut[1].Value >= 50000 || len(tx.TxIn[0].SignatureScript) == 0 {
+		t.Errorf("unexpected tx %v", tx)
+	}
+}
@@ -0,0 +1,323 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/blockchain"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const (
+	// MaxECDSASigSize is a DER signature with high R and S plus the sighash type
+	MaxECDSASigSize = 73
+	// SchnorrSigSize is a BIP340 signature with SIGHASH_DEFAULT
+	SchnorrSigSize = 64
+
+	compressedPubKeySize   = 33
+	uncompressedPubKeySize = 65
+	xonlyPubKeySize        = 32
+	// OP_0 <20 bytes pubkey hash>
+	p2wpkhProgramSize = 22
+	// OP_0 <32 bytes script hash>
+	p2wshProgramSize = 34
+
+	// outpoint(32+4) + sequence(4)
+	txInBaseSize = 32 + 4 + 4
+	// version(4) + locktime(4)
+	txBaseSize = 4 + 4
+)
+
+// TxWeightEstimator predicts the weight of a transaction before it's signed,
+// the signatures are counted with the maximum size so the estimation never falls short
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#transaction-size-calculations
+type TxWeightEstimator struct {
+	inputCount  int
+	outputCount int
+
+	// the bytes of the inputs and outputs without the counts
+	inputSize  int
+	outputSize int
+
+	// the witness bytes of all the inputs, including the witness item counts
+	witnessSize int
+	hasWitness  bool
+}
+
+func pushDataSize(n int) int {
+	switch {
+	case n == 0:
+		return 1 // OP_0
+	case n < txscript.OP_PUSHDATA1:
+		return 1 + n
+	case n <= 0xff:
+		return 2 + n
+	case n <= 0xffff:
+		return 3 + n
+	default:
+		return 5 + n
+	}
+}
+
+func witnessStackSize(items ...int) int {
+	size := wire.VarIntSerializeSize(uint64(len(items)))
+	for _, item := range items {
+		size += wire.VarIntSerializeSize(uint64(item)) + item
+	}
+	return size
+}
+
+func (e *TxWeightEstimator) addInput(scriptSigSize, witnessSize int) *TxWeightEstimator {
+	e.inputCount++
+	e.inputSize += txInBaseSize + wire.VarIntSerializeSize(uint64(scriptSigSize)) + scriptSigSize
+	if witnessSize > 0 {
+		e.hasWitness = true
+		e.witnessSize += witnessSize
+	} else {
+		// an input without witness still has the item count if any other input has a witness
+		e.witnessSize += 1
+	}
+	return e
+}
+
+// AddP2PKHInput adds an input with the scriptSig `<sig> <pubkey>`
+func (e *TxWeightEstimator) AddP2PKHInput() *TxWeightEstimator {
+	return e.addInput(pushDataSize(MaxECDSASigSize)+pushDataSize(compressedPubKeySize), 0)
+}
+
+// AddP2SHInput adds an input with the given scriptSig pushes followed by the redeem script
+func (e *TxWeightEstimator) AddP2SHInput(redeemScriptSize int, items ...int) *TxWeightEstimator {
+	scriptSigSize := pushDataSize(redeemScriptSize)
+	for _, item := range items {
+		scriptSigSize += pushDataSize(item)
+	}
+	return e.addInput(scriptSigSize, 0)
+}
+
+// AddP2SHMultiSigInput adds a m-of-n OP_CHECKMULTISIG input with compressed pubkeys
+func (e *TxWeightEstimator) AddP2SHMultiSigInput(m, n int) *TxWeightEstimator {
+	return e.AddP2SHInput(multisigScriptSize(m, n, compressedPubKeySize), multisigItems(m)...)
+}
+
+// AddP2WPKHInput adds an input with the witness `<sig> <pubkey>`
+func (e *TxWeightEstimator) AddP2WPKHInput() *TxWeightEstimator {
+	return e.addInput(0, witnessStackSize(MaxECDSASigSize, compressedPubKeySize))
+}
+
+// AddP2SHP2WPKHInput adds a nested segwit input, the scriptSig pushes the p2wpkh witness program
+func (e *TxWeightEstimator) AddP2SHP2WPKHInput() *TxWeightEstimator {
+	return e.addInput(pushDataSize(p2wpkhProgramSize), witnessStackSize(MaxECDSASigSize, compressedPubKeySize))
+}
+
+// AddP2WSHInput adds an input with the given witness items followed by the witness script
+func (e *TxWeightEstimator) AddP2WSHInput(witnessScriptSize int, items ...int) *TxWeightEstimator {
+	return e.addInput(0, witnessStackSize(append(items, witnessScriptSize)...))
+}
+
+// AddP2WSHMultiSigInput adds a m-of-n OP_CHECKMULTISIG input with compressed pubkeys
+func (e *TxWeightEstimator) AddP2WSHMultiSigInput(m, n int) *TxWeightEstimator {
+	return e.AddP2WSHInput(multisigScriptSize(m, n, compressedPubKeySize), multisigItems(m)...)
+}
+
+// AddP2SHP2WSHInput adds a nested segwit input, the scriptSig pushes the p2wsh witness program
+func (e *TxWeightEstimator) AddP2SHP2WSHInput(witnessScriptSize int, items ...int) *TxWeightEstimator {
+	return e.addInput(pushDataSize(p2wshProgramSize), witnessStackSize(append(items, witnessScriptSize)...))
+}
+
+// AddBip112Input adds an input of the script built by CreateBip112P2wsh
+func (e *TxWeightEstimator) AddBip112Input(witnessScriptSize, preimageSize int, useTimelock bool) *TxWeightEstimator {
+	if useTimelock {
+		return e.AddP2WSHInput(witnessScriptSize, MaxECDSASigSize, preimageSize)
+	}
+	return e.AddP2WSHInput(witnessScriptSize, 0, MaxECDSASigSize, MaxECDSASigSize, preimageSize)
+}
+
+// AddTaprootKeySpendInput adds an input with the witness `<sig>`
+func (e *TxWeightEstimator) AddTaprootKeySpendInput() *TxWeightEstimator {
+	return e.addInput(0, witnessStackSize(SchnorrSigSize))
+}
+
+// AddTaprootScriptSpendInput adds an input with the given witness items, the leaf script and
+// the control block of a leaf at the depth of the script tree
+func (e *TxWeightEstimator) AddTaprootScriptSpendInput(leafScriptSize, depth int, items ...int) *TxWeightEstimator {
+	controlBlockSize := txscript.ControlBlockBaseSize + depth*txscript.ControlBlockNodeSize
+	return e.addInput(0, witnessStackSize(append(items, leafScriptSize, controlBlockSize)...))
+}
+
+// AddInput adds the input by the spend type of the utxo
+func (e *TxWeightEstimator) AddInput(utxo *UTXO) error {
+	switch utxo.SpendType {
+	case SpendP2PKH:
+		if utxo.UncompressedPubKey {
+			e.addInput(pushDataSize(MaxECDSASigSize)+pushDataSize(uncompressedPubKeySize), 0)
+		} else {
+			e.AddP2PKHInput()
+		}
+	case SpendP2SHMultiSig:
+		_, m, ok := parseMultiSigScript(utxo.Script)
+		if !ok {
+			return fmt.Errorf("%w: %x is not a multisig script", ErrScriptBuild, utxo.Script)
+		}
+		e.AddP2SHInput(len(utxo.Script), multisigItems(m)...)
+	case SpendP2WPKH:
+		e.AddP2WPKHInput()
+	case SpendP2SHP2WPKH:
+		e.AddP2SHP2WPKHInput()
+	case SpendP2WSHMultiSig:
+		_, m, ok := parseMultiSigScript(utxo.Script)
+		if !ok {
+			return fmt.Errorf("%w: %x is not a multisig script", ErrScriptBuild, utxo.Script)
+		}
+		e.AddP2WSHInput(len(utxo.Script), multisigItems(m)...)
+	case SpendP2SHP2WSHMultiSig:
+		_, m, ok := parseMultiSigScript(utxo.Script)
+		if !ok {
+			return fmt.Errorf("%w: %x is not a multisig script", ErrScriptBuild, utxo.Script)
+		}
+		e.AddP2SHP2WSHInput(len(utxo.Script), multisigItems(m)...)
+	case SpendP2TRKeyPath, SpendMuSig2:
+		e.AddTaprootKeySpendInput()
+	case SpendBip112Timelock, SpendBip112MultiSig:
+		e.AddBip112Input(len(utxo.Script), len(utxo.Preimage), utxo.SpendType == SpendBip112Timelock)
+	case SpendP2TRScriptPath:
+		items, err := tapscriptItems(utxo.Script, len(utxo.Keys))
+		if err != nil {
+			return err
+		}
+		depth := (len(utxo.ControlBlock) - txscript.ControlBlockBaseSize) / txscript.ControlBlockNodeSize
+		e.AddTaprootScriptSpendInput(len(utxo.Script), depth, items...)
+	case SpendMiniscript:
+		if utxo.Miniscript == nil {
+			return fmt.Errorf("%w: no miniscript", ErrInvalidMiniscript)
+		}
+		items, err := utxo.Miniscript.estimateItems(utxo)
+		if err != nil {
+			return err
+		}
+		if utxo.Miniscript.tapscript {
+			depth := (len(utxo.ControlBlock) - txscript.ControlBlockBaseSize) / txscript.ControlBlockNodeSize
+			e.AddTaprootScriptSpendInput(len(utxo.Script), depth, items...)
+		} else {
+			e.AddP2WSHInput(len(utxo.Script), items...)
+		}
+	default:
+		return fmt.Errorf("unsupported spend type %s", utxo.SpendType)
+	}
+	return nil
+}
+
+// inputWeight is the weight added by the utxo as an input of a segwit transaction
+func inputWeight(utxo *UTXO) (int64, error) {
+	e := new(TxWeightEstimator)
+	if err := e.AddInput(utxo); err != nil {
+		return 0, err
+	}
+	return int64(e.inputSize*blockchain.WitnessScaleFactor + e.witnessSize), nil
+}
+
+// spendWeight guesses the weight to spend an output by its script class,
+// the scripts behind p2sh and p2wsh are unknown so they're counted as 2-of-3 multisig
+func spendWeight(pkScript []byte) int64 {
+	e := new(TxWeightEstimator)
+	switch txscript.GetScriptClass(pkScript) {
+	case txscript.PubKeyHashTy:
+		e.AddP2PKHInput()
+	case txscript.WitnessV0PubKeyHashTy:
+		e.AddP2WPKHInput()
+	case txscript.WitnessV1TaprootTy:
+		e.AddTaprootKeySpendInput()
+	case txscript.WitnessV0ScriptHashTy:
+		e.AddP2WSHMultiSigInput(2, 3)
+	default:
+		e.AddP2SHMultiSigInput(2, 3)
+	}
+	return int64(e.inputSize*blockchain.WitnessScaleFactor + e.witnessSize)
+}
+
+// AddOutput adds an output paying to the pkScript
+func (e *TxWeightEstimator) AddOutput(pkScript []byte) *TxWeightEstimator {
+	e.outputCount++
+	e.outputSize += txOutSize(pkScript)
+	return e
+}
+
+// value(8) + pkScript
+func txOutSize(pkScript []byte) int {
+	return 8 + wire.VarIntSerializeSize(uint64(len(pkScript))) + len(pkScript)
+}
+
+// outputWeight is the weight added by an output paying to the pkScript
+func outputWeight(pkScript []byte) int64 {
+	return int64(txOutSize(pkScript) * blockchain.WitnessScaleFactor)
+}
+
+// Weight returns the weight units of the transaction
+func (e *TxWeightEstimator) Weight() int64 {
+	baseSize := txBaseSize + e.inputSize + e.outputSize +
+		wire.VarIntSerializeSize(uint64(e.inputCount)) + wire.VarIntSerializeSize(uint64(e.outputCount))
+	weight := baseSize * blockchain.WitnessScaleFactor
+	if e.hasWitness {
+		// marker(1) + flag(1)
+		weight += 2 + e.witnessSize
+	}
+	return int64(weight)
+}
+
+// VSize returns the virtual size of the transaction
+func (e *TxWeightEstimator) VSize() int64 {
+	return (e.Weight() + blockchain.WitnessScaleFactor - 1) / blockchain.WitnessScaleFactor
+}
+
+// Fee returns the fee by the fee rate in sat/vB
+func (e *TxWeightEstimator) Fee(feeRate int64) int64 {
+	return e.VSize() * feeRate
+}
+
+// multisigScriptSize is the size of `m <pubkey>... n OP_CHECKMULTISIG`
+func multisigScriptSize(m, n, pubkeySize int) int {
+	return scriptIntSize(int64(m)) + n*pushDataSize(pubkeySize) + scriptIntSize(int64(n)) + 1
+}
+
+// scriptIntSize is the size of the number pushed by ScriptBuilder.AddInt64,
+// OP_0 to OP_16 are 1 byte and a larger number like 17 is a push of the script number
+func scriptIntSize(n int64) int {
+	script, _ := txscript.NewScriptBuilder().AddInt64(n).Script()
+	return len(script)
+}
+
+// multisigItems are the stack items of `OP_0 <sig>...`
+func multisigItems(m int) []int {
+	items := []int{0}
+	for range m {
+		items = append(items, MaxECDSASigSize)
+	}
+	return items
+}
+
+// tapscriptItems are the stack items of a checksig/checksigadd leaf signed by nsigs keys,
+// the other keys get an empty vector. Without nsigs, or with more keys than the threshold,
+// the threshold of the leaf signs.
+func tapscriptItems(leafScript []byte, nsigs int) ([]int, error) {
+	pushes, err := txscript.PushedData(leafScript)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	if _, threshold, ok := parseTapscriptMulti(leafScript); ok && (nsigs == 0 || nsigs > threshold) {
+		nsigs = threshold
+	}
+
+	var items []int
+	for _, data := range pushes {
+		if len(data) != xonlyPubKeySize {
+			continue
+		}
+		if nsigs > 0 {
+			items = append(items, SchnorrSigSize)
+			nsigs--
+		} else {
+			items = append(items, 0)
+		}
+	}
+	return items, nil
+}
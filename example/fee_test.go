@@ -0,0 +1,113 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TestFeeEstimation pays half of the utxo with change at 1 sat/vB, so the fee is the estimated vsize,
+// it must cover the signed tx and the maximum signatures overcount by a few bytes at most, a legacy
+// scriptSig may also cross the size of its length prefix
+func TestFeeEstimation(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	const amount = 100000
+
+	for _, test := range []struct {
+		name  string
+		build func() (*wire.MsgTx, error)
+	}{
+		{"p2pkh", func() (*wire.MsgTx, error) {
+			return Pay2PubkeyHash(testNet, alice, testPool(amount), amount/2, 1)
+		}},
+		{"p2sh multisig", func() (*wire.MsgTx, error) {
+			return Pay2ScriptHashTx(testNet, alice, bob, cario, testPool(amount), amount/2, 1)
+		}},
+		{"p2wpkh", func() (*wire.MsgTx, error) {
+			return Pay2WitnessPubkeyHashAddr(testNet, alice, testPool(amount), amount/2, 1)
+		}},
+		{"p2sh-p2wpkh", func() (*wire.MsgTx, error) {
+			return Pay2NestedWitnessPubkeyHashTx(testNet, alice, testPool(amount), amount/2, 1)
+		}},
+		{"p2sh-p2wsh multisig", func() (*wire.MsgTx, error) {
+			return Pay2NestedWitnessScriptHashTx(testNet, alice, bob, cario, testPool(amount), amount/2, 1)
+		}},
+		{"p2wsh multisig", func() (*wire.MsgTx, error) {
+			return CreateP2WSHMultiSigTx(testNet, alice, bob, cario, testPool(amount), amount/2, 1)
+		}},
+		{"bip112 timelock", func() (*wire.MsgTx, error) {
+			return CreateBip112P2wsh(testNet, alice, bob, testPool(amount), amount/2, 1, 10, true,
+				[]byte("timelock"), []byte("multisig"))
+		}},
+		{"bip112 multisig", func() (*wire.MsgTx, error) {
+			return CreateBip112P2wsh(testNet, alice, bob, testPool(amount), amount/2, 1, 10, false,
+				[]byte("timelock"), []byte("multisig"))
+		}},
+		{"taproot key path", func() (*wire.MsgTx, error) {
+			return Pay2TaprootByKeyPathTx(testNet, alice, testPool(amount), amount/2, 1)
+		}},
+		{"musig2", func() (*wire.MsgTx, error) {
+			return MuSig2(testNet, alice, bob, testPool(amount), amount/2, 1)
+		}},
+		{"taproot script path", func() (*wire.MsgTx, error) {
+			return PayToTaprootByPath(testNet, alice, bob, cario, nil, testPool(amount), amount/2, 1)
+		}},
+	} {
+		tx, err := test.build()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		fee := int64(amount)
+		for _, txout := range tx.TxOut {
+			fee -= txout.Value
+		}
+		vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+		if fee < vsize || fee > vsize+8 {
+			t.Errorf("%s: estimated %d vbytes, signed %d vbytes", test.name, fee, vsize)
+		}
+	}
+}
+
+func TestTxWeightEstimator(t *testing.T) {
+	// 1 p2wpkh input and 2 p2wpkh outputs are 141 vbytes with the maximum signature
+	estimator := new(TxWeightEstimator).AddP2WPKHInput().AddOutput(make([]byte, 22)).AddOutput(make([]byte, 22))
+	if vsize := estimator.VSize(); vsize != 141 {
+		t.Errorf("vsize %d, want 141", vsize)
+	}
+	if fee := estimator.Fee(3); fee != 423 {
+		t.Errorf("fee %d, want 423", fee)
+	}
+}
+
+func TestMultiSigEstimate(t *testing.T) {
+	// 17 and 20 are pushed as script numbers, not as OP_1 to OP_16
+	var keys []*btcec.PrivateKey
+	var pubkeys []*btcec.PublicKey
+	for i := byte(1); i <= 20; i++ {
+		keys = append(keys, testKey(i))
+		pubkeys = append(pubkeys, testKey(i).PubKey())
+	}
+	spend, _, err := multiSigOutput(testNet, MultiSigP2WSH, 17, pubkeys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if size := multisigScriptSize(17, 20, compressedPubKeySize); size != len(spend.Script) {
+		t.Errorf("script size %d, want %d", size, len(spend.Script))
+	}
+
+	tx, err := MultiSigTx(testNet, MultiSigP2WSH, 17, pubkeys, keys[3:], testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	estimator := new(TxWeightEstimator).AddP2WSHMultiSigInput(17, 20)
+	for _, txout := range tx.TxOut {
+		estimator.AddOutput(txout.PkScript)
+	}
+	vsize := mempool.GetTxVirtualSize(btcutil.NewTx(tx))
+	if estimated := estimator.VSize(); estimated < vsize || estimated > vsize+8 {
+		t.Errorf("estimated %d vbytes, signed %d vbytes", estimated, vsize)
+	}
+}
@@ -1,32 +1,55 @@
 package example
 
 import (
+	"crypto/pbkdf2"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	_ "embed"
+	"encoding/binary"
 	"encoding/hex"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"golang.org/x/text/unicode/norm"
 )
 
-func NewKey() *btcec.PrivateKey {
+func NewKey() (*btcec.PrivateKey, error) {
 	prvkey, err := btcec.NewPrivateKey()
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
 	}
-	return prvkey
+	return prvkey, nil
 }
 
-func FromKey(rawHex string) *btcec.PrivateKey {
+func FromKey(rawHex string) (*btcec.PrivateKey, error) {
 	raw, err := hex.DecodeString(rawHex)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
 	}
-	prvkey, _ := btcec.PrivKeyFromBytes(raw)
-	return prvkey
+	if len(raw) != btcec.PrivKeyBytesLen {
+		return nil, fmt.Errorf("%w: want %d bytes, got %d", ErrInvalidKey, btcec.PrivKeyBytesLen, len(raw))
+	}
+
+	// PrivKeyFromBytes reduces the key modulo the curve order silently, reject it here
+	var scalar btcec.ModNScalar
+	if overflow := scalar.SetByteSlice(raw); overflow || scalar.IsZero() {
+		return nil, fmt.Errorf("%w: out of range", ErrInvalidKey)
+	}
+	return btcec.PrivKeyFromScalar(&scalar), nil
 }
 
-func Keygen() {
-	prvkey := NewKey()
+func Keygen() error {
+	prvkey, err := NewKey()
+	if err != nil {
+		return err
+	}
 
 	rawPrvKey := prvkey.Serialize()
 
@@ -35,6 +58,12 @@ func Keygen() {
 
 	fmt.Println("Private key", hex.EncodeToString(rawPrvKey))
 
+	wif, err := EncodeWIF(prvkey, &chaincfg.MainNetParams, true)
+	if err != nil {
+		return err
+	}
+	fmt.Println("WIF", wif)
+
 	// 33 bytes
 	fmt.Println("Compressed Public key", prvkey.PubKey().SerializeCompressed())
 	// 65 bytes
@@ -43,4 +72,304 @@ func Keygen() {
 	// 32 bytes
 	fmt.Println("Schnorr(BIP-340) Public key",
 		hex.EncodeToString(schnorr.SerializePubKey(prvkey.PubKey())))
+	return nil
+}
+
+// EncodeWIF encodes the private key as the wallet import format of the network,
+// the compressed flag tells which pubkey the addresses of the key use
+func EncodeWIF(prvkey *btcec.PrivateKey, netwk *chaincfg.Params, compressed bool) (string, error) {
+	wif, err := btcutil.NewWIF(prvkey, netwk, compressed)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return wif.String(), nil
+}
+
+// DecodeWIF decodes a key of `dumpprivkey` and checks it belongs to the network,
+// testnet, signet and regtest share the same prefix so they can't be told apart
+func DecodeWIF(wif string, netwk *chaincfg.Params) (*btcutil.WIF, error) {
+	decoded, err := btcutil.DecodeWIF(wif)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if err := checkWIFNet(decoded, netwk); err != nil {
+		return nil, err
+	}
+	return decoded, nil
+}
+
+func checkWIFNet(wif *btcutil.WIF, netwk *chaincfg.Params) error {
+	if !wif.IsForNet(netwk) {
+		return fmt.Errorf("%w: wif is not for %s", ErrInvalidKey, netwk.Name)
+	}
+	return nil
+}
+
+// NewMasterKey creates the bip32 master key from a seed of 16 to 64 bytes
+func NewMasterKey(seed []byte, netwk *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	master, err := hdkeychain.NewMaster(seed, netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return master, nil
+}
+
+// ParseExtendedKey decodes a xprv/xpub/tprv/tpub key and checks it belongs to the network,
+// the testnet keys are shared by testnet, signet and regtest
+func ParseExtendedKey(key string, netwk *chaincfg.Params) (*hdkeychain.ExtendedKey, error) {
+	extkey, err := hdkeychain.NewKeyFromString(key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if !extkey.IsForNet(netwk) {
+		return nil, fmt.Errorf("%w: not a key of %s", ErrInvalidKey, netwk.Name)
+	}
+	return extkey, nil
+}
+
+// ParseDerivationPath parses a path like m/84'/1'/0'/0/5, the hardened index is marked by ' or h
+func ParseDerivationPath(path string) ([]uint32, error) {
+	elems := strings.Split(path, "/")
+	if elems[0] == "m" {
+		elems = elems[1:]
+	}
+
+	indexes := make([]uint32, 0, len(elems))
+	for _, elem := range elems {
+		var offset uint32
+		if trimmed, ok := strings.CutSuffix(elem, "'"); ok {
+			elem, offset = trimmed, hdkeychain.HardenedKeyStart
+		} else if trimmed, ok := strings.CutSuffix(elem, "h"); ok {
+			elem, offset = trimmed, hdkeychain.HardenedKeyStart
+		}
+
+		index, err := strconv.ParseUint(elem, 10, 32)
+		if err != nil || index >= hdkeychain.HardenedKeyStart {
+			return nil, fmt.Errorf("%w: bad index %q of %q", ErrInvalidDerivationPath, elem, path)
+		}
+		indexes = append(indexes, uint32(index)+offset)
+	}
+	return indexes, nil
+}
+
+// FormatDerivationPath is the reverse of ParseDerivationPath
+func FormatDerivationPath(path []uint32) string {
+	var sb strings.Builder
+	sb.WriteString("m")
+	for _, index := range path {
+		if index >= hdkeychain.HardenedKeyStart {
+			fmt.Fprintf(&sb, "/%d'", index-hdkeychain.HardenedKeyStart)
+		} else {
+			fmt.Fprintf(&sb, "/%d", index)
+		}
+	}
+	return sb.String()
+}
+
+// DeriveKey derives the child key of the path, a public key can't derive the hardened children
+func DeriveKey(extkey *hdkeychain.ExtendedKey, path []uint32) (*hdkeychain.ExtendedKey, error) {
+	for _, index := range path {
+		child, err := extkey.Derive(index)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+		}
+		extkey = child
+	}
+	return extkey, nil
+}
+
+// DerivePrivateKey derives the private key of the path string for the builders
+func DerivePrivateKey(master *hdkeychain.ExtendedKey, path string) (*btcec.PrivateKey, error) {
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return nil, err
+	}
+	child, err := DeriveKey(master, indexes)
+	if err != nil {
+		return nil, err
+	}
+	prvkey, err := child.ECPrivKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return prvkey, nil
+}
+
+// Fingerprint is the first 4 bytes of hash160 of the pubkey,
+// it's read as little endian to match the psbt serialization
+func Fingerprint(extkey *hdkeychain.ExtendedKey) (uint32, error) {
+	pubkey, err := extkey.ECPubKey()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return pubkeyFingerprint(pubkey), nil
+}
+
+func pubkeyFingerprint(pubkey *btcec.PublicKey) uint32 {
+	return binary.LittleEndian.Uint32(btcutil.Hash160(pubkey.SerializeCompressed())[:4])
+}
+
+// NewKeyOrigin derives the pubkey of the path with its origin for the psbt
+func NewKeyOrigin(master *hdkeychain.ExtendedKey, path []uint32) (*KeyOrigin, error) {
+	fingerprint, err := Fingerprint(master)
+	if err != nil {
+		return nil, err
+	}
+	child, err := DeriveKey(master, path)
+	if err != nil {
+		return nil, err
+	}
+	pubkey, err := child.ECPubKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	return &KeyOrigin{PubKey: pubkey, Fingerprint: fingerprint, Path: path}, nil
+}
+
+func HDKeygen(netwk *chaincfg.Params) error {
+	seed, err := hdkeychain.GenerateSeed(hdkeychain.RecommendedSeedLen)
+	if err != nil {
+		return err
+	}
+
+	master, err := NewMasterKey(seed, netwk)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Master private key", master.String())
+
+	path := fmt.Sprintf("m/84'/%d'/0'/0/5", netwk.HDCoinType)
+	indexes, err := ParseDerivationPath(path)
+	if err != nil {
+		return err
+	}
+
+	// the account key of m/84'/coin'/0' is shared with the watch-only wallet
+	account, err := DeriveKey(master, indexes[:3])
+	if err != nil {
+		return err
+	}
+	accountPub, err := account.Neuter()
+	if err != nil {
+		return err
+	}
+	fmt.Println("Account public key", accountPub.String())
+
+	// the watch-only wallet derives the same pubkey without hardened derivation
+	child, err := DeriveKey(accountPub, indexes[3:])
+	if err != nil {
+		return err
+	}
+	pubkey, err := child.ECPubKey()
+	if err != nil {
+		return err
+	}
+	fmt.Println(path, "public key", hex.EncodeToString(pubkey.SerializeCompressed()))
+	return nil
+}
+
+// bip39_english.txt is the official wordlist of BIP39
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0039/english.txt
+//
+//go:embed bip39_english.txt
+var bip39English string
+
+var (
+	bip39Words   = strings.Fields(bip39English)
+	bip39Indexes = func() map[string]int {
+		indexes := make(map[string]int, len(bip39Words))
+		for i, word := range bip39Words {
+			indexes[word] = i
+		}
+		return indexes
+	}()
+)
+
+// NewEntropy creates the random entropy of a mnemonic, the bits are 128, 160, 192, 224 or 256
+// for 12, 15, 18, 21 or 24 words
+func NewEntropy(bits int) ([]byte, error) {
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return nil, fmt.Errorf("%w: entropy of %d bits", ErrInvalidMnemonic, bits)
+	}
+	entropy := make([]byte, bits/8)
+	if _, err := rand.Read(entropy); err != nil {
+		return nil, err
+	}
+	return entropy, nil
+}
+
+// NewMnemonic encodes the entropy with its checksum as words, every word is 11 bits
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0039.mediawiki#generating-the-mnemonic
+func NewMnemonic(entropy []byte) (string, error) {
+	bits := len(entropy) * 8
+	if bits < 128 || bits > 256 || bits%32 != 0 {
+		return "", fmt.Errorf("%w: entropy of %d bits", ErrInvalidMnemonic, bits)
+	}
+
+	// the checksum is the first bits/32 bits of sha256 of the entropy
+	checksum := sha256.Sum256(entropy)
+	data := append(append([]byte(nil), entropy...), checksum[0])
+
+	words := make([]string, (bits+bits/32)/11)
+	for i := range words {
+		words[i] = bip39Words[readBits(data, i*11, 11)]
+	}
+	return strings.Join(words, " "), nil
+}
+
+// MnemonicToEntropy decodes the words and validates the checksum
+func MnemonicToEntropy(mnemonic string) ([]byte, error) {
+	words := strings.Fields(mnemonic)
+	if len(words) < 12 || len(words) > 24 || len(words)%3 != 0 {
+		return nil, fmt.Errorf("%w: %d words", ErrInvalidMnemonic, len(words))
+	}
+
+	data := make([]byte, (len(words)*11+7)/8)
+	for i, word := range words {
+		index, ok := bip39Indexes[word]
+		if !ok {
+			return nil, fmt.Errorf("%w: unknown word %q", ErrInvalidMnemonic, word)
+		}
+		writeBits(data, i*11, 11, index)
+	}
+
+	checksumBits := len(words) / 3
+	entropy := data[:(len(words)*11-checksumBits)/8]
+	checksum := sha256.Sum256(entropy)
+	if readBits(data, len(entropy)*8, checksumBits) != readBits(checksum[:], 0, checksumBits) {
+		return nil, fmt.Errorf("%w: checksum mismatch", ErrInvalidMnemonic)
+	}
+	return entropy, nil
+}
+
+// MnemonicToSeed validates the mnemonic and derives the 64 bytes seed for NewMasterKey,
+// the salt is "mnemonic" + passphrase and both are NFKD normalized
+func MnemonicToSeed(mnemonic, passphrase string) ([]byte, error) {
+	if _, err := MnemonicToEntropy(mnemonic); err != nil {
+		return nil, err
+	}
+	password := norm.NFKD.String(strings.Join(strings.Fields(mnemonic), " "))
+	salt := norm.NFKD.String("mnemonic" + passphrase)
+	return pbkdf2.Key(sha512.New, password, []byte(salt), 2048, 64)
+}
+
+// readBits reads n bits at the bit offset as a big endian number
+func readBits(data []byte, offset, n int) int {
+	var v int
+	for i := offset; i < offset+n; i++ {
+		v = v<<1 | int(data[i/8]>>(7-i%8)&1)
+	}
+	return v
+}
+
+// writeBits writes the n bits of v at the bit offset
+func writeBits(data []byte, offset, n, v int) {
+	for i := range n {
+		if v>>(n-1-i)&1 == 1 {
+			pos := offset + i
+			data[pos/8] |= 1 << (7 - pos%8)
+		}
+	}
 }
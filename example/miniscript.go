@@ -0,0 +1,1411 @@
+package example
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+	"golang.org/x/crypto/ripemd160"
+)
+
+// the type properties of miniscript
+//
+// https://bitcoin.sipa.be/miniscript/
+const (
+	msZ uint32 = 1 << iota // consumes exactly 0 stack elements
+	msO                    // consumes exactly 1 stack element
+	msN                    // the top of the satisfaction is never zero
+	msD                    // has a dissatisfaction without a signature
+	msU                    // pushes exactly 1 on satisfaction
+	msS                    // the satisfaction requires a signature
+	msF                    // the dissatisfaction requires a signature, or there is none
+	msE                    // the dissatisfaction is unique and can't be malleated
+	msM                    // the satisfaction is non-malleable
+	msK                    // no timelocks of heights and times are mixed
+	msG                    // has a relative time timelock
+	msH                    // has a relative height timelock
+	msI                    // has an absolute time timelock
+	msJ                    // has an absolute height timelock
+
+	msTimelocks = msG | msH | msI | msJ
+)
+
+// the bip68 and bip65 flags
+const (
+	sequenceLockTimeDisabled = 1 << 31
+	sequenceLockTimeIsTime   = 1 << 22
+	sequenceLockTimeMask     = 0x0000ffff
+	lockTimeThreshold        = 500000000
+
+	// the standard size of the witness script of p2wsh
+	maxStandardP2WSHScriptSize = 3600
+)
+
+// msType is the base type, one of B, V, K or W, and the properties
+type msType struct {
+	base  byte
+	props uint32
+}
+
+func (t msType) is(props uint32) bool {
+	return t.props&props == props
+}
+
+func (t msType) String() string {
+	var sb strings.Builder
+	sb.WriteByte(t.base)
+	for i, c := range "zondusfemk" {
+		if t.props&(1<<i) != 0 {
+			sb.WriteRune(c)
+		}
+	}
+	return sb.String()
+}
+
+// msNode is a fragment of miniscript, the wrappers like v: are fragments with one sub
+type msNode struct {
+	frag string
+	// the threshold, or the value of the timelock
+	k    uint32
+	keys []*descKey
+	hash []byte
+	subs []*msNode
+	typ  msType
+}
+
+// Miniscript is a type checked miniscript of p2wsh or tapscript
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0379.md
+type Miniscript struct {
+	node      *msNode
+	tapscript bool
+	// index derives the ranged keys of a descriptor
+	index uint32
+}
+
+// ParseMiniscript parses a miniscript, the keys are hex pubkeys, WIFs or extended keys without wildcard.
+// It's rejected unless it's sane: non-malleable, requiring a signature and not mixing timelocks.
+func ParseMiniscript(s string, tapscript bool, netwk *chaincfg.Params) (*Miniscript, error) {
+	ctx := descP2WSH
+	if tapscript {
+		ctx = descTapscript
+	}
+	node, err := parseMiniscript(s, ctx, netwk)
+	if err != nil {
+		return nil, err
+	}
+	if node.hasWildcard() {
+		return nil, fmt.Errorf("%w: ranged keys need a descriptor", ErrInvalidMiniscript)
+	}
+	return &Miniscript{node: node, tapscript: tapscript}, nil
+}
+
+// String returns the miniscript with the wrappers merged, like sdv:older(1)
+func (m *Miniscript) String() string {
+	return m.node.String()
+}
+
+// Type returns the base type and the properties, like Bondusemk
+func (m *Miniscript) Type() string {
+	return m.node.typ.String()
+}
+
+// Script compiles the miniscript to the witness script or the tapscript leaf
+func (m *Miniscript) Script() ([]byte, error) {
+	return m.node.script(m.ctx(), func(key *descKey) ([]byte, error) {
+		return m.serializeKey(key)
+	})
+}
+
+func (m *Miniscript) ctx() descContext {
+	if m.tapscript {
+		return descTapscript
+	}
+	return descP2WSH
+}
+
+func (m *Miniscript) serializeKey(key *descKey) ([]byte, error) {
+	pubkey, _, err := key.derive(m.index)
+	if err != nil {
+		return nil, err
+	}
+	if m.tapscript {
+		return schnorr.SerializePubKey(pubkey), nil
+	}
+	return pubkey.SerializeCompressed(), nil
+}
+
+func (n *msNode) hasWildcard() bool {
+	if slices.ContainsFunc(n.keys, func(key *descKey) bool { return key.wildcard }) {
+		return true
+	}
+	return slices.ContainsFunc(n.subs, (*msNode).hasWildcard)
+}
+
+// parseMiniscript parses the miniscript and checks it's sane at the top
+func parseMiniscript(s string, ctx descContext, netwk *chaincfg.Params) (*msNode, error) {
+	node, err := parseMsNode(s, ctx, netwk)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.checkSane(ctx); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+func (n *msNode) checkSane(ctx descContext) error {
+	switch {
+	case n.typ.base != 'B':
+		return fmt.Errorf("%w: miniscript of type %s, want B", ErrInvalidMiniscript, n.typ)
+	case !n.typ.is(msM):
+		return fmt.Errorf("%w: miniscript %s is malleable", ErrInvalidMiniscript, n)
+	case !n.typ.is(msS):
+		return fmt.Errorf("%w: miniscript %s can be spent without a signature", ErrInvalidMiniscript, n)
+	case !n.typ.is(msK):
+		return fmt.Errorf("%w: miniscript %s mixes heights and times", ErrInvalidMiniscript, n)
+	}
+	if ctx == descP2WSH {
+		if size := n.scriptSize(); size > maxStandardP2WSHScriptSize {
+			return fmt.Errorf("%w: witness script of %d bytes", ErrScriptBuild, size)
+		}
+	}
+	return nil
+}
+
+// scriptSize is the size of the script with 33 bytes keys, good enough for the p2wsh limit
+func (n *msNode) scriptSize() int {
+	script, err := n.script(descP2WSH, func(*descKey) ([]byte, error) {
+		return make([]byte, compressedPubKeySize), nil
+	})
+	if err != nil {
+		return 0
+	}
+	return len(script)
+}
+
+func parseMsNode(s string, ctx descContext, netwk *chaincfg.Params) (*msNode, error) {
+	switch s {
+	case "0", "1":
+		return newMsNode(&msNode{frag: s}, ctx)
+	}
+
+	// the wrappers before the colon apply from right to left
+	if colon := msWrappersEnd(s); colon >= 0 {
+		node, err := parseMsNode(s[colon+1:], ctx, netwk)
+		if err != nil {
+			return nil, err
+		}
+		for i := colon - 1; i >= 0; i-- {
+			if node, err = wrapMsNode(s[i], node, ctx); err != nil {
+				return nil, err
+			}
+		}
+		return node, nil
+	}
+
+	name, args, err := splitDescCall(s)
+	if err != nil {
+		return nil, err
+	}
+
+	node := &msNode{frag: name}
+	parseSubs := func(want int) error {
+		if want > 0 && len(args) != want {
+			return fmt.Errorf("%w: %s() takes %d arguments", ErrInvalidMiniscript, name, want)
+		}
+		for _, arg := range args {
+			sub, err := parseMsNode(arg, ctx, netwk)
+			if err != nil {
+				return err
+			}
+			node.subs = append(node.subs, sub)
+		}
+		return nil
+	}
+
+	switch name {
+	case "pk", "pkh":
+		// pk(K) is c:pk_k(K) and pkh(K) is c:pk_h(K)
+		key, err := parseMsKey(args, ctx, netwk)
+		if err != nil {
+			return nil, err
+		}
+		frag := "pk_k"
+		if name == "pkh" {
+			frag = "pk_h"
+		}
+		inner, err := newMsNode(&msNode{frag: frag, keys: []*descKey{key}}, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return wrapMsNode('c', inner, ctx)
+	case "pk_k", "pk_h":
+		key, err := parseMsKey(args, ctx, netwk)
+		if err != nil {
+			return nil, err
+		}
+		node.keys = []*descKey{key}
+	case "older", "after":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s() takes one number", ErrInvalidMiniscript, name)
+		}
+		k, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil || k < 1 || k >= sequenceLockTimeDisabled {
+			return nil, fmt.Errorf("%w: %s(%s)", ErrInvalidMiniscript, name, args[0])
+		}
+		node.k = uint32(k)
+	case "sha256", "hash256", "ripemd160", "hash160":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%w: %s() takes one hash", ErrInvalidMiniscript, name)
+		}
+		hash, err := hex.DecodeString(args[0])
+		want := 32
+		if name == "ripemd160" || name == "hash160" {
+			want = 20
+		}
+		if err != nil || len(hash) != want {
+			return nil, fmt.Errorf("%w: %s(%s)", ErrInvalidMiniscript, name, args[0])
+		}
+		node.hash = hash
+	case "andor", "and_n":
+		if name == "and_n" {
+			// and_n(X,Y) is andor(X,Y,0)
+			node.frag = "andor"
+			args = append(args, "0")
+		}
+		if err := parseSubs(3); err != nil {
+			return nil, err
+		}
+	case "and_v", "and_b", "or_b", "or_c", "or_d", "or_i":
+		if err := parseSubs(2); err != nil {
+			return nil, err
+		}
+	case "thresh", "multi", "multi_a":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: %s() takes a threshold and more", ErrInvalidMiniscript, name)
+		}
+		k, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: threshold %q", ErrInvalidMiniscript, args[0])
+		}
+		node.k = uint32(k)
+		args = args[1:]
+		if name == "thresh" {
+			if err := parseSubs(0); err != nil {
+				return nil, err
+			}
+			break
+		}
+		for _, arg := range args {
+			key, err := parseDescKey(arg, ctx, netwk)
+			if err != nil {
+				return nil, err
+			}
+			node.keys = append(node.keys, key)
+		}
+	default:
+		return nil, fmt.Errorf("%w: unknown fragment %s()", ErrInvalidMiniscript, name)
+	}
+	return newMsNode(node, ctx)
+}
+
+func parseMsKey(args []string, ctx descContext, netwk *chaincfg.Params) (*descKey, error) {
+	if len(args) != 1 {
+		return nil, fmt.Errorf("%w: takes one key", ErrInvalidMiniscript)
+	}
+	return parseDescKey(args[0], ctx, netwk)
+}
+
+// wrapMsNode applies the wrapper, t:, l: and u: are the sugar of and_v and or_i
+func wrapMsNode(wrapper byte, sub *msNode, ctx descContext) (*msNode, error) {
+	switch wrapper {
+	case 'a', 's', 'c', 'd', 'v', 'j', 'n':
+		return newMsNode(&msNode{frag: string(wrapper), subs: []*msNode{sub}}, ctx)
+	case 't':
+		one, _ := newMsNode(&msNode{frag: "1"}, ctx)
+		return newMsNode(&msNode{frag: "and_v", subs: []*msNode{sub, one}}, ctx)
+	case 'l', 'u':
+		zero, _ := newMsNode(&msNode{frag: "0"}, ctx)
+		subs := []*msNode{zero, sub}
+		if wrapper == 'u' {
+			subs = []*msNode{sub, zero}
+		}
+		return newMsNode(&msNode{frag: "or_i", subs: subs}, ctx)
+	default:
+		return nil, fmt.Errorf("%w: unknown wrapper %c:", ErrInvalidMiniscript, wrapper)
+	}
+}
+
+// CompilePolicy compiles a policy of pk(), older(), after(), the hashes, and(), or() and thresh()
+// into a miniscript, the branches of or() can be weighted by the probability like or(9@pk(A),1@pk(B)).
+// It's a simple heuristic rather than an optimal compiler, the result is rejected unless it's sane.
+func CompilePolicy(policy string, tapscript bool, netwk *chaincfg.Params) (*Miniscript, error) {
+	ctx := descP2WSH
+	if tapscript {
+		ctx = descTapscript
+	}
+	node, err := compilePolicy(policy, ctx, netwk)
+	if err != nil {
+		return nil, err
+	}
+	if err := node.checkSane(ctx); err != nil {
+		return nil, err
+	}
+	if node.hasWildcard() {
+		return nil, fmt.Errorf("%w: ranged keys need a descriptor", ErrInvalidMiniscript)
+	}
+	return &Miniscript{node: node, tapscript: tapscript}, nil
+}
+
+func compilePolicy(s string, ctx descContext, netwk *chaincfg.Params) (*msNode, error) {
+	name, args, err := splitDescCall(s)
+	if err != nil {
+		return nil, err
+	}
+	subs := func(args []string) ([]*msNode, error) {
+		nodes := make([]*msNode, 0, len(args))
+		for _, arg := range args {
+			node, err := compilePolicy(arg, ctx, netwk)
+			if err != nil {
+				return nil, err
+			}
+			nodes = append(nodes, node)
+		}
+		return nodes, nil
+	}
+
+	switch name {
+	case "pk", "older", "after", "sha256", "hash256", "ripemd160", "hash160":
+		return parseMsNode(s, ctx, netwk)
+	case "and":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%w: and() takes two policies", ErrInvalidMiniscript)
+		}
+		nodes, err := subs(args)
+		if err != nil {
+			return nil, err
+		}
+		// the signature is verified first, the timelocks and the hashes go last
+		x, y := nodes[0], nodes[1]
+		if !x.typ.is(msS) && y.typ.is(msS) {
+			x, y = y, x
+		}
+		vx, err := wrapMsNode('v', x, ctx)
+		if err != nil {
+			return nil, err
+		}
+		return newMsNode(&msNode{frag: "and_v", subs: []*msNode{vx, y}}, ctx)
+	case "or":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("%w: or() takes two policies", ErrInvalidMiniscript)
+		}
+		weights := []uint64{1, 1}
+		for i, arg := range args {
+			if weight, sub, ok := strings.Cut(arg, "@"); ok && !strings.Contains(weight, "(") {
+				if weights[i], err = strconv.ParseUint(weight, 10, 32); err != nil || weights[i] == 0 {
+					return nil, fmt.Errorf("%w: weight %q", ErrInvalidMiniscript, weight)
+				}
+				args[i] = sub
+			}
+		}
+		nodes, err := subs(args)
+		if err != nil {
+			return nil, err
+		}
+		// the likely branch goes first, or_d needs a unique dissatisfaction of it
+		x, y := nodes[0], nodes[1]
+		if weights[1] > weights[0] {
+			x, y = y, x
+		}
+		if !x.typ.is(msD|msU|msE) && y.typ.is(msD|msU|msE) {
+			x, y = y, x
+		}
+		frag := "or_i"
+		if x.typ.is(msD | msU | msE) {
+			frag = "or_d"
+		}
+		return newMsNode(&msNode{frag: frag, subs: []*msNode{x, y}}, ctx)
+	case "thresh":
+		if len(args) < 2 {
+			return nil, fmt.Errorf("%w: thresh() takes a threshold and policies", ErrInvalidMiniscript)
+		}
+		k, err := strconv.ParseUint(args[0], 10, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: threshold %q", ErrInvalidMiniscript, args[0])
+		}
+		nodes, err := subs(args[1:])
+		if err != nil {
+			return nil, err
+		}
+		return compileThresh(uint32(k), nodes, ctx)
+	default:
+		return nil, fmt.Errorf("%w: unknown policy %s()", ErrInvalidMiniscript, name)
+	}
+}
+
+// compileThresh uses multi or multi_a for the keys only, otherwise thresh with the subs wrapped
+// to dissatisfiable units
+func compileThresh(k uint32, nodes []*msNode, ctx descContext) (*msNode, error) {
+	frag, limit := "multi", txscript.MaxPubKeysPerMultiSig
+	if ctx == descTapscript {
+		frag, limit = "multi_a", maxMultiAKeys
+	}
+	keys := make([]*descKey, 0, len(nodes))
+	for _, node := range nodes {
+		if node.frag == "c" && node.subs[0].frag == "pk_k" {
+			keys = append(keys, node.subs[0].keys[0])
+		}
+	}
+	if len(keys) == len(nodes) && len(keys) <= limit {
+		return newMsNode(&msNode{frag: frag, k: k, keys: keys}, ctx)
+	}
+
+	var err error
+	for i, node := range nodes {
+		if !node.typ.is(msU) {
+			if node, err = wrapMsNode('n', node, ctx); err != nil {
+				return nil, err
+			}
+		}
+		if !node.typ.is(msD) {
+			if node, err = wrapMsNode('l', node, ctx); err != nil {
+				return nil, err
+			}
+		}
+		if i > 0 {
+			wrapper := byte('a')
+			if node.typ.is(msO) {
+				wrapper = 's'
+			}
+			if node, err = wrapMsNode(wrapper, node, ctx); err != nil {
+				return nil, err
+			}
+		}
+		nodes[i] = node
+	}
+	return newMsNode(&msNode{frag: "thresh", k: k, subs: nodes}, ctx)
+}
+
+// msMixed reports whether the two types have timelocks of heights and times of the same kind,
+// they can't be satisfied together
+func msMixed(x, y msType) bool {
+	return (x.is(msG) && y.is(msH)) || (x.is(msH) && y.is(msG)) ||
+		(x.is(msI) && y.is(msJ)) || (x.is(msJ) && y.is(msI))
+}
+
+// newMsNode checks the requirements of the subs and computes the type of the node
+func newMsNode(n *msNode, ctx descContext) (*msNode, error) {
+	fail := func(format string, args ...any) (*msNode, error) {
+		return nil, fmt.Errorf("%w: %s: %s", ErrInvalidMiniscript, n.frag, fmt.Sprintf(format, args...))
+	}
+	flag := func(cond bool, prop uint32) uint32 {
+		if cond {
+			return prop
+		}
+		return 0
+	}
+
+	var x, y, z msType
+	if len(n.subs) > 0 {
+		x = n.subs[0].typ
+	}
+	if len(n.subs) > 1 {
+		y = n.subs[1].typ
+	}
+	if len(n.subs) > 2 {
+		z = n.subs[2].typ
+	}
+	tl := (x.props | y.props | z.props) & msTimelocks
+
+	switch n.frag {
+	case "0":
+		n.typ = msType{'B', msZ | msU | msD | msE | msS | msM | msK}
+	case "1":
+		n.typ = msType{'B', msZ | msU | msF | msM | msK}
+	case "pk_k":
+		n.typ = msType{'K', msO | msN | msD | msU | msE | msS | msM | msK}
+	case "pk_h":
+		n.typ = msType{'K', msN | msD | msU | msE | msS | msM | msK}
+	case "older":
+		n.typ = msType{'B', msZ | msF | msM | msK | flag(n.k&sequenceLockTimeIsTime != 0, msG) |
+			flag(n.k&sequenceLockTimeIsTime == 0, msH)}
+	case "after":
+		n.typ = msType{'B', msZ | msF | msM | msK | flag(n.k >= lockTimeThreshold, msI) |
+			flag(n.k < lockTimeThreshold, msJ)}
+	case "sha256", "hash256", "ripemd160", "hash160":
+		n.typ = msType{'B', msO | msN | msD | msU | msM | msK}
+	case "andor":
+		if x.base != 'B' || !x.is(msD|msU) || y.base != z.base || !strings.ContainsRune("BKV", rune(y.base)) {
+			return fail("X must be Bdu, Y and Z must be both B, K or V")
+		}
+		n.typ = msType{y.base, flag(x.is(msZ) && y.is(msZ) && z.is(msZ), msZ) |
+			flag((x.is(msZ) && y.is(msO) && z.is(msO)) || (x.is(msO) && y.is(msZ) && z.is(msZ)), msO) |
+			flag(y.is(msU) && z.is(msU), msU) |
+			flag(z.is(msD), msD) |
+			flag(z.is(msS) && (x.is(msS) || y.is(msS)), msS) |
+			flag(z.is(msF) && (x.is(msS) || y.is(msF)), msF) |
+			flag(z.is(msE) && (x.is(msS) || y.is(msF)), msE) |
+			flag(x.is(msM|msE) && y.is(msM) && z.is(msM) && (x.is(msS) || y.is(msS) || z.is(msS)), msM) |
+			flag(x.is(msK) && y.is(msK) && z.is(msK) && !msMixed(x, y), msK) | tl}
+	case "and_v", "and_b":
+		if n.frag == "and_v" && (x.base != 'V' || !strings.ContainsRune("BKV", rune(y.base))) {
+			return fail("X must be V, Y must be B, K or V")
+		}
+		if n.frag == "and_b" && (x.base != 'B' || y.base != 'W') {
+			return fail("X must be B, Y must be W")
+		}
+		props := flag(x.is(msZ) && y.is(msZ), msZ) |
+			flag((x.is(msZ) && y.is(msO)) || (x.is(msO) && y.is(msZ)), msO) |
+			flag(x.is(msN) || (x.is(msZ) && y.is(msN)), msN) |
+			flag(x.is(msS) || y.is(msS), msS) |
+			flag(x.is(msM) && y.is(msM), msM) |
+			flag(x.is(msK) && y.is(msK) && !msMixed(x, y), msK) | tl
+		if n.frag == "and_v" {
+			n.typ = msType{y.base, props | flag(y.is(msU), msU) | flag(x.is(msS) || y.is(msF), msF)}
+		} else {
+			n.typ = msType{'B', props | msU | flag(x.is(msD) && y.is(msD), msD) |
+				flag((x.is(msF) && y.is(msF)) || x.is(msS|msF) || y.is(msS|msF), msF) |
+				flag(x.is(msE|msS) && y.is(msE|msS), msE)}
+		}
+	case "or_b":
+		if x.base != 'B' || !x.is(msD) || y.base != 'W' || !y.is(msD) {
+			return fail("X must be Bd, Z must be Wd")
+		}
+		n.typ = msType{'B', flag(x.is(msZ) && y.is(msZ), msZ) |
+			flag((x.is(msZ) && y.is(msO)) || (x.is(msO) && y.is(msZ)), msO) |
+			msD | msU |
+			flag(x.is(msS) && y.is(msS), msS) |
+			flag(x.is(msE) && y.is(msE), msE) |
+			flag(x.is(msM|msE) && y.is(msM|msE) && (x.is(msS) || y.is(msS)), msM) |
+			flag(x.is(msK) && y.is(msK), msK) | tl}
+	case "or_c", "or_d":
+		if x.base != 'B' || !x.is(msD|msU) {
+			return fail("X must be Bdu")
+		}
+		props := flag(x.is(msZ) && y.is(msZ), msZ) |
+			flag(x.is(msO) && y.is(msZ), msO) |
+			flag(x.is(msS) && y.is(msS), msS) |
+			flag(x.is(msM|msE) && y.is(msM) && (x.is(msS) || y.is(msS)), msM) |
+			flag(x.is(msK) && y.is(msK), msK) | tl
+		if n.frag == "or_c" {
+			if y.base != 'V' {
+				return fail("Z must be V")
+			}
+			n.typ = msType{'V', props | msF}
+		} else {
+			if y.base != 'B' {
+				return fail("Z must be B")
+			}
+			n.typ = msType{'B', props | flag(y.is(msD), msD) | flag(y.is(msU), msU) | flag(y.is(msF), msF) |
+				flag(x.is(msE) && y.is(msE), msE)}
+		}
+	case "or_i":
+		if x.base != y.base || !strings.ContainsRune("BKV", rune(x.base)) {
+			return fail("X and Z must be both B, K or V")
+		}
+		n.typ = msType{x.base, flag(x.is(msZ) && y.is(msZ), msO) |
+			flag(x.is(msU) && y.is(msU), msU) |
+			flag(x.is(msD) || y.is(msD), msD) |
+			flag(x.is(msS) && y.is(msS), msS) |
+			flag(x.is(msF) && y.is(msF), msF) |
+			flag((x.is(msE) && y.is(msF)) || (y.is(msE) && x.is(msF)), msE) |
+			flag(x.is(msM) && y.is(msM) && (x.is(msS) || y.is(msS)), msM) |
+			flag(x.is(msK) && y.is(msK), msK) | tl}
+	case "thresh":
+		if n.k < 1 || int(n.k) > len(n.subs) {
+			return fail("%d of %d", n.k, len(n.subs))
+		}
+		allE, allM, numS, args := true, true, 0, 0
+		acc := msType{props: msK}
+		for i, sub := range n.subs {
+			want := byte('W')
+			if i == 0 {
+				want = 'B'
+			}
+			if sub.typ.base != want || !sub.typ.is(msD|msU) {
+				return fail("X%d must be %cdu", i+1, want)
+			}
+			allE = allE && sub.typ.is(msE)
+			allM = allM && sub.typ.is(msM)
+			if sub.typ.is(msS) {
+				numS++
+			}
+			switch {
+			case sub.typ.is(msZ):
+			case sub.typ.is(msO):
+				args++
+			default:
+				args += 2
+			}
+			noMix := acc.is(msK) && sub.typ.is(msK) && (n.k <= 1 || !msMixed(acc, sub.typ))
+			acc.props = (acc.props|sub.typ.props)&msTimelocks | flag(noMix, msK)
+		}
+		nsubs := len(n.subs)
+		n.typ = msType{'B', msD | msU | flag(args == 0, msZ) | flag(args == 1, msO) |
+			flag(allE && numS == nsubs, msE) |
+			flag(allE && allM && numS >= nsubs-int(n.k), msM) |
+			flag(numS >= nsubs-int(n.k)+1, msS) | acc.props}
+	case "multi", "multi_a":
+		if n.frag == "multi" && ctx == descTapscript {
+			return fail("use multi_a in tapscript")
+		}
+		if n.frag == "multi_a" && ctx != descTapscript {
+			return fail("multi_a is only in tapscript")
+		}
+		limit := txscript.MaxPubKeysPerMultiSig
+		if n.frag == "multi_a" {
+			limit = maxMultiAKeys
+		}
+		if n.k < 1 || int(n.k) > len(n.keys) || len(n.keys) > limit {
+			return fail("%d of %d keys, at most %d", n.k, len(n.keys), limit)
+		}
+		n.typ = msType{'B', msD | msU | msE | msS | msM | msK | flag(n.frag == "multi", msN)}
+	case "a", "s":
+		if x.base != 'B' || (n.frag == "s" && !x.is(msO)) {
+			return fail("X must be B, or Bo for s:")
+		}
+		n.typ = msType{'W', x.props & (msD | msU | msS | msF | msE | msM | msK | msTimelocks)}
+	case "c":
+		if x.base != 'K' {
+			return fail("X must be K")
+		}
+		n.typ = msType{'B', x.props&(msO|msN|msD|msF|msE|msM|msK|msTimelocks) | msU | msS}
+	case "d":
+		if x.base != 'V' || !x.is(msZ) {
+			return fail("X must be Vz")
+		}
+		// MINIMALIF of tapscript makes it unit
+		n.typ = msType{'B', msO | msN | msD | msE | x.props&(msS|msM|msK|msTimelocks) |
+			flag(ctx == descTapscript, msU)}
+	case "v":
+		if x.base != 'B' {
+			return fail("X must be B")
+		}
+		n.typ = msType{'V', x.props&(msZ|msO|msN|msS|msM|msK|msTimelocks) | msF}
+	case "j":
+		if x.base != 'B' || !x.is(msN) {
+			return fail("X must be Bn")
+		}
+		n.typ = msType{'B', msN | msD | x.props&(msO|msU|msS|msM|msK|msTimelocks) | flag(x.is(msF), msE)}
+	case "n":
+		if x.base != 'B' {
+			return fail("X must be B")
+		}
+		n.typ = msType{'B', x.props&(msZ|msO|msN|msD|msS|msF|msE|msM|msK|msTimelocks) | msU}
+	default:
+		return fail("unknown fragment")
+	}
+	return n, nil
+}
+
+func (n *msNode) String() string {
+	switch {
+	case n.frag == "0" || n.frag == "1":
+		return n.frag
+	case n.frag == "c" && n.subs[0].frag == "pk_k":
+		return "pk(" + n.subs[0].keys[0].raw + ")"
+	case n.frag == "c" && n.subs[0].frag == "pk_h":
+		return "pkh(" + n.subs[0].keys[0].raw + ")"
+	case len(n.frag) == 1:
+		return msWrapped(n.frag, n.subs[0])
+	case n.frag == "and_v" && n.subs[1].frag == "1":
+		return msWrapped("t", n.subs[0])
+	case n.frag == "or_i" && n.subs[0].frag == "0":
+		return msWrapped("l", n.subs[1])
+	case n.frag == "or_i" && n.subs[1].frag == "0":
+		return msWrapped("u", n.subs[0])
+	case n.frag == "andor" && n.subs[2].frag == "0":
+		return "and_n(" + n.subs[0].String() + "," + n.subs[1].String() + ")"
+	}
+
+	var args []string
+	switch n.frag {
+	case "older", "after", "thresh", "multi", "multi_a":
+		args = append(args, strconv.FormatUint(uint64(n.k), 10))
+	case "sha256", "hash256", "ripemd160", "hash160":
+		args = append(args, hex.EncodeToString(n.hash))
+	}
+	for _, key := range n.keys {
+		args = append(args, key.raw)
+	}
+	for _, sub := range n.subs {
+		args = append(args, sub.String())
+	}
+	return n.frag + "(" + strings.Join(args, ",") + ")"
+}
+
+// msWrapped merges the wrapper into the wrappers of the sub, like v: and c:pk_k(K) into vc:pk_k(K)
+func msWrapped(wrapper string, sub *msNode) string {
+	inner := sub.String()
+	if msWrappersEnd(inner) >= 0 {
+		return wrapper + inner
+	}
+	return wrapper + ":" + inner
+}
+
+// msWrappersEnd returns the index of the colon after the wrappers, -1 if there are no wrappers
+func msWrappersEnd(s string) int {
+	colon, open := strings.IndexByte(s, ':'), strings.IndexByte(s, '(')
+	if colon < 0 || (open >= 0 && colon > open) {
+		return -1
+	}
+	return colon
+}
+
+// msVerifyOps are the opcodes having a VERIFY version, v: uses them instead of appending OP_VERIFY
+var msVerifyOps = map[byte]byte{
+	txscript.OP_EQUAL:         txscript.OP_EQUALVERIFY,
+	txscript.OP_CHECKSIG:      txscript.OP_CHECKSIGVERIFY,
+	txscript.OP_CHECKMULTISIG: txscript.OP_CHECKMULTISIGVERIFY,
+	txscript.OP_NUMEQUAL:      txscript.OP_NUMEQUALVERIFY,
+}
+
+// script compiles the node, the key is serialized by keyFn
+func (n *msNode) script(ctx descContext, keyFn func(*descKey) ([]byte, error)) ([]byte, error) {
+	subs := make([][]byte, len(n.subs))
+	for i, sub := range n.subs {
+		script, err := sub.script(ctx, keyFn)
+		if err != nil {
+			return nil, err
+		}
+		subs[i] = script
+	}
+	keys := make([][]byte, len(n.keys))
+	for i, key := range n.keys {
+		serialized, err := keyFn(key)
+		if err != nil {
+			return nil, err
+		}
+		keys[i] = serialized
+	}
+
+	b := txscript.NewScriptBuilder()
+	switch n.frag {
+	case "0":
+		b.AddOp(txscript.OP_0)
+	case "1":
+		b.AddOp(txscript.OP_1)
+	case "pk_k":
+		b.AddData(keys[0])
+	case "pk_h":
+		b.AddOp(txscript.OP_DUP).AddOp(txscript.OP_HASH160).AddData(btcutil.Hash160(keys[0])).
+			AddOp(txscript.OP_EQUALVERIFY)
+	case "older":
+		b.AddInt64(int64(n.k)).AddOp(txscript.OP_CHECKSEQUENCEVERIFY)
+	case "after":
+		b.AddInt64(int64(n.k)).AddOp(txscript.OP_CHECKLOCKTIMEVERIFY)
+	case "sha256", "hash256", "ripemd160", "hash160":
+		op := map[string]byte{
+			"sha256": txscript.OP_SHA256, "hash256": txscript.OP_HASH256,
+			"ripemd160": txscript.OP_RIPEMD160, "hash160": txscript.OP_HASH160,
+		}[n.frag]
+		b.AddOp(txscript.OP_SIZE).AddInt64(32).AddOp(txscript.OP_EQUALVERIFY).
+			AddOp(op).AddData(n.hash).AddOp(txscript.OP_EQUAL)
+	case "andor":
+		return msConcat(subs[0], []byte{txscript.OP_NOTIF}, subs[2], []byte{txscript.OP_ELSE}, subs[1],
+			[]byte{txscript.OP_ENDIF}), nil
+	case "and_v":
+		return msConcat(subs[0], subs[1]), nil
+	case "and_b":
+		return msConcat(subs[0], subs[1], []byte{txscript.OP_BOOLAND}), nil
+	case "or_b":
+		return msConcat(subs[0], subs[1], []byte{txscript.OP_BOOLOR}), nil
+	case "or_c":
+		return msConcat(subs[0], []byte{txscript.OP_NOTIF}, subs[1], []byte{txscript.OP_ENDIF}), nil
+	case "or_d":
+		return msConcat(subs[0], []byte{txscript.OP_IFDUP, txscript.OP_NOTIF}, subs[1],
+			[]byte{txscript.OP_ENDIF}), nil
+	case "or_i":
+		return msConcat([]byte{txscript.OP_IF}, subs[0], []byte{txscript.OP_ELSE}, subs[1],
+			[]byte{txscript.OP_ENDIF}), nil
+	case "thresh":
+		script := subs[0]
+		for _, sub := range subs[1:] {
+			script = msConcat(script, sub, []byte{txscript.OP_ADD})
+		}
+		k, err := txscript.NewScriptBuilder().AddInt64(int64(n.k)).AddOp(txscript.OP_EQUAL).Script()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		return msConcat(script, k), nil
+	case "multi":
+		b.AddInt64(int64(n.k))
+		for _, key := range keys {
+			b.AddData(key)
+		}
+		b.AddInt64(int64(len(keys))).AddOp(txscript.OP_CHECKMULTISIG)
+	case "multi_a":
+		for i, key := range keys {
+			b.AddData(key)
+			if i == 0 {
+				b.AddOp(txscript.OP_CHECKSIG)
+			} else {
+				b.AddOp(txscript.OP_CHECKSIGADD)
+			}
+		}
+		b.AddInt64(int64(n.k)).AddOp(txscript.OP_NUMEQUAL)
+	case "a":
+		return msConcat([]byte{txscript.OP_TOALTSTACK}, subs[0], []byte{txscript.OP_FROMALTSTACK}), nil
+	case "s":
+		return msConcat([]byte{txscript.OP_SWAP}, subs[0]), nil
+	case "c":
+		return msConcat(subs[0], []byte{txscript.OP_CHECKSIG}), nil
+	case "d":
+		return msConcat([]byte{txscript.OP_DUP, txscript.OP_IF}, subs[0], []byte{txscript.OP_ENDIF}), nil
+	case "v":
+		// B always ends with an opcode, never with a push
+		last := len(subs[0]) - 1
+		if op, ok := msVerifyOps[subs[0][last]]; ok {
+			return msConcat(subs[0][:last], []byte{op}), nil
+		}
+		return msConcat(subs[0], []byte{txscript.OP_VERIFY}), nil
+	case "j":
+		return msConcat([]byte{txscript.OP_SIZE, txscript.OP_0NOTEQUAL, txscript.OP_IF}, subs[0],
+			[]byte{txscript.OP_ENDIF}), nil
+	case "n":
+		return msConcat(subs[0], []byte{txscript.OP_0NOTEQUAL}), nil
+	}
+
+	script, err := b.Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return script, nil
+}
+
+func msConcat(scripts ...[]byte) []byte {
+	return slices.Concat(scripts...)
+}
+
+// Satisfier has the signatures, the preimages and the timelocks to satisfy a miniscript
+type Satisfier struct {
+	// Signatures by the hex pubkey as it's in the script, x-only for tapscript
+	Signatures map[string][]byte
+	// Preimages of the hash fragments, they're matched by hashing
+	Preimages [][]byte
+	// Sequence of the input and LockTime of the transaction, older() and after() are checked against them
+	Sequence uint32
+	LockTime uint32
+
+	// estimate satisfies the timelocks and the hashes with dummies for the fee estimation,
+	// every key signs if there are no Signatures
+	estimate bool
+}
+
+func (s *Satisfier) checkOlder(n uint32) bool {
+	if s.estimate {
+		return true
+	}
+	// bip68 is disabled, or the timelocks are of different kinds
+	if s.Sequence&sequenceLockTimeDisabled != 0 || s.Sequence&sequenceLockTimeIsTime != n&sequenceLockTimeIsTime {
+		return false
+	}
+	return s.Sequence&sequenceLockTimeMask >= n&sequenceLockTimeMask
+}
+
+func (s *Satisfier) checkAfter(n uint32) bool {
+	if s.estimate {
+		return true
+	}
+	// the locktime is disabled by the final sequence
+	if s.Sequence == wire.MaxTxInSequenceNum || (s.LockTime < lockTimeThreshold) != (n < lockTimeThreshold) {
+		return false
+	}
+	return s.LockTime >= n
+}
+
+func (s *Satisfier) preimage(frag string, hash []byte) ([]byte, bool) {
+	if s.estimate {
+		return make([]byte, 32), true
+	}
+	for _, preimage := range s.Preimages {
+		if len(preimage) == 32 && bytes.Equal(msHash(frag, preimage), hash) {
+			return preimage, true
+		}
+	}
+	return nil, false
+}
+
+func msHash(frag string, preimage []byte) []byte {
+	switch frag {
+	case "sha256":
+		hash := sha256.Sum256(preimage)
+		return hash[:]
+	case "hash256":
+		return chainhash.DoubleHashB(preimage)
+	case "ripemd160":
+		hasher := ripemd160.New()
+		hasher.Write(preimage)
+		return hasher.Sum(nil)
+	default:
+		return btcutil.Hash160(preimage)
+	}
+}
+
+// msStack is a witness stack of a satisfaction or a dissatisfaction, the top is the last item
+type msStack struct {
+	ok        bool
+	items     [][]byte
+	hasSig    bool
+	malleable bool
+}
+
+var (
+	msInvalid = msStack{}
+	msEmpty   = msStack{ok: true}
+	msZero    = msStack{ok: true, items: [][]byte{{}}}
+	msOne     = msStack{ok: true, items: [][]byte{{1}}}
+)
+
+func msPush(item []byte, ok bool) msStack {
+	return msStack{ok: ok, items: [][]byte{item}}
+}
+
+func (a msStack) size() int {
+	size := 0
+	for _, item := range a.items {
+		size += wire.VarIntSerializeSize(uint64(len(item))) + len(item)
+	}
+	return size
+}
+
+func (a msStack) withSig() msStack {
+	a.hasSig = true
+	return a
+}
+
+func (a msStack) setMalleable(malleable bool) msStack {
+	a.malleable = a.malleable || malleable
+	return a
+}
+
+// then puts b on the top of a
+func (a msStack) then(b msStack) msStack {
+	return msStack{
+		ok:        a.ok && b.ok,
+		items:     slices.Concat(a.items, b.items),
+		hasSig:    a.hasSig || b.hasSig,
+		malleable: a.malleable || b.malleable,
+	}
+}
+
+// msChoose picks the best of the stacks like Bitcoin Core does, a third party can always pick
+// the one without signature, so it's the only safe choice
+func msChoose(stacks ...msStack) msStack {
+	best := stacks[0]
+	for _, b := range stacks[1:] {
+		a := best
+		switch {
+		case !a.ok:
+			best = b
+		case !b.ok:
+		case !a.hasSig && b.hasSig:
+		case a.hasSig && !b.hasSig:
+			best = b
+		default:
+			if !a.hasSig && !b.hasSig {
+				// neither needs a signature, the choice is malleable
+				a.malleable, b.malleable = true, true
+			} else if a.malleable != b.malleable {
+				if a.malleable {
+					best = b
+				}
+				continue
+			}
+			best = a
+			if b.size() < a.size() {
+				best = b
+			}
+		}
+	}
+	return best
+}
+
+// msChooseMax picks the largest available stack
+func msChooseMax(stacks ...msStack) msStack {
+	best := stacks[0]
+	for _, b := range stacks[1:] {
+		if !best.ok || (b.ok && b.size() > best.size()) {
+			best = b
+		}
+	}
+	return best
+}
+
+// satisfy returns the dissatisfaction and the satisfaction of the node
+func (n *msNode) satisfy(ctx descContext, keyFn func(*descKey) ([]byte, error), s *Satisfier) (msStack, msStack, error) {
+	subs := make([][2]msStack, len(n.subs))
+	for i, sub := range n.subs {
+		dsat, sat, err := sub.satisfy(ctx, keyFn, s)
+		if err != nil {
+			return msInvalid, msInvalid, err
+		}
+		subs[i] = [2]msStack{dsat, sat}
+	}
+	// the estimation takes the largest satisfaction so the fee never falls short
+	choose := msChoose
+	if s.estimate {
+		choose = msChooseMax
+	}
+	sign := func(key *descKey) (msStack, []byte, error) {
+		pubkey, err := keyFn(key)
+		if err != nil {
+			return msInvalid, nil, err
+		}
+		sig, ok := s.Signatures[hex.EncodeToString(pubkey)]
+		if s.estimate && s.Signatures == nil {
+			sig, ok = make([]byte, MaxECDSASigSize), true
+			if ctx == descTapscript {
+				sig = make([]byte, SchnorrSigSize)
+			}
+		}
+		return msPush(sig, ok).withSig(), pubkey, nil
+	}
+
+	switch n.frag {
+	case "0":
+		return msEmpty, msInvalid, nil
+	case "1":
+		return msInvalid, msEmpty, nil
+	case "pk_k":
+		sig, _, err := sign(n.keys[0])
+		return msZero, sig, err
+	case "pk_h":
+		sig, pubkey, err := sign(n.keys[0])
+		key := msPush(pubkey, true)
+		return msZero.then(key), sig.then(key), err
+	case "older":
+		if s.checkOlder(n.k) {
+			return msInvalid, msEmpty, nil
+		}
+		return msInvalid, msInvalid, nil
+	case "after":
+		if s.checkAfter(n.k) {
+			return msInvalid, msEmpty, nil
+		}
+		return msInvalid, msInvalid, nil
+	case "sha256", "hash256", "ripemd160", "hash160":
+		preimage, ok := s.preimage(n.frag, n.hash)
+		return msPush(make([]byte, 32), true).setMalleable(true), msPush(preimage, ok), nil
+	case "multi":
+		// sats[j] has j signatures of the keys so far, the first signature is the deepest
+		sats := []msStack{msZero}
+		for _, key := range n.keys {
+			sig, _, err := sign(key)
+			if err != nil {
+				return msInvalid, msInvalid, err
+			}
+			next := []msStack{sats[0]}
+			for j := 1; j < len(sats); j++ {
+				next = append(next, choose(sats[j], sats[j-1].then(sig)))
+			}
+			sats = append(next, sats[len(sats)-1].then(sig))
+		}
+		dsat := msZero
+		for range n.k {
+			dsat = dsat.then(msZero)
+		}
+		return dsat, sats[n.k], nil
+	case "multi_a":
+		// the signature of the first key is at the top
+		sats := []msStack{msEmpty}
+		for i := len(n.keys) - 1; i >= 0; i-- {
+			sig, _, err := sign(n.keys[i])
+			if err != nil {
+				return msInvalid, msInvalid, err
+			}
+			next := []msStack{sats[0].then(msZero)}
+			for j := 1; j < len(sats); j++ {
+				next = append(next, choose(sats[j].then(msZero), sats[j-1].then(sig)))
+			}
+			sats = append(next, sats[len(sats)-1].then(sig))
+		}
+		return sats[0], sats[n.k], nil
+	case "thresh":
+		// sats[j] satisfies j of the subs so far and dissatisfies the others
+		sats := []msStack{msEmpty}
+		for i := len(subs) - 1; i >= 0; i-- {
+			dsat, sat := subs[i][0], subs[i][1]
+			next := []msStack{sats[0].then(dsat)}
+			for j := 1; j < len(sats); j++ {
+				next = append(next, choose(sats[j].then(dsat), sats[j-1].then(sat)))
+			}
+			sats = append(next, sats[len(sats)-1].then(sat))
+		}
+		dsat := msInvalid
+		for i, stack := range sats {
+			if i != 0 && i != int(n.k) {
+				stack = stack.setMalleable(true)
+			}
+			if i != int(n.k) {
+				dsat = choose(dsat, stack)
+			}
+		}
+		return dsat, sats[n.k], nil
+	}
+
+	var x, y, z [2]msStack
+	if len(subs) > 0 {
+		x = subs[0]
+	}
+	if len(subs) > 1 {
+		y = subs[1]
+	}
+	if len(subs) > 2 {
+		z = subs[2]
+	}
+	const dsat, sat = 0, 1
+	switch n.frag {
+	case "andor":
+		return choose(y[dsat].then(x[sat]), z[dsat].then(x[dsat])),
+			choose(y[sat].then(x[sat]), z[sat].then(x[dsat])), nil
+	case "and_v":
+		return y[dsat].then(x[sat]), y[sat].then(x[sat]), nil
+	case "and_b":
+		return choose(y[dsat].then(x[dsat]), y[sat].then(x[dsat]).setMalleable(true),
+				y[dsat].then(x[sat]).setMalleable(true)),
+			y[sat].then(x[sat]), nil
+	case "or_b":
+		return y[dsat].then(x[dsat]),
+			choose(y[dsat].then(x[sat]), y[sat].then(x[dsat]), y[sat].then(x[sat]).setMalleable(true)), nil
+	case "or_c":
+		return msInvalid, choose(x[sat], y[sat].then(x[dsat])), nil
+	case "or_d":
+		return y[dsat].then(x[dsat]), choose(x[sat], y[sat].then(x[dsat])), nil
+	case "or_i":
+		return choose(x[dsat].then(msOne), y[dsat].then(msZero)),
+			choose(x[sat].then(msOne), y[sat].then(msZero)), nil
+	case "a", "s", "c", "n":
+		return x[dsat], x[sat], nil
+	case "d":
+		return msZero, x[sat].then(msOne), nil
+	case "v":
+		return msInvalid, x[sat], nil
+	case "j":
+		return msZero.setMalleable(x[dsat].ok && !x[dsat].hasSig), x[sat], nil
+	}
+	return msInvalid, msInvalid, fmt.Errorf("%w: unknown fragment %s", ErrInvalidMiniscript, n.frag)
+}
+
+// Satisfy builds the non-malleable witness items of the script, the script itself is not included
+func (m *Miniscript) Satisfy(s *Satisfier) ([][]byte, error) {
+	return m.node.satisfyTop(m.ctx(), func(key *descKey) ([]byte, error) {
+		return m.serializeKey(key)
+	}, s)
+}
+
+// signMiniscript signs the miniscript of the utxo with all the keys in it and builds the witness
+func signMiniscript(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, utxo *UTXO) (wire.TxWitness, error) {
+	m := utxo.Miniscript
+	if m == nil {
+		return nil, fmt.Errorf("%w: no miniscript", ErrInvalidMiniscript)
+	}
+	script, err := m.Script()
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(script, utxo.Script) {
+		return nil, fmt.Errorf("%w: the script isn't compiled from %s", ErrInvalidMiniscript, m)
+	}
+
+	s := &Satisfier{
+		Signatures: make(map[string][]byte),
+		Sequence:   tx.TxIn[idx].Sequence,
+		LockTime:   tx.LockTime,
+	}
+	if utxo.Preimage != nil {
+		s.Preimages = [][]byte{utxo.Preimage}
+	}
+	leaf := txscript.NewBaseTapLeaf(script)
+	for _, prvkey := range utxo.Keys {
+		pubkey := m.scriptPubKey(script, prvkey.PubKey())
+		if pubkey == nil {
+			continue
+		}
+		var sig []byte
+		if m.tapscript {
+			sig, err = txscript.RawTxInTapscriptSignature(tx, sigHashes, idx, utxo.Amount, utxo.PkScript,
+				leaf, txscript.SigHashDefault, prvkey)
+		} else {
+			sig, err = txscript.RawTxInWitnessSignature(tx, sigHashes, idx, utxo.Amount,
+				script, txscript.SigHashAll, prvkey)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.Signatures[hex.EncodeToString(pubkey)] = sig
+	}
+
+	items, err := m.Satisfy(s)
+	if err != nil {
+		return nil, err
+	}
+	if m.tapscript {
+		return append(items, script, utxo.ControlBlock), nil
+	}
+	return append(items, script), nil
+}
+
+// scriptPubKey returns the serialization of the pubkey in the script, either pushed or hashed,
+// nil if the script doesn't have it
+func (m *Miniscript) scriptPubKey(script []byte, pubkey *btcec.PublicKey) []byte {
+	if !m.tapscript {
+		return signingPubKey(script, pubkey)
+	}
+	xonly := schnorr.SerializePubKey(pubkey)
+	if scriptHasData(script, xonly) || scriptHasData(script, btcutil.Hash160(xonly)) {
+		return xonly
+	}
+	return nil
+}
+
+// estimateItems are the sizes of the witness items signed by the keys of the utxo, or by any key
+// without the keys, the timelocks and the hashes are assumed to be satisfied
+func (m *Miniscript) estimateItems(utxo *UTXO) ([]int, error) {
+	script, err := m.Script()
+	if err != nil {
+		return nil, err
+	}
+	s := &Satisfier{estimate: true}
+	for _, prvkey := range utxo.Keys {
+		if pubkey := m.scriptPubKey(script, prvkey.PubKey()); pubkey != nil {
+			if s.Signatures == nil {
+				s.Signatures = make(map[string][]byte)
+			}
+			sigSize := MaxECDSASigSize
+			if m.tapscript {
+				sigSize = SchnorrSigSize
+			}
+			s.Signatures[hex.EncodeToString(pubkey)] = make([]byte, sigSize)
+		}
+	}
+
+	items, err := m.Satisfy(s)
+	if err != nil {
+		return nil, err
+	}
+	sizes := make([]int, 0, len(items))
+	for _, item := range items {
+		sizes = append(sizes, len(item))
+	}
+	return sizes, nil
+}
+
+func (n *msNode) satisfyTop(ctx descContext, keyFn func(*descKey) ([]byte, error), s *Satisfier) ([][]byte, error) {
+	_, sat, err := n.satisfy(ctx, keyFn, s)
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case !sat.ok:
+		return nil, fmt.Errorf("%w: not enough signatures, preimages or timelocks", ErrInvalidMiniscript)
+	case !s.estimate && (sat.malleable || !sat.hasSig):
+		return nil, fmt.Errorf("%w: the satisfaction is malleable", ErrInvalidMiniscript)
+	}
+	return sat.items, nil
+}
+
+// NewPsbtSatisfier collects the signatures and the preimages of the psbt input for the leaf,
+// leafScript is nil for p2wsh
+func NewPsbtSatisfier(packet *psbt.Packet, idx int, leafScript []byte) *Satisfier {
+	pin := &packet.Inputs[idx]
+	s := &Satisfier{
+		Signatures: make(map[string][]byte),
+		Sequence:   packet.UnsignedTx.TxIn[idx].Sequence,
+		LockTime:   packet.UnsignedTx.LockTime,
+	}
+	for _, partialSig := range pin.PartialSigs {
+		s.Signatures[hex.EncodeToString(partialSig.PubKey)] = partialSig.Signature
+	}
+	if leafScript != nil {
+		leafHash := txscript.NewBaseTapLeaf(leafScript).TapHash()
+		for _, spendSig := range pin.TaprootScriptSpendSig {
+			if bytes.Equal(spendSig.LeafHash, leafHash[:]) {
+				s.Signatures[hex.EncodeToString(spendSig.XOnlyPubKey)] = schnorrSigWithHashType(spendSig.Signature,
+					spendSig.SigHash)
+			}
+		}
+	}
+
+	hashTypes := map[byte]string{
+		psbtInRipemd160: "ripemd160", psbtInSha256: "sha256", psbtInHash160: "hash160", psbtInHash256: "hash256",
+	}
+	for _, unknown := range pin.Unknowns {
+		if len(unknown.Key) == 0 {
+			continue
+		}
+		if frag, ok := hashTypes[unknown.Key[0]]; ok && bytes.Equal(unknown.Key[1:], msHash(frag, unknown.Value)) {
+			s.Preimages = append(s.Preimages, unknown.Value)
+		}
+	}
+	return s
+}
+
+// FinalizePsbtMiniscript finalizes the p2wsh or tapscript input spending the miniscript and runs it
+// through the script engine, the whole extracted tx once every input is final.
+// The other inputs are finalized by FinalizePsbt.
+func FinalizePsbtMiniscript(packet *psbt.Packet, idx int, m *Miniscript) error {
+	if idx < 0 || idx >= len(packet.Inputs) {
+		return fmt.Errorf("%w: no input %d", ErrInvalidPsbt, idx)
+	}
+	pin := &packet.Inputs[idx]
+	script, err := m.Script()
+	if err != nil {
+		return err
+	}
+
+	var witness wire.TxWitness
+	if m.tapscript {
+		i := slices.IndexFunc(pin.TaprootLeafScript, func(leaf *psbt.TaprootTapLeafScript) bool {
+			return bytes.Equal(leaf.Script, script)
+		})
+		if i < 0 {
+			return fmt.Errorf("%w: the leaf of input %d isn't %s", ErrInvalidPsbt, idx, m)
+		}
+		items, err := m.Satisfy(NewPsbtSatisfier(packet, idx, script))
+		if err != nil {
+			return fmt.Errorf("finalize input %d: %w", idx, err)
+		}
+		witness = append(items, script, pin.TaprootLeafScript[i].ControlBlock)
+	} else {
+		if !bytes.Equal(pin.WitnessScript, script) {
+			return fmt.Errorf("%w: the witness script of input %d isn't %s", ErrInvalidPsbt, idx, m)
+		}
+		items, err := m.Satisfy(NewPsbtSatisfier(packet, idx, nil))
+		if err != nil {
+			return fmt.Errorf("finalize input %d: %w", idx, err)
+		}
+		witness = append(items, script)
+	}
+
+	var sigScript []byte
+	if pin.RedeemScript != nil {
+		// p2wsh nested in p2sh
+		if sigScript, err = txscript.NewScriptBuilder().AddData(pin.RedeemScript).Script(); err != nil {
+			return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+	}
+
+	unfinalized := *pin
+	if err := setPsbtFinal(pin, sigScript, witness); err != nil {
+		return err
+	}
+	if err := verifyPsbt(packet); err != nil {
+		*pin = unfinalized
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,199 @@
+package example
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// testPreimage is the preimage of H, miniscript only takes 32 bytes preimages
+var testPreimage = bytes.Repeat([]byte{9}, 32)
+
+// testMiniscript replaces the keys A, B, C and the hash H of the sha256 preimage in the expression
+func testMiniscript(t *testing.T, expr string, policy, tapscript bool) *Miniscript {
+	t.Helper()
+	serialize := func(i byte) string {
+		if tapscript {
+			return hex.EncodeToString(schnorr.SerializePubKey(testKey(i).PubKey()))
+		}
+		return hex.EncodeToString(testKey(i).PubKey().SerializeCompressed())
+	}
+	hash := sha256.Sum256(testPreimage)
+	expr = strings.NewReplacer("A", serialize(1), "B", serialize(2), "C", serialize(3),
+		"H", hex.EncodeToString(hash[:])).Replace(expr)
+
+	var (
+		m   *Miniscript
+		err error
+	)
+	if policy {
+		m, err = CompilePolicy(expr, tapscript, testNet)
+	} else {
+		m, err = ParseMiniscript(expr, tapscript, testNet)
+	}
+	if err != nil {
+		t.Fatalf("%s: %v", expr, err)
+	}
+	return m
+}
+
+// testMiniscriptUTXO is the p2wsh output of the miniscript or the taproot output of the single leaf
+func testMiniscriptUTXO(t *testing.T, m *Miniscript, tapscript bool) *UTXO {
+	t.Helper()
+	script, err := m.Script()
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxo := &UTXO{
+		OutPoint:   testPool(100000)[0].OutPoint,
+		Amount:     100000,
+		SpendType:  SpendMiniscript,
+		Script:     script,
+		Miniscript: m,
+	}
+	if !tapscript {
+		program := sha256.Sum256(script)
+		utxo.PkScript = append([]byte{txscript.OP_0, txscript.OP_DATA_32}, program[:]...)
+		return utxo
+	}
+
+	tree := txscript.AssembleTaprootScriptTree(txscript.NewBaseTapLeaf(script))
+	internalKey := testKey(7).PubKey()
+	root := tree.RootNode.TapHash()
+	if utxo.PkScript, err = txscript.PayToTaprootScript(txscript.ComputeTaprootOutputKey(internalKey, root[:])); err != nil {
+		t.Fatal(err)
+	}
+	controlBlock := tree.LeafMerkleProofs[0].ToControlBlock(internalKey)
+	if utxo.ControlBlock, err = controlBlock.ToBytes(); err != nil {
+		t.Fatal(err)
+	}
+	return utxo
+}
+
+func TestMiniscriptSatisfy(t *testing.T) {
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(testKey(9).PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		expr     string
+		policy   bool
+		signers  []byte
+		sequence uint32
+		lockTime uint32
+		preimage bool
+		fail     bool
+	}{
+		{expr: "pk(A)", signers: []byte{1}},
+		{expr: "pk(A)", signers: []byte{2}, fail: true},
+		{expr: "or(9@pk(A),1@and(pk(B),older(10)))", policy: true, signers: []byte{1}},
+		{expr: "or(9@pk(A),1@and(pk(B),older(10)))", policy: true, signers: []byte{2}, sequence: 10},
+		{expr: "or(9@pk(A),1@and(pk(B),older(10)))", policy: true, signers: []byte{2}, sequence: 9, fail: true},
+		{expr: "thresh(2,pk(A),pk(B),pk(C))", policy: true, signers: []byte{1, 3}},
+		{expr: "or(pk(A),and(pk(B),sha256(H)))", policy: true, signers: []byte{2}, preimage: true},
+		{expr: "or(pk(A),and(pk(B),sha256(H)))", policy: true, signers: []byte{2}, fail: true},
+		{expr: "and(pk(A),or(pk(B),after(100)))", policy: true, signers: []byte{1}, lockTime: 100, sequence: 0xfffffffe},
+		{expr: "and(pk(A),or(pk(B),after(100)))", policy: true, signers: []byte{1}, lockTime: 99, sequence: 0xfffffffe, fail: true},
+		{expr: "andor(pk(A),older(5),pk(B))", signers: []byte{2}},
+		{expr: "or_b(pk(A),s:pk(B))", signers: []byte{2}},
+		{expr: "thresh(2,pk(A),s:pk(B),sln:older(3))", signers: []byte{2}, sequence: 3},
+	} {
+		for _, tapscript := range []bool{false, true} {
+			m := testMiniscript(t, test.expr, test.policy, tapscript)
+
+			// the miniscript parses back to the same script
+			again, err := ParseMiniscript(m.String(), tapscript, testNet)
+			if err != nil {
+				t.Fatalf("%s: %v", m, err)
+			}
+			script, _ := m.Script()
+			if againScript, _ := again.Script(); !bytes.Equal(script, againScript) {
+				t.Errorf("%s: round trip %s", m, again)
+			}
+
+			utxo := testMiniscriptUTXO(t, m, tapscript)
+			utxo.Sequence = test.sequence
+			for _, i := range test.signers {
+				utxo.Keys = append(utxo.Keys, testKey(i))
+			}
+			if test.preimage {
+				utxo.Preimage = testPreimage
+			}
+			builder := &TxBuilder{
+				LockTime:      test.lockTime,
+				Inputs:        []*UTXO{utxo},
+				Recipients:    []*Recipient{{Address: address, Amount: 50000}},
+				ChangeAddress: address,
+				FeeRate:       3,
+			}
+			// Build runs the script engine on the satisfaction
+			_, err = builder.Build()
+			if test.fail != (err != nil) {
+				t.Errorf("%s tapscript %t: %v", m, tapscript, err)
+			}
+		}
+	}
+}
+
+func TestFinalizePsbtMiniscript(t *testing.T) {
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(testKey(9).PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tapscript := range []bool{false, true} {
+		m := testMiniscript(t, "or(pk(A),and(pk(B),sha256(H)))", true, tapscript)
+		utxo := testMiniscriptUTXO(t, m, tapscript)
+		packet, err := (&TxBuilder{
+			Inputs:        []*UTXO{utxo},
+			Recipients:    []*Recipient{{Address: address, Amount: 50000}},
+			ChangeAddress: address,
+			FeeRate:       3,
+		}).BuildPsbt()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := SignPsbt(packet, testKey(2)); err != nil {
+			t.Fatal(err)
+		}
+
+		// bob's signature alone doesn't satisfy the miniscript, the preimage comes in the psbt
+		if err := FinalizePsbtMiniscript(packet, 0, m); err == nil {
+			t.Fatal("finalized without the preimage")
+		}
+		hash := sha256.Sum256(testPreimage)
+		packet.Inputs[0].Unknowns = append(packet.Inputs[0].Unknowns, &psbt.Unknown{
+			Key:   append([]byte{psbtInSha256}, hash[:]...),
+			Value: testPreimage,
+		})
+		if err := FinalizePsbtMiniscript(packet, 0, m); err != nil {
+			t.Fatalf("tapscript %t: %v", tapscript, err)
+		}
+		if _, err := psbt.Extract(packet); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestParseMiniscriptInvalid(t *testing.T) {
+	pubkey := hex.EncodeToString(testKey(1).PubKey().SerializeCompressed())
+	for _, expr := range []string{
+		"older(1)",
+		"or_i(pk(A),sha256(H))",
+		"and_v(v:after(100),after(500000001))",
+		"v:pk(A)",
+		"multi(2,A)",
+	} {
+		expr = strings.NewReplacer("A", pubkey, "H", strings.Repeat("00", 32)).Replace(expr)
+		if _, err := ParseMiniscript(expr, false, testNet); err == nil {
+			t.Errorf("%s is accepted", expr)
+		}
+	}
+}
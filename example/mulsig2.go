@@ -1,107 +1,152 @@
 package example
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
-func MuSig2(alice, bob *btcec.PrivateKey,
-	prevTxid *chainhash.Hash, prevPkScript []byte, prevTxout int, prevAmountSat, curAmountSat int64) *wire.MsgTx {
-	newtx := wire.NewMsgTx(2)
-
-	pubkeyList := []*btcec.PublicKey{alice.PubKey(), bob.PubKey()}
+func MuSig2(netwk *chaincfg.Params, alice, bob *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newMuSig2Builder(netwk, alice.PubKey(), bob.PubKey(), pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	// alice and bob sign the utxos of the address together
+	withKeys(builder.Pool, alice, bob)
+	return builder.Build()
+}
 
-	aliceCtx, err := musig2.NewContext(alice, true,
-		musig2.WithBip86TweakCtx(),
-		musig2.WithEarlyNonceGen(),
-		musig2.WithKnownSigners(pubkeyList),
-	)
+// MuSig2Psbt creates the psbt of MuSig2 with the participants of BIP373, the cosigners sign it
+// by PsbtMuSig2Nonce and SignPsbtMuSig2Partial
+func MuSig2Psbt(netwk *chaincfg.Params, alice, bob *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newMuSig2Builder(netwk, alice, bob, pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	return builder.BuildPsbt()
+}
+
+func newMuSig2Builder(netwk *chaincfg.Params, alice, bob *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	pubkeyList := []*btcec.PublicKey{alice, bob}
 
-	aliceSession, err := aliceCtx.NewSession()
+	// we use bip86, if not so, use `WithTaprootKeyTweak` instead
+	aggKey, _, _, err := musig2.AggregateKeys(pubkeyList, true, musig2.WithBIP86KeyTweak())
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
 	}
 
-	bobCtx, err := musig2.NewContext(bob, true,
-		musig2.WithBip86TweakCtx(), // bip86
-		musig2.WithEarlyNonceGen(),
-		musig2.WithKnownSigners(pubkeyList),
-	)
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(aggKey.FinalKey), netwk)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
+	fmt.Println("MuSig2 Address:", address)
 
-	bobSession, err := bobCtx.NewSession()
+	output, err := txscript.PayToAddrScript(address)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	// txout to p2pr
-	{
-		// we use bip86, if not so, use `aliceCtx.TaprootInternalKey()` instead
-		taprootKey, err := aliceCtx.CombinedKey()
-		if err != nil {
-			panic(err)
-		}
+	return &TxBuilder{
+		Pool: spendFrom(pool, UTXO{
+			PkScript:       output,
+			SpendType:      SpendMuSig2,
+			TapInternalKey: aggKey.PreTweakedKey,
+			MuSig2Signers:  pubkeyList,
+		}),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
+}
 
-		output, err := txscript.NewScriptBuilder().
-			AddOp(txscript.OP_1).
-			AddData(schnorr.SerializePubKey(taprootKey)).
-			Script()
-		if err != nil {
-			panic(err)
-		}
-		txout := wire.NewTxOut(curAmountSat, output)
-		newtx.AddTxOut(txout)
+// MuSig2InternalKey aggregates the pubkeys without tweak, it's the internal key of a taproot output
+// with a script tree, the cosigners spend the key path together or any leaf by the script path
+func MuSig2InternalKey(pubkeys ...*btcec.PublicKey) (*btcec.PublicKey, error) {
+	aggKey, _, _, err := musig2.AggregateKeys(pubkeys, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
 	}
+	return aggKey.PreTweakedKey, nil
+}
 
-	// txin, spend p2pr output
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxid, uint32(prevTxout)), nil, nil)
-		newtx.AddTxIn(txin)
+// signMuSig2 runs all the signers of a musig2 output in process,
+// the aggregate key is tweaked by the merkle root of the script tree or by bip86 without tree
+func signMuSig2(tx *wire.MsgTx, fetcher txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes,
+	idx int, keys []*btcec.PrivateKey, merkleRoot []byte) (wire.TxWitness, error) {
+	pubkeyList := make([]*btcec.PublicKey, 0, len(keys))
+	for _, prvkey := range keys {
+		pubkeyList = append(pubkeyList, prvkey.PubKey())
+	}
 
-		fetcher := txscript.NewCannedPrevOutputFetcher(prevPkScript, prevAmountSat)
+	tweak := musig2.WithBip86TweakCtx()
+	if merkleRoot != nil {
+		tweak = musig2.WithTaprootTweakCtx(merkleRoot)
+	}
 
-		sigHash, err := txscript.CalcTaprootSignatureHash(
-			txscript.NewTxSigHashes(newtx, fetcher),
-			txscript.SigHashDefault, newtx, 0, fetcher,
-		)
+	// every signer has its own context and session, the nonces must never be reused
+	sessions := make([]*musig2.Session, 0, len(keys))
+	for _, prvkey := range keys {
+		ctx, err := musig2.NewContext(prvkey, true, tweak, musig2.WithKnownSigners(pubkeyList))
 		if err != nil {
-			panic(err)
+			return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
 		}
 
-		aliceSig, err := aliceSession.Sign([32]byte(sigHash))
+		session, err := ctx.NewSession()
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		sessions = append(sessions, session)
+	}
 
-		bobSig, err := bobSession.Sign([32]byte(sigHash))
-		if err != nil {
-			panic(err)
+	// exchange the public nonces
+	for i, session := range sessions {
+		for j, other := range sessions {
+			if i == j {
+				continue
+			}
+			if _, err := session.RegisterPubNonce(other.PublicNonce()); err != nil {
+				return nil, err
+			}
 		}
+	}
 
-		if _, err := aliceSession.CombineSig(bobSig); err != nil {
-			panic(err)
-		}
+	sigHash, err := txscript.CalcTaprootSignatureHash(sigHashes, txscript.SigHashDefault, tx, idx, fetcher)
+	if err != nil {
+		return nil, err
+	}
 
-		if _, err := bobSession.CombineSig(aliceSig); err != nil {
-			panic(err)
+	partialSigs := make([]*musig2.PartialSignature, 0, len(sessions))
+	for _, session := range sessions {
+		sig, err := session.Sign([32]byte(sigHash))
+		if err != nil {
+			return nil, err
 		}
+		partialSigs = append(partialSigs, sig)
+	}
 
-		if !aliceSession.FinalSig().IsEqual(bobSession.FinalSig()) {
-			panic("inconsistent signature")
+	// everyone can combine the partial signatures, the first signer does it here
+	for _, sig := range partialSigs[1:] {
+		if _, err := sessions[0].CombineSig(sig); err != nil {
+			return nil, err
 		}
+	}
 
-		// default sign type
-		txin.Witness = wire.TxWitness{aliceSession.FinalSig().Serialize()}
+	finalSig := sessions[0].FinalSig()
+	if finalSig == nil {
+		return nil, errors.New("incomplete signature")
 	}
 
-	return newtx
+	// default sign type
+	return wire.TxWitness{finalSig.Serialize()}, nil
 }
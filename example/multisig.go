@@ -0,0 +1,218 @@
+package example
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// MultiSigType is the output type of a m-of-n multisig
+type MultiSigType uint8
+
+const (
+	MultiSigP2SH MultiSigType = iota + 1
+	MultiSigP2SHP2WSH
+	MultiSigP2WSH
+	// MultiSigTapscript is a multi_a leaf behind the NUMS internal key
+	MultiSigTapscript
+)
+
+func (t MultiSigType) String() string {
+	switch t {
+	case MultiSigP2SH:
+		return "p2sh"
+	case MultiSigP2SHP2WSH:
+		return "p2sh-p2wsh"
+	case MultiSigP2WSH:
+		return "p2wsh"
+	case MultiSigTapscript:
+		return "tapscript"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// maxKeys is the standardness limit of the pubkeys
+func (t MultiSigType) maxKeys() int {
+	switch t {
+	case MultiSigP2SH:
+		return maxP2SHMultiSigKeys
+	case MultiSigTapscript:
+		return maxMultiAKeys
+	default:
+		return txscript.MaxPubKeysPerMultiSig
+	}
+}
+
+// MultiSigTx pays to the m-of-n multisig of the pubkeys from the utxos of the same multisig,
+// the signers are any threshold of the cosigners
+func MultiSigTx(netwk *chaincfg.Params, typ MultiSigType, threshold int, pubkeys []*btcec.PublicKey,
+	signers []*btcec.PrivateKey, pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newMultiSigBuilder(netwk, typ, threshold, pubkeys, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	withKeys(builder.Pool, signers...)
+	return builder.Build()
+}
+
+// MultiSigPsbt creates the psbt of MultiSigTx, any threshold of the cosigners sign it
+func MultiSigPsbt(netwk *chaincfg.Params, typ MultiSigType, threshold int, pubkeys []*btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newMultiSigBuilder(netwk, typ, threshold, pubkeys, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+func newMultiSigBuilder(netwk *chaincfg.Params, typ MultiSigType, threshold int, pubkeys []*btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	spend, address, err := multiSigOutput(netwk, typ, threshold, pubkeys)
+	if err != nil {
+		return nil, err
+	}
+	fmt.Printf("%d-of-%d %s address: %s\n", threshold, len(pubkeys), typ, address)
+
+	spend.Sequence = wire.MaxTxInSequenceNum - 5 // let it be replaceable
+	return &TxBuilder{
+		Pool:          spendFrom(pool, *spend),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
+}
+
+// multiSigOutput returns the utxo template and the address of the multisig
+func multiSigOutput(netwk *chaincfg.Params, typ MultiSigType, threshold int,
+	pubkeys []*btcec.PublicKey) (*UTXO, btcutil.Address, error) {
+	if len(pubkeys) > typ.maxKeys() {
+		return nil, nil, fmt.Errorf("%w: %d pubkeys of %s multisig, at most %d",
+			ErrScriptBuild, len(pubkeys), typ, typ.maxKeys())
+	}
+
+	var (
+		spend   UTXO
+		address btcutil.Address
+		err     error
+	)
+	switch typ {
+	case MultiSigP2SH, MultiSigP2SHP2WSH, MultiSigP2WSH:
+		if spend.Script, err = SortedMultiSigScript(threshold, pubkeys); err != nil {
+			return nil, nil, err
+		}
+		witnessProg := sha256.Sum256(spend.Script)
+		switch typ {
+		case MultiSigP2SH:
+			spend.SpendType = SpendP2SHMultiSig
+			address, err = btcutil.NewAddressScriptHash(spend.Script, netwk)
+		case MultiSigP2SHP2WSH:
+			spend.SpendType = SpendP2SHP2WSHMultiSig
+			address, err = btcutil.NewAddressScriptHash(p2wshProgram(spend.Script), netwk)
+		default:
+			spend.SpendType = SpendP2WSHMultiSig
+			address, err = btcutil.NewAddressWitnessScriptHash(witnessProg[:], netwk)
+		}
+	case MultiSigTapscript:
+		if spend.Script, err = SortedMultiATapscript(threshold, pubkeys); err != nil {
+			return nil, nil, err
+		}
+		tree := &TapTree{Leaf: &txscript.TapLeaf{LeafVersion: txscript.BaseLeafVersion, Script: spend.Script}}
+		leafSpend, err := tree.spend(NothingInMySleeve, 0)
+		if err != nil {
+			return nil, nil, err
+		}
+		spend.SpendType = leafSpend.SpendType
+		spend.ControlBlock = leafSpend.ControlBlock
+		address, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(tree.OutputKey(NothingInMySleeve)), netwk)
+	default:
+		return nil, nil, fmt.Errorf("%w: unknown multisig type %s", ErrScriptBuild, typ)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	if spend.PkScript, err = txscript.PayToAddrScript(address); err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return &spend, address, nil
+}
+
+// SortedMultiSigScript creates `m <pubkey>... n OP_CHECKMULTISIG` with the compressed pubkeys
+// sorted lexicographically
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0067.mediawiki
+func SortedMultiSigScript(threshold int, pubkeys []*btcec.PublicKey) ([]byte, error) {
+	if err := checkMultiSig(threshold, len(pubkeys), txscript.MaxPubKeysPerMultiSig); err != nil {
+		return nil, err
+	}
+
+	serialized := make([][]byte, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		serialized = append(serialized, pubkey.SerializeCompressed())
+	}
+	slices.SortFunc(serialized, bytes.Compare)
+
+	builder := txscript.NewScriptBuilder().AddInt64(int64(threshold))
+	for _, pubkey := range serialized {
+		builder.AddData(pubkey)
+	}
+	script, err := builder.AddInt64(int64(len(pubkeys))).AddOp(txscript.OP_CHECKMULTISIG).Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return script, nil
+}
+
+// SortedMultiATapscript creates the multi_a leaf
+// `<pubkey_1> OP_CHECKSIG <pubkey_2> OP_CHECKSIGADD ... <pubkey_n> OP_CHECKSIGADD m OP_NUMEQUAL`
+// with the x-only pubkeys sorted lexicographically like sortedmulti_a of BIP387
+func SortedMultiATapscript(threshold int, pubkeys []*btcec.PublicKey) ([]byte, error) {
+	if err := checkMultiSig(threshold, len(pubkeys), maxMultiAKeys); err != nil {
+		return nil, err
+	}
+
+	serialized := make([][]byte, 0, len(pubkeys))
+	for _, pubkey := range pubkeys {
+		serialized = append(serialized, schnorr.SerializePubKey(pubkey))
+	}
+	slices.SortFunc(serialized, bytes.Compare)
+
+	builder := txscript.NewScriptBuilder()
+	for i, pubkey := range serialized {
+		builder.AddData(pubkey)
+		if i == 0 {
+			builder.AddOp(txscript.OP_CHECKSIG)
+		} else {
+			builder.AddOp(txscript.OP_CHECKSIGADD)
+		}
+	}
+	script, err := builder.AddInt64(int64(threshold)).AddOp(txscript.OP_NUMEQUAL).Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return script, nil
+}
+
+// checkMultiSig rejects a threshold out of 1..n and more than limit pubkeys
+func checkMultiSig(threshold, n, limit int) error {
+	if threshold < 1 || threshold > n || n > limit {
+		return fmt.Errorf("%w: %d-of-%d multisig, at most %d pubkeys", ErrScriptBuild, threshold, n, limit)
+	}
+	return nil
+}
+
+// p2wshProgram is `OP_0 <sha256(witnessScript)>`, the redeem script of p2sh-p2wsh
+func p2wshProgram(witnessScript []byte) []byte {
+	witnessProg := sha256.Sum256(witnessScript)
+	return append([]byte{txscript.OP_0, txscript.OP_DATA_32}, witnessProg[:]...)
+}
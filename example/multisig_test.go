@@ -0,0 +1,112 @@
+package example
+
+import (
+	"encoding/hex"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+)
+
+func TestMultiSigTx(t *testing.T) {
+	var keys []*btcec.PrivateKey
+	var pubkeys []*btcec.PublicKey
+	for i := byte(1); i <= 7; i++ {
+		keys = append(keys, testKey(i))
+		pubkeys = append(pubkeys, testKey(i).PubKey())
+	}
+
+	for _, typ := range []MultiSigType{MultiSigP2SH, MultiSigP2SHP2WSH, MultiSigP2WSH, MultiSigTapscript} {
+		// 4-of-7, signed by the last 4 cosigners
+		spend, _, err := multiSigOutput(testNet, typ, 4, pubkeys)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		tx, err := MultiSigTx(testNet, typ, 4, pubkeys, keys[3:], testPool(100000), 50000, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", typ, err)
+		}
+		testVerify(t, tx, spendFrom(testPool(100000), *spend))
+
+		// fewer signers than the threshold
+		if _, err := MultiSigTx(testNet, typ, 4, pubkeys, keys[4:], testPool(100000), 50000, 2); err == nil {
+			t.Errorf("%s: signed by 3 of 4-of-7", typ)
+		}
+	}
+}
+
+func TestMultiSigLimits(t *testing.T) {
+	var pubkeys []*btcec.PublicKey
+	for i := byte(1); i <= 16; i++ {
+		pubkeys = append(pubkeys, testKey(i).PubKey())
+	}
+	// the p2sh redeem script is at most 520 bytes
+	if _, _, err := multiSigOutput(testNet, MultiSigP2SH, 2, pubkeys); !errors.Is(err, ErrScriptBuild) {
+		t.Errorf("16 pubkeys of p2sh: got %v, want ErrScriptBuild", err)
+	}
+	if _, _, err := multiSigOutput(testNet, MultiSigP2WSH, 2, pubkeys); err != nil {
+		t.Errorf("16 pubkeys of p2wsh: %v", err)
+	}
+	for _, threshold := range []int{0, 17} {
+		if _, err := SortedMultiSigScript(threshold, pubkeys); !errors.Is(err, ErrScriptBuild) {
+			t.Errorf("%d-of-16: got %v, want ErrScriptBuild", threshold, err)
+		}
+	}
+}
+
+// https://github.com/bitcoin/bips/blob/master/bip-0067.mediawiki#test-vectors
+func TestSortedMultiSigScript(t *testing.T) {
+	for _, v := range []struct {
+		threshold int
+		pubkeys   []string
+		script    string
+		address   string
+	}{
+		{
+			2,
+			[]string{
+				"02ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f8",
+				"02fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f",
+			},
+			"522102fe6f0a5a297eb38c391581c4413e084773ea23954d93f7753db7dc0adc188b2f2102ff12471208c14bd580709cb2358d98975247d8765f92bc25eab3b2763ed605f852ae",
+			"39bgKC7RFbpoCRbtD5KEdkYKtNyhpsNa3Z",
+		},
+		{
+			2,
+			[]string{
+				"02632b12f4ac5b1d1b72b2a3b508c19172de44f6f46bcee50ba33f3f9291e47ed0",
+				"027735a29bae7780a9755fae7a1c4374c656ac6a69ea9f3697fda61bb99a4f3e77",
+				"02e2cc6bd5f45edd43bebe7cb9b675f0ce9ed3efe613b177588290ad188d11b404",
+			},
+			"522102632b12f4ac5b1d1b72b2a3b508c19172de44f6f46bcee50ba33f3f9291e47ed021027735a29bae7780a9755fae7a1c4374c656ac6a69ea9f3697fda61bb99a4f3e772102e2cc6bd5f45edd43bebe7cb9b675f0ce9ed3efe613b177588290ad188d11b40453ae",
+			"3CKHTjBKxCARLzwABMu9yD85kvtm7WnMfH",
+		},
+	} {
+		var pubkeys []*btcec.PublicKey
+		for _, raw := range v.pubkeys {
+			data, _ := hex.DecodeString(raw)
+			pubkey, err := btcec.ParsePubKey(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			pubkeys = append(pubkeys, pubkey)
+		}
+
+		script, err := SortedMultiSigScript(v.threshold, pubkeys)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if hex.EncodeToString(script) != v.script {
+			t.Errorf("script %x, want %s", script, v.script)
+		}
+		address, err := btcutil.NewAddressScriptHash(script, &chaincfg.MainNetParams)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if address.EncodeAddress() != v.address {
+			t.Errorf("address %s, want %s", address, v.address)
+		}
+	}
+}
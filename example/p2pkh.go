@@ -5,48 +5,96 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func Pay2PubkeyHash(netwk *chaincfg.Params, prvkey *btcec.PrivateKey,
-	prevTxHash *chainhash.Hash, prevTxOut uint32, prevAmount, fee int64) *wire.MsgTx {
-
-	pubkeyHash := btcutil.Hash160(prvkey.PubKey().SerializeCompressed())
-	address, err := btcutil.NewAddressPubKeyHash(pubkeyHash, netwk)
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPay2PubkeyHashBuilder(netwk, prvkey.PubKey().SerializeCompressed(), pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	fmt.Println("p2pkh address:", address)
+	withKeys(builder.Pool, prvkey)
+	return builder.Build()
+}
 
-	subScript, err := txscript.PayToAddrScript(address)
+// Pay2PubkeyHashWIF is Pay2PubkeyHash with a key of `dumpprivkey`, the WIF must be for the network
+// and the address hashes the pubkey compressed or not as the WIF says
+func Pay2PubkeyHashWIF(netwk *chaincfg.Params, wif *btcutil.WIF,
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	if err := checkWIFNet(wif, netwk); err != nil {
+		return nil, err
+	}
+	builder, err := newPay2PubkeyHashBuilder(netwk, wif.SerializePubKey(), pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	withKeys(builder.Pool, wif.PrivKey)
+	return builder.Build()
+}
 
-	newtx := wire.NewMsgTx(2)
+// P2PKHUTXO returns the utxo of the p2pkh address of the WIF with the key to sign it,
+// it's an input of the TxBuilder
+func P2PKHUTXO(netwk *chaincfg.Params, wif *btcutil.WIF, outpoint wire.OutPoint, amount int64) (*UTXO, error) {
+	if err := checkWIFNet(wif, netwk); err != nil {
+		return nil, err
+	}
+	address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(wif.SerializePubKey()), netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return &UTXO{
+		OutPoint:           outpoint,
+		Amount:             amount,
+		PkScript:           pkScript,
+		SpendType:          SpendP2PKH,
+		UncompressedPubKey: !wif.CompressPubKey,
+		Keys:               []*btcec.PrivateKey{wif.PrivKey},
+	}, nil
+}
 
-	// txout to the address
-	{
-		txout := wire.NewTxOut(prevAmount-fee, subScript)
-		newtx.AddTxOut(txout)
+// Pay2PubkeyHashPsbt creates the psbt of Pay2PubkeyHash for the owner of the pubkey to sign
+func Pay2PubkeyHashPsbt(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPay2PubkeyHashBuilder(netwk, pubkey.SerializeCompressed(), pool, amount, feeRate)
+	if err != nil {
+		return nil, err
 	}
+	return builder.BuildPsbt()
+}
+
+// newPay2PubkeyHashBuilder takes the serialized pubkey, the address of an uncompressed pubkey is another one
+func newPay2PubkeyHashBuilder(netwk *chaincfg.Params, pubkey []byte,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
 
-	// txin
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxOut), nil, nil)
-		newtx.AddTxIn(txin)
+	pubkeyHash := btcutil.Hash160(pubkey)
+	address, err := btcutil.NewAddressPubKeyHash(pubkeyHash, netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
+	fmt.Println("p2pkh address:", address)
 
-	// sign
-	for txIdx, txIn := range newtx.TxIn {
-		sig, err := txscript.SignatureScript(newtx, txIdx, subScript, txscript.SigHashAll, prvkey, true)
-		if err != nil {
-			panic(err)
-		}
-		txIn.SignatureScript = sig
+	subScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
-	return newtx
+
+	// select the utxos of the address, pay the amount to the address and the change back
+	return &TxBuilder{
+		Pool: spendFrom(pool, UTXO{
+			PkScript:           subScript,
+			SpendType:          SpendP2PKH,
+			UncompressedPubKey: len(pubkey) == uncompressedPubKeySize,
+		}),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
 }
@@ -0,0 +1,75 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestPay2PubkeyHashWIF(t *testing.T) {
+	for _, compressed := range []bool{true, false} {
+		wif, err := btcutil.NewWIF(testKey(1), testNet, compressed)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := Pay2PubkeyHashWIF(testNet, wif, testPool(60000), 30000, 2)
+		if err != nil {
+			t.Fatalf("compressed %t: %v", compressed, err)
+		}
+
+		// the scriptSig pushes the pubkey the WIF says
+		pushes, err := txscript.PushedData(tx.TxIn[0].SignatureScript)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := pushes[1]; string(got) != string(wif.SerializePubKey()) {
+			t.Errorf("compressed %t: pubkey %x", compressed, got)
+		}
+		// the fee covers the size of the uncompressed pubkey
+		if fee, size := txFee(tx, spendFrom(testPool(60000), UTXO{})), mempool.GetTxVirtualSize(btcutil.NewTx(tx)); fee < 2*size {
+			t.Errorf("compressed %t: fee %d for %d vbytes", compressed, fee, size)
+		}
+	}
+}
+
+func TestP2PKHUTXO(t *testing.T) {
+	wif, err := btcutil.NewWIF(testKey(1), testNet, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	utxo, err := P2PKHUTXO(testNet, wif, testPool(60000)[0].OutPoint, 60000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	address, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(testKey(1).PubKey().SerializeUncompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := &TxBuilder{
+		Inputs:        []*UTXO{utxo},
+		Recipients:    []*Recipient{{Address: address, Amount: 30000}},
+		ChangeAddress: address,
+		FeeRate:       2,
+	}
+	// Build verifies the signature against the script of the uncompressed pubkey
+	if _, err := builder.Build(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPay2PubkeyHashWIFNetwork(t *testing.T) {
+	wif, err := btcutil.NewWIF(testKey(1), &chaincfg.MainNetParams, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Pay2PubkeyHashWIF(testNet, wif, testPool(60000), 30000, 2); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("mainnet key on regtest: %v", err)
+	}
+	if _, err := P2PKHUTXO(testNet, wif, testPool(60000)[0].OutPoint, 60000); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("mainnet key on regtest: %v", err)
+	}
+}
@@ -1,76 +1,54 @@
 package example
 
 import (
-	"fmt"
-
 	"github.com/btcsuite/btcd/btcec/v2"
-	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
-	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func Pay2ScriptHashTx(netwk *chaincfg.Params, alice, bob, cario *btcec.PrivateKey,
-	prevTxHash *chainhash.Hash, prevTxOut uint32, prevAmountSat, fee int64) *wire.MsgTx {
-	redeemScript, err := txscript.NewScriptBuilder().
-		AddOp(txscript.OP_2).
-		AddData(alice.PubKey().SerializeUncompressed()).
-		AddData(bob.PubKey().SerializeUncompressed()).
-		AddData(cario.PubKey().SerializeUncompressed()).
-		AddOp(txscript.OP_3).
-		AddOp(txscript.OP_CHECKMULTISIG).
-		Script()
-
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPay2ScriptHashBuilder(netwk, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	// alice and bob sign the utxos of the address
+	withKeys(builder.Pool, alice, bob)
+	return builder.Build()
+}
 
-	address, err := btcutil.NewAddressScriptHash(redeemScript, netwk)
+// Pay2ScriptHashPsbt creates the psbt of Pay2ScriptHashTx, any two of the cosigners sign it
+func Pay2ScriptHashPsbt(netwk *chaincfg.Params, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPay2ScriptHashBuilder(netwk, alice, bob, cario, pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	fmt.Println("P2SH address:", address)
-
-	newtx := wire.NewMsgTx(2)
-
-	// txout to the address
-	{
-		output, err := txscript.PayToAddrScript(address)
-		if err != nil {
-			panic(err)
-		}
-		txout := wire.NewTxOut(prevAmountSat-fee, output)
-		newtx.AddTxOut(txout)
-	}
-
-	// txin
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxOut), nil, nil)
-		newtx.AddTxIn(txin)
-	}
-
-	// sign
-	for txIdx, txIn := range newtx.TxIn {
-		aliceSig, err := txscript.RawTxInSignature(newtx, txIdx, redeemScript, txscript.SigHashAll, alice)
-		if err != nil {
-			panic(err)
-		}
+	return builder.BuildPsbt()
+}
 
-		bobSig, err := txscript.RawTxInSignature(newtx, txIdx, redeemScript, txscript.SigHashAll, bob)
-		if err != nil {
-			panic(err)
-		}
+// newPay2ScriptHashBuilder is the 2-of-3 p2sh multisig of the cosigners, the pubkeys are sorted by BIP67
+func newPay2ScriptHashBuilder(netwk *chaincfg.Params, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	return newMultiSigBuilder(netwk, MultiSigP2SH, 2, []*btcec.PublicKey{alice, bob, cario},
+		pool, amount, feeRate)
+}
 
-		txIn.SignatureScript, err = txscript.NewScriptBuilder().
-			AddOp(txscript.OP_0).
-			AddData(aliceSig).
-			AddData(bobSig).
-			AddData(redeemScript).Script()
-		if err != nil {
-			panic(err)
-		}
-	}
+// Pay2NestedWitnessScriptHashTx spends and pays to the 2-of-3 p2sh-p2wsh multisig of the cosigners,
+// the scriptSig only pushes the witness program `OP_0 <sha256(witnessScript)>` and alice and bob
+// sign the witness script by BIP143
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#p2wsh-nested-in-bip16-p2sh
+func Pay2NestedWitnessScriptHashTx(netwk *chaincfg.Params, alice, bob, cario *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	return MultiSigTx(netwk, MultiSigP2SHP2WSH, 2, []*btcec.PublicKey{alice.PubKey(), bob.PubKey(), cario.PubKey()},
+		[]*btcec.PrivateKey{alice, bob}, pool, amount, feeRate)
+}
 
-	return newtx
+// Pay2NestedWitnessScriptHashPsbt creates the psbt of Pay2NestedWitnessScriptHashTx, any two of the cosigners sign it
+func Pay2NestedWitnessScriptHashPsbt(netwk *chaincfg.Params, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	return MultiSigPsbt(netwk, MultiSigP2SHP2WSH, 2, []*btcec.PublicKey{alice, bob, cario}, pool, amount, feeRate)
 }
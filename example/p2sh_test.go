@@ -0,0 +1,26 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestPay2NestedWitnessScriptHash(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	spend, _, err := multiSigOutput(testNet, MultiSigP2SHP2WSH, 2,
+		[]*btcec.PublicKey{alice.PubKey(), bob.PubKey(), cario.PubKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tx, err := Pay2NestedWitnessScriptHashTx(testNet, alice, bob, cario, testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scriptSig pushes `OP_0 <sha256(witnessScript)>`, the witness is `<> <sig> <sig> <witnessScript>`
+	if len(tx.TxIn[0].SignatureScript) != 35 || len(tx.TxIn[0].Witness) != 4 {
+		t.Fatalf("scriptSig %x, witness %d items", tx.TxIn[0].SignatureScript, len(tx.TxIn[0].Witness))
+	}
+	testVerify(t, tx, spendFrom(testPool(100000), *spend))
+}
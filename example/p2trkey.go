@@ -6,57 +6,56 @@ import (
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func Pay2TaprootByKeyPathTx(netwk *chaincfg.Params, prvkey *btcec.PrivateKey,
-	prevTxid *chainhash.Hash, prevPkScript []byte, prevTxout int, prevAmountSat, curAmountSat int64) *wire.MsgTx {
-	// We use bip68 here
-	pubKey := txscript.ComputeTaprootKeyNoScript(prvkey.PubKey())
-	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(pubKey), netwk)
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPay2TaprootByKeyPathBuilder(netwk, prvkey.PubKey(), pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
-	fmt.Println("P2TR Address:", address)
+	withKeys(builder.Pool, prvkey)
+	return builder.Build()
+}
 
-	newtx := wire.NewMsgTx(2)
-	// txout
-	{
-		output, err := txscript.PayToAddrScript(address)
-		if err != nil {
-			panic(err)
-		}
-		txout := wire.NewTxOut(curAmountSat, output)
-		newtx.AddTxOut(txout)
+// Pay2TaprootByKeyPathPsbt creates the psbt of Pay2TaprootByKeyPathTx for the owner of the internal key to sign
+func Pay2TaprootByKeyPathPsbt(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPay2TaprootByKeyPathBuilder(netwk, pubkey, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
 	}
+	return builder.BuildPsbt()
+}
 
-	// txin, spend p2pr output
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxid, uint32(prevTxout)), nil, nil)
-		newtx.AddTxIn(txin)
+func newPay2TaprootByKeyPathBuilder(netwk *chaincfg.Params, internalKey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	// We use bip86 here
+	pubKey := txscript.ComputeTaprootKeyNoScript(internalKey)
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(pubKey), netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
+	fmt.Println("P2TR Address:", address)
 
-	// sign
-	for txIdx, txin := range newtx.TxIn {
-		sigHashes := txscript.NewTxSigHashes(newtx,
-			txscript.NewCannedPrevOutputFetcher(prevPkScript, prevAmountSat))
-
-		txin.Witness, err = txscript.TaprootWitnessSignature(
-			newtx,
-			sigHashes,
-			txIdx,
-			prevAmountSat,
-			prevPkScript,
-			txscript.SigHashDefault,
-			prvkey,
-		)
-		if err != nil {
-			panic(err)
-		}
+	output, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	return newtx
+	// spend p2tr outputs of the address by key path
+	return &TxBuilder{
+		Pool: spendFrom(pool, UTXO{
+			PkScript:       output,
+			SpendType:      SpendP2TRKeyPath,
+			TapInternalKey: internalKey,
+		}),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
 }
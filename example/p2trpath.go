@@ -1,14 +1,14 @@
 package example
 
 import (
+	"crypto/rand"
 	"encoding/hex"
 	"fmt"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcec/v2/schnorr"
-	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
@@ -17,8 +17,93 @@ import (
 var rawNothingInMySlee, _ = hex.DecodeString("50929b74c1a04954b78b4b6035e97a5e078a5a0f28ec96d547bfee9ace803ac0")
 var NothingInMySleeve, _ = schnorr.ParsePubKey(rawNothingInMySlee)
 
+// NUMSInternalKey returns H + rG where H is NothingInMySleeve, the key path of the internal key is
+// provably unspendable for anyone knowing r, but the others can't tell it from a real key
+func NUMSInternalKey(r []byte) (*btcec.PublicKey, error) {
+	var scalar btcec.ModNScalar
+	if len(r) != 32 || scalar.SetByteSlice(r) || scalar.IsZero() {
+		return nil, fmt.Errorf("%w: r must be a 32 bytes scalar", ErrInvalidKey)
+	}
+
+	var h, rG, sum btcec.JacobianPoint
+	NothingInMySleeve.AsJacobian(&h)
+	btcec.ScalarBaseMultNonConst(&scalar, &rG)
+	btcec.AddNonConst(&h, &rG, &sum)
+	sum.ToAffine()
+	return btcec.NewPublicKey(&sum.X, &sum.Y), nil
+}
+
+// NewNUMSInternalKey returns the NUMSInternalKey of a random r, keep r to prove the key path is unspendable
+func NewNUMSInternalKey() (*btcec.PublicKey, []byte, error) {
+	for {
+		r := make([]byte, 32)
+		if _, err := rand.Read(r); err != nil {
+			return nil, nil, err
+		}
+		if internalKey, err := NUMSInternalKey(r); err == nil {
+			return internalKey, r, nil
+		}
+	}
+}
+
 func PayToTaprootByPath(netwk *chaincfg.Params, alice, bob, cario, god *btcec.PrivateKey,
-	prevTxHash *chainhash.Hash, prevTxout uint32, prevAmountSat, fee int64) *wire.MsgTx {
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	var godKey *btcec.PublicKey
+	if god != nil {
+		godKey = god.PubKey()
+	}
+	builder, err := newPayToTaprootByPathBuilder(netwk, alice.PubKey(), bob.PubKey(), cario.PubKey(), godKey,
+		god != nil, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	if god != nil {
+		withKeys(builder.Pool, god)
+	} else {
+		withKeys(builder.Pool, alice, cario)
+	}
+	return builder.Build()
+}
+
+// PayToTaprootByScriptPath spends the 2-of-3 leaf of PayToTaprootByPath by the script path with any internal key,
+// like a MuSig2InternalKey of the cosigners or a NUMSInternalKey, nil means NothingInMySleeve
+func PayToTaprootByScriptPath(netwk *chaincfg.Params, internalKey *btcec.PublicKey, alice, bob, cario *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPayToTaprootByPathBuilder(netwk, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		internalKey, false, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	withKeys(builder.Pool, alice, cario)
+	return builder.Build()
+}
+
+// PayToTaprootByScriptPathPsbt creates the psbt of PayToTaprootByScriptPath, any two of the cosigners sign it.
+// The internal key is in the psbt, so its owner can also sign the key path instead.
+func PayToTaprootByScriptPathPsbt(netwk *chaincfg.Params, internalKey, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPayToTaprootByPathBuilder(netwk, alice, bob, cario, internalKey, false, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+// PayToTaprootByPathPsbt creates the psbt of PayToTaprootByPath, god signs the key path,
+// or any two of the cosigners sign the script path without god
+func PayToTaprootByPathPsbt(netwk *chaincfg.Params, alice, bob, cario, god *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPayToTaprootByPathBuilder(netwk, alice, bob, cario, god, god != nil, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+// newPayToTaprootByPathBuilder spends by the key path of the internal key or by the script path of the 2-of-3 leaf,
+// the control block of the leaf commits to the internal key, NothingInMySleeve if it's nil
+func newPayToTaprootByPathBuilder(netwk *chaincfg.Params, alice, bob, cario, internalKey *btcec.PublicKey,
+	keyPath bool, pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
 
 	// https://github.com/bitcoin/bips/blob/master/bip-0342.mediawiki#rationale
 	// Using a single OP_CHECKSIGADD-based script A CHECKMULTISIG script
@@ -29,108 +114,31 @@ func PayToTaprootByPath(netwk *chaincfg.Params, alice, bob, cario, god *btcec.Pr
 	// <w_n> ... <w_1>.
 	// Every witness element w_i is either a signature corresponding to pubkey_i or an empty vector.
 
-	script1, err := txscript.NewScriptBuilder().
-		AddData(schnorr.SerializePubKey(alice.PubKey())).
-		AddOp(txscript.OP_CHECKSIG).
-		AddData(schnorr.SerializePubKey(bob.PubKey())).
-		AddOp(txscript.OP_CHECKSIGADD).
-		AddData(schnorr.SerializePubKey(cario.PubKey())).
-		AddOp(txscript.OP_CHECKSIGADD).
-		AddOp(txscript.OP_2).
-		AddOp(txscript.OP_NUMEQUAL).
-		Script()
-
+	// the pubkeys are sorted like sortedmulti_a, so the order of the cosigners doesn't matter
+	script1, err := SortedMultiATapscript(2, []*btcec.PublicKey{alice, bob, cario})
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
 	script2, err := txscript.NewScriptBuilder().
 		AddOp(txscript.OP_RETURN).
 		AddData([]byte("data")).Script()
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	leaf1, leaf2 := txscript.NewBaseTapLeaf(script1), txscript.NewBaseTapLeaf(script2)
-	scriptTree := txscript.AssembleTaprootScriptTree(leaf1, leaf2)
-	rootHash := scriptTree.RootNode.TapHash()
-
-	var outputKey *btcec.PublicKey
-	if god == nil {
-		outputKey = txscript.ComputeTaprootOutputKey(NothingInMySleeve, rootHash[:])
-	} else {
-		outputKey = txscript.ComputeTaprootOutputKey(god.PubKey(), rootHash[:])
-	}
-
-	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(outputKey), netwk)
+	scriptTree, err := NewTapTree(txscript.NewBaseTapLeaf(script1), txscript.NewBaseTapLeaf(script2))
 	if err != nil {
-		panic(err)
-	}
-	fmt.Println("P2TR Address:", address)
-
-	newtx := wire.NewMsgTx(2)
-	// add txin
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxout), nil, nil)
-		txin.Sequence = wire.MaxTxInSequenceNum - 5 // let it be replaceable
-		newtx.AddTxIn(txin)
+		return nil, err
 	}
 
-	// add txout
-	{
-		output, err := txscript.PayToAddrScript(address)
-		if err != nil {
-			panic(err)
-		}
-		txout := wire.NewTxOut(prevAmountSat-fee, output)
-		newtx.AddTxOut(txout)
+	if internalKey == nil {
+		internalKey = NothingInMySleeve
 	}
-
-	for txIdx, txin := range newtx.TxIn {
-		prevPkScript, _ := txscript.PayToAddrScript(address)
-		sigHashes := txscript.NewTxSigHashes(newtx,
-			txscript.NewCannedPrevOutputFetcher(prevPkScript, prevAmountSat))
-
-		if god != nil {
-			// pay with key path
-			sig, err := txscript.RawTxInTaprootSignature(
-				newtx,
-				sigHashes,
-				txIdx,
-				prevAmountSat,
-				prevPkScript,
-				rootHash[:],
-				txscript.SigHashDefault,
-				god,
-			)
-			if err != nil {
-				panic(err)
-			}
-			txin.Witness = wire.TxWitness{sig}
-		} else {
-			// pay with script path
-			aliceSig, err := txscript.RawTxInTapscriptSignature(newtx, sigHashes, txIdx, prevAmountSat,
-				prevPkScript, leaf1, txscript.SigHashDefault, alice)
-			if err != nil {
-				panic(err)
-			}
-
-			carioSig, err := txscript.RawTxInTapscriptSignature(newtx, sigHashes, txIdx, prevAmountSat,
-				prevPkScript, leaf1, txscript.SigHashDefault, cario)
-			if err != nil {
-				panic(err)
-			}
-
-			// sign
-			controlBlock := scriptTree.LeafMerkleProofs[0].ToControlBlock(NothingInMySleeve)
-			controlBlockWitness, err := controlBlock.ToBytes()
-			if err != nil {
-				panic(err)
-			}
-
-			txin.Witness = wire.TxWitness{carioSig, []byte{}, aliceSig, script1, controlBlockWitness}
-		}
+	if keyPath {
+		return newPayToTaprootTreeBuilder(netwk, internalKey, scriptTree, -1, pool, amount, feeRate)
 	}
-
-	return newtx
+	// pay with script path of script1,
+	// the witness is a signature or an empty vector per pubkey, then <script1> <controlBlock>
+	return newPayToTaprootTreeBuilder(netwk, internalKey, scriptTree, 0, pool, amount, feeRate)
 }
@@ -0,0 +1,122 @@
+package example
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestNUMSInternalKey(t *testing.T) {
+	// H + 1G is NothingInMySleeve plus the generator, the pubkey of the private key 1
+	one := make([]byte, 32)
+	one[31] = 1
+	internalKey, err := NUMSInternalKey(one)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g, _ := btcec.PrivKeyFromBytes(one)
+	var h, gj, sum btcec.JacobianPoint
+	NothingInMySleeve.AsJacobian(&h)
+	g.PubKey().AsJacobian(&gj)
+	btcec.AddNonConst(&h, &gj, &sum)
+	sum.ToAffine()
+	if !internalKey.IsEqual(btcec.NewPublicKey(&sum.X, &sum.Y)) {
+		t.Errorf("H+G is %x", internalKey.SerializeCompressed())
+	}
+
+	random, r, err := NewNUMSInternalKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := NUMSInternalKey(r)
+	if err != nil || !again.IsEqual(random) || random.IsEqual(NothingInMySleeve) {
+		t.Errorf("the key of r %x isn't reproducible: %v", r, err)
+	}
+
+	order := []byte{
+		0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xfe,
+		0xba, 0xae, 0xdc, 0xe6, 0xaf, 0x48, 0xa0, 0x3b, 0xbf, 0xd2, 0x5e, 0x8c, 0xd0, 0x36, 0x41, 0x41,
+	}
+	for _, bad := range [][]byte{nil, one[1:], make([]byte, 32), order} {
+		if _, err := NUMSInternalKey(bad); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("r %x: got %v, want ErrInvalidKey", bad, err)
+		}
+	}
+}
+
+func TestPayToTaprootByScriptPath(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	musigKey, err := MuSig2InternalKey(alice.PubKey(), bob.PubKey(), cario.PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	numsKey, _, err := NewNUMSInternalKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		name        string
+		internalKey *btcec.PublicKey
+	}{
+		{"nothing in my sleeve", nil},
+		{"real key", testKey(5).PubKey()},
+		{"musig2 key", musigKey},
+		{"H+rG", numsKey},
+	} {
+		builder, err := newPayToTaprootByPathBuilder(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+			test.internalKey, false, testPool(100000), 50000, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		tx, err := PayToTaprootByScriptPath(testNet, test.internalKey, alice, bob, cario, testPool(100000), 50000, 2)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		testVerify(t, tx, builder.Pool)
+
+		// the control block commits to the internal key
+		want := test.internalKey
+		if want == nil {
+			want = NothingInMySleeve
+		}
+		witness := tx.TxIn[0].Witness
+		controlBlock, err := txscript.ParseControlBlock(witness[len(witness)-1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(schnorr.SerializePubKey(controlBlock.InternalKey), schnorr.SerializePubKey(want)) {
+			t.Errorf("%s: internal key %x", test.name, schnorr.SerializePubKey(controlBlock.InternalKey))
+		}
+	}
+}
+
+func TestPayToTaprootTreeMuSig2KeyPath(t *testing.T) {
+	keys := []*btcec.PrivateKey{testKey(1), testKey(2), testKey(3)}
+	internalKey, err := MuSig2InternalKey(keys[0].PubKey(), keys[1].PubKey(), keys[2].PubKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTapTree(testTapLeaves(t, keys...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	spend, err := tree.spend(internalKey, -1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the cosigners spend the key path tweaked by the merkle root together
+	tx, err := PayToTaprootTreeTx(testNet, internalKey, tree, -1, keys, testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxIn[0].Witness) != 1 {
+		t.Fatalf("witness %d items", len(tx.TxIn[0].Witness))
+	}
+	testVerify(t, tx, spendFrom(testPool(100000), *spend))
+}
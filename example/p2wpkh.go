@@ -5,52 +5,112 @@ import (
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func Pay2WitnessPubkeyHashAddr(netwk *chaincfg.Params, prvkey *btcec.PrivateKey,
-	prevTxHash *chainhash.Hash, prevTxOut uint32, prevAmount, fee int64) *wire.MsgTx {
-	pubkeyHash := btcutil.Hash160(prvkey.PubKey().SerializeCompressed())
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPay2WitnessPubkeyHashBuilder(netwk, prvkey.PubKey(), pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	withKeys(builder.Pool, prvkey)
+	return builder.Build()
+}
+
+// Pay2WitnessPubkeyHashPsbt creates the psbt of Pay2WitnessPubkeyHashAddr for the owner of the pubkey to sign
+func Pay2WitnessPubkeyHashPsbt(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPay2WitnessPubkeyHashBuilder(netwk, pubkey, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+func newPay2WitnessPubkeyHashBuilder(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	pubkeyHash := btcutil.Hash160(pubkey.SerializeCompressed())
 	address, err := btcutil.NewAddressWitnessPubKeyHash(pubkeyHash, netwk)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
 
 	fmt.Println("p2wpkh address:", address)
 
 	subScript, err := txscript.PayToAddrScript(address)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	newtx := wire.NewMsgTx(2)
+	// select the utxos of the address, pay the amount to the address and the change back
+	return &TxBuilder{
+		Pool: spendFrom(pool, UTXO{
+			PkScript:  subScript,
+			SpendType: SpendP2WPKH,
+		}),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
+}
+
+// Pay2NestedWitnessPubkeyHashTx spends and pays to the p2sh-p2wpkh address of the key,
+// the `3...` address wraps the witness program `OP_0 <pubkey hash>` as the redeem script
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki#p2wpkh-nested-in-bip16-p2sh
+func Pay2NestedWitnessPubkeyHashTx(netwk *chaincfg.Params, prvkey *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPay2NestedWitnessPubkeyHashBuilder(netwk, prvkey.PubKey(), pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	withKeys(builder.Pool, prvkey)
+	return builder.Build()
+}
 
-	// txout to the address
-	{
-		txout := wire.NewTxOut(prevAmount-fee, subScript)
-		newtx.AddTxOut(txout)
+// Pay2NestedWitnessPubkeyHashPsbt creates the psbt of Pay2NestedWitnessPubkeyHashTx for the owner of the pubkey to sign
+func Pay2NestedWitnessPubkeyHashPsbt(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPay2NestedWitnessPubkeyHashBuilder(netwk, pubkey, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
 	}
+	return builder.BuildPsbt()
+}
 
-	// txin
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxOut), nil, nil)
-		newtx.AddTxIn(txin)
+func newPay2NestedWitnessPubkeyHashBuilder(netwk *chaincfg.Params, pubkey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	redeemScript, err := txscript.NewScriptBuilder().
+		AddOp(txscript.OP_0).
+		AddData(btcutil.Hash160(pubkey.SerializeCompressed())).
+		Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	// sign
-	for txIdx, txin := range newtx.TxIn {
-		sigHashes := txscript.NewTxSigHashes(newtx,
-			txscript.NewCannedPrevOutputFetcher(subScript, prevAmount))
+	address, err := btcutil.NewAddressScriptHash(redeemScript, netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	fmt.Println("p2sh-p2wpkh address:", address)
 
-		sig, err := txscript.WitnessSignature(newtx, sigHashes, txIdx,
-			prevAmount, subScript, txscript.SigHashAll, prvkey, true)
-		if err != nil {
-			panic(err)
-		}
-		txin.Witness = sig
+	output, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
-	return newtx
+
+	return &TxBuilder{
+		Pool: spendFrom(pool, UTXO{
+			PkScript:  output,
+			SpendType: SpendP2SHP2WPKH,
+			Script:    redeemScript,
+		}),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
 }
@@ -0,0 +1,28 @@
+package example
+
+import (
+	"testing"
+
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func TestPay2NestedWitnessPubkeyHash(t *testing.T) {
+	prvkey := testKey(1)
+	builder, err := newPay2NestedWitnessPubkeyHashBuilder(testNet, prvkey.PubKey(), testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !txscript.IsPayToScriptHash(builder.Pool[0].PkScript) {
+		t.Fatalf("pkScript %x", builder.Pool[0].PkScript)
+	}
+
+	tx, err := Pay2NestedWitnessPubkeyHashTx(testNet, prvkey, testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the scriptSig pushes the redeem script only, the signature is in the witness
+	if len(tx.TxIn[0].SignatureScript) != 23 || len(tx.TxIn[0].Witness) != 2 {
+		t.Fatalf("scriptSig %x, witness %d items", tx.TxIn[0].SignatureScript, len(tx.TxIn[0].Witness))
+	}
+	testVerify(t, tx, builder.Pool)
+}
@@ -1,89 +1,46 @@
 package example
 
 import (
+	"bytes"
 	"crypto/sha256"
 	"encoding/hex"
 	"fmt"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
 func CreateP2WSHMultiSigTx(netwk *chaincfg.Params, alice, bob, cario *btcec.PrivateKey,
-	prevTxHash *chainhash.Hash, prevTxOut uint32, prevAmountSat, fee int64) *wire.MsgTx {
-	redeemScript, err := txscript.NewScriptBuilder().
-		AddOp(txscript.OP_2).
-		AddData(alice.PubKey().SerializeCompressed()).
-		AddData(bob.PubKey().SerializeCompressed()).
-		AddData(cario.PubKey().SerializeCompressed()).
-		AddOp(txscript.OP_3).
-		AddOp(txscript.OP_CHECKMULTISIG).
-		Script()
-
+	pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newP2WSHMultiSigBuilder(netwk, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		pool, amount, feeRate)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	// alice and bob sign the utxos of the address
+	withKeys(builder.Pool, alice, bob)
+	return builder.Build()
+}
 
-	witnessProg := sha256.Sum256(redeemScript)
-	address, err := btcutil.NewAddressWitnessScriptHash(witnessProg[:], netwk)
-	if err != nil {
-		panic(err)
-	}
-	fmt.Println("p2wsh address", address)
-
-	prevPkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(witnessProg[:]).Script()
+// CreateP2WSHMultiSigPsbt creates the psbt of CreateP2WSHMultiSigTx, any two of the cosigners sign it
+func CreateP2WSHMultiSigPsbt(netwk *chaincfg.Params, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newP2WSHMultiSigBuilder(netwk, alice, bob, cario, pool, amount, feeRate)
 	if err != nil {
-		panic(err)
-	}
-	fmt.Println("p2wsh pkScript", hex.EncodeToString(prevPkScript))
-
-	newtx := wire.NewMsgTx(2)
-
-	// add txin
-	{
-		// the current tx input index
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxOut), nil, nil)
-		txin.Sequence = wire.MaxTxInSequenceNum - 5 // let it be replaceable
-		newtx.AddTxIn(txin)
-	}
-
-	// add txout
-	{
-		output, err := txscript.PayToAddrScript(address)
-		if err != nil {
-			panic(err)
-		}
-		txout := wire.NewTxOut(prevAmountSat-fee, output)
-		newtx.AddTxOut(txout)
+		return nil, err
 	}
+	return builder.BuildPsbt()
+}
 
-	// sign
-	for txIdx, TxIn := range newtx.TxIn {
-		sigHashes := txscript.NewTxSigHashes(newtx,
-			txscript.NewCannedPrevOutputFetcher(prevPkScript, prevAmountSat))
-
-		aliceSig, err := txscript.RawTxInWitnessSignature(newtx,
-			sigHashes, txIdx, prevAmountSat, redeemScript, txscript.SigHashAll, alice)
-		if err != nil {
-			panic(err)
-		}
-
-		bobSig, err := txscript.RawTxInWitnessSignature(newtx,
-			sigHashes, txIdx, prevAmountSat, redeemScript, txscript.SigHashAll, bob)
-		if err != nil {
-			panic(err)
-		}
-
-		// replace OP_0 with empty witness
-		// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki
-		// A non-witness program (defined hereinafter) txin MUST be associated with an empty witness field, represented by a 0x00.
-		TxIn.Witness = wire.TxWitness{[]byte{}, aliceSig, bobSig, redeemScript}
-	}
-	return newtx
+// newP2WSHMultiSigBuilder is the 2-of-3 p2wsh multisig of the cosigners, the pubkeys are sorted by BIP67
+func newP2WSHMultiSigBuilder(netwk *chaincfg.Params, alice, bob, cario *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	return newMultiSigBuilder(netwk, MultiSigP2WSH, 2, []*btcec.PublicKey{alice, bob, cario},
+		pool, amount, feeRate)
 }
 
 /*
@@ -109,111 +66,205 @@ Unlock using multi-sig:
 
 	OP_0 <aliceSig> <bobSig> <mulsig preimage>
 */
-func CreateBip112P2wsh(netwk *chaincfg.Params, aliceKey, bobKey *btcec.PrivateKey, prevTxHash *chainhash.Hash,
-	prevTxout uint32, prevAmountSat, fee int64, timeLockNumber uint16, useTimelock bool,
-	timelockPreimage, mulsigPreimage []byte) *wire.MsgTx {
+func CreateBip112P2wsh(netwk *chaincfg.Params, aliceKey, bobKey *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64, timeLockNumber uint16, useTimelock bool,
+	timelockPreimage, mulsigPreimage []byte) (*wire.MsgTx, error) {
+	builder, err := newBip112P2wshBuilder(netwk, aliceKey.PubKey(), bobKey.PubKey(), pool, amount, feeRate,
+		timeLockNumber, useTimelock, timelockPreimage, mulsigPreimage)
+	if err != nil {
+		return nil, err
+	}
+	if useTimelock {
+		withKeys(builder.Pool, aliceKey)
+	} else {
+		withKeys(builder.Pool, aliceKey, bobKey)
+	}
+	return builder.Build()
+}
+
+// CreateBip112P2wshPsbt creates the psbt of CreateBip112P2wsh, the preimage of the branch is in the psbt
+func CreateBip112P2wshPsbt(netwk *chaincfg.Params, aliceKey, bobKey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64, timeLockNumber uint16, useTimelock bool,
+	timelockPreimage, mulsigPreimage []byte) (*psbt.Packet, error) {
+	builder, err := newBip112P2wshBuilder(netwk, aliceKey, bobKey, pool, amount, feeRate,
+		timeLockNumber, useTimelock, timelockPreimage, mulsigPreimage)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+// bip112ScriptAsm is the lock script for AsmToScript, the placeholders are filled by fmt
+const bip112ScriptAsm = `
+OP_HASH160 OP_DUP %x OP_EQUAL     # commitment for the timelock
+OP_IF
+	OP_DROP
+	%d OP_CHECKSEQUENCEVERIFY OP_DROP
+	%x OP_CHECKSIG                 # alice
+OP_ELSE
+	%x OP_EQUALVERIFY              # commitment for the multisig
+	2 %x %x 2 OP_CHECKMULTISIG     # alice and bob
+OP_ENDIF
+`
+
+func newBip112P2wshBuilder(netwk *chaincfg.Params, aliceKey, bobKey *btcec.PublicKey,
+	pool []*UTXO, amount, feeRate int64, timeLockNumber uint16, useTimelock bool,
+	timelockPreimage, mulsigPreimage []byte) (*TxBuilder, error) {
 
 	commitmentForTimeLock := btcutil.Hash160(timelockPreimage)
 	commitmentForMulsig := btcutil.Hash160(mulsigPreimage)
 
-	redeemScript, err := txscript.NewScriptBuilder().
-		AddOp(txscript.OP_HASH160).
-		AddOp(txscript.OP_DUP).
-		AddData(commitmentForTimeLock).
-		AddOp(txscript.OP_EQUAL).
-		AddOp(txscript.OP_IF).
-		AddOp(txscript.OP_DROP).
-		AddInt64(int64(timeLockNumber)).
-		AddOp(txscript.OP_CHECKSEQUENCEVERIFY).
-		AddOp(txscript.OP_DROP).
-		AddData(bobKey.PubKey().SerializeCompressed()).
-		AddOp(txscript.OP_CHECKSIG).
-		AddOp(txscript.OP_ELSE).
-		AddData(commitmentForMulsig).
-		AddOp(txscript.OP_EQUALVERIFY).
-		AddOp(txscript.OP_2).
-		AddData(aliceKey.PubKey().SerializeCompressed()).
-		AddData(bobKey.PubKey().SerializeCompressed()).
-		AddOp(txscript.OP_2).
-		AddOp(txscript.OP_CHECKMULTISIG).
-		AddOp(txscript.OP_ENDIF).
-		Script()
+	redeemScript, err := AsmToScript(fmt.Sprintf(bip112ScriptAsm, commitmentForTimeLock, timeLockNumber,
+		aliceKey.SerializeCompressed(), commitmentForMulsig, aliceKey.SerializeCompressed(), bobKey.SerializeCompressed()))
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
 	witnessProg := sha256.Sum256(redeemScript)
 	address, err := btcutil.NewAddressWitnessScriptHash(witnessProg[:], netwk)
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
 	fmt.Println("p2wsh address", address)
 
 	prevPkScript, err := txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(witnessProg[:]).Script()
 	if err != nil {
-		panic(err)
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 	fmt.Println("p2wsh pkScript", hex.EncodeToString(prevPkScript))
 
-	newtx := wire.NewMsgTx(2) // tx version must be 2 to use bip-112
-
-	// txout to the internal tss group address
-	{
-		output, err := txscript.PayToAddrScript(address)
-		if err != nil {
-			panic(err)
+	var spend UTXO
+	if useTimelock {
+		spend = UTXO{
+			SpendType: SpendBip112Timelock,
+			// the sequence number must be equal with the defined before
+			Sequence: uint32(timeLockNumber),
+			Preimage: timelockPreimage,
+		}
+	} else {
+		spend = UTXO{
+			SpendType: SpendBip112MultiSig,
+			Preimage:  mulsigPreimage,
 		}
-		txout := wire.NewTxOut(prevAmountSat-fee, output)
-		newtx.AddTxOut(txout)
 	}
+	spend.PkScript = prevPkScript
+	spend.Script = redeemScript
 
-	if useTimelock {
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, uint32(prevTxout)), nil, nil)
-		// the sequence number must be equal with the defined before
-		txin.Sequence = uint32(timeLockNumber)
-		newtx.AddTxIn(txin)
-	} else {
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, uint32(prevTxout)), nil, nil)
-		newtx.AddTxIn(txin)
+	return &TxBuilder{
+		Version:       2, // tx version must be 2 to use bip-112
+		Pool:          spendFrom(pool, spend),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
+}
+
+// signBip112Timelock unlocks the bip112 script with <aliceSig> <timelock preimage>
+func signBip112Timelock(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	witnessScript, preimage []byte, prvkey *btcec.PrivateKey) (wire.TxWitness, error) {
+	sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, idx, amount,
+		witnessScript, txscript.SigHashAll, prvkey)
+	if err != nil {
+		return nil, err
 	}
+	return wire.TxWitness{sig, preimage, witnessScript}, nil
+}
 
-	// sign
-	for txIdx, txin := range newtx.TxIn {
-		sigHashes := txscript.NewTxSigHashes(newtx,
-			txscript.NewCannedPrevOutputFetcher(prevPkScript, prevAmountSat))
-
-		aliceSig, err := txscript.RawTxInWitnessSignature(
-			newtx,
-			sigHashes,
-			txIdx,
-			prevAmountSat,
-			redeemScript,
-			txscript.SigHashAll,
-			aliceKey,
-		)
+// signBip112MultiSig unlocks the bip112 script with OP_0 <aliceSig> <bobSig> <mulsig preimage>,
+// the keys must be in the order of the multisig pubkeys
+func signBip112MultiSig(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	witnessScript, preimage []byte, keys []*btcec.PrivateKey) (wire.TxWitness, error) {
+	witness := wire.TxWitness{[]byte{}}
+	for _, prvkey := range keys {
+		sig, err := txscript.RawTxInWitnessSignature(tx, sigHashes, idx, amount,
+			witnessScript, txscript.SigHashAll, prvkey)
 		if err != nil {
-			panic(err)
+			return nil, err
 		}
+		witness = append(witness, sig)
+	}
+	return append(witness, preimage, witnessScript), nil
+}
 
-		// txin using time lock
-		if useTimelock {
-			txin.Witness = wire.TxWitness{aliceSig, timelockPreimage, redeemScript}
-		} else {
-			bobSig, err := txscript.RawTxInWitnessSignature(
-				newtx,
-				sigHashes,
-				txIdx,
-				prevAmountSat,
-				redeemScript, // the actual script to signed
-				txscript.SigHashAll,
-				bobKey,
-			)
-			if err != nil {
-				panic(err)
+// bip112Script is the script of CreateBip112P2wsh
+type bip112Script struct {
+	timelockHash []byte
+	timelockKey  []byte
+	mulsigHash   []byte
+	mulsigKeys   [][]byte
+}
+
+// parseBip112Script matches the script against the lock script of CreateBip112P2wsh
+func parseBip112Script(script []byte) (*bip112Script, bool) {
+	// zero is a placeholder of a push, the timelock number can be a small int or a push
+	const anyNumber = 0xff
+	template := []byte{
+		txscript.OP_HASH160, txscript.OP_DUP, 0, txscript.OP_EQUAL,
+		txscript.OP_IF,
+		txscript.OP_DROP, anyNumber, txscript.OP_CHECKSEQUENCEVERIFY, txscript.OP_DROP,
+		0, txscript.OP_CHECKSIG,
+		txscript.OP_ELSE,
+		0, txscript.OP_EQUALVERIFY,
+		txscript.OP_2, 0, 0, txscript.OP_2, txscript.OP_CHECKMULTISIG,
+		txscript.OP_ENDIF,
+	}
+
+	var pushes [][]byte
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	for i := 0; tokenizer.Next(); i++ {
+		if i >= len(template) {
+			return nil, false
+		}
+		switch op := tokenizer.Opcode(); template[i] {
+		case 0:
+			if op == txscript.OP_0 || op > txscript.OP_PUSHDATA4 {
+				return nil, false
+			}
+			pushes = append(pushes, tokenizer.Data())
+		case anyNumber:
+			if op > txscript.OP_PUSHDATA4 && !txscript.IsSmallInt(op) {
+				return nil, false
+			}
+		default:
+			if op != template[i] {
+				return nil, false
 			}
-			txin.Witness = wire.TxWitness{[]byte{}, aliceSig, bobSig, mulsigPreimage, redeemScript}
 		}
 	}
+	if tokenizer.Err() != nil || len(pushes) != 5 {
+		return nil, false
+	}
 
-	return newtx
+	return &bip112Script{
+		timelockHash: pushes[0],
+		timelockKey:  pushes[1],
+		mulsigHash:   pushes[2],
+		mulsigKeys:   pushes[3:],
+	}, true
+}
+
+// witnessItems selects the branch by the HASH160 preimage in the psbt input
+func (s *bip112Script) witnessItems(pin *psbt.PInput) ([][]byte, error) {
+	for _, unknown := range pin.Unknowns {
+		if len(unknown.Key) == 0 || unknown.Key[0] != psbtInHash160 ||
+			!bytes.Equal(unknown.Key[1:], btcutil.Hash160(unknown.Value)) {
+			continue
+		}
+
+		switch hash := unknown.Key[1:]; {
+		case bytes.Equal(hash, s.timelockHash):
+			sigs := partialSigsOf(pin, [][]byte{s.timelockKey}, 1)
+			if len(sigs) != 1 {
+				return nil, fmt.Errorf("%w: no signature of the timelock key", ErrInvalidPsbt)
+			}
+			return [][]byte{sigs[0], unknown.Value}, nil
+		case bytes.Equal(hash, s.mulsigHash):
+			sigs := partialSigsOf(pin, s.mulsigKeys, len(s.mulsigKeys))
+			if len(sigs) != len(s.mulsigKeys) {
+				return nil, fmt.Errorf("%w: %d of %d multisig signatures", ErrInvalidPsbt, len(sigs), len(s.mulsigKeys))
+			}
+			return append([][]byte{{}}, append(sigs, unknown.Value)...), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no preimage of the bip112 branches", ErrInvalidPsbt)
 }
@@ -0,0 +1,23 @@
+package example
+
+import "testing"
+
+func TestCreateBip112P2wsh(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	for _, useTimelock := range []bool{true, false} {
+		builder, err := newBip112P2wshBuilder(testNet, alice.PubKey(), bob.PubKey(), testPool(100000), 50000, 2,
+			10, useTimelock, []byte("timelock"), []byte("multisig"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := CreateBip112P2wsh(testNet, alice, bob, testPool(100000), 50000, 2,
+			10, useTimelock, []byte("timelock"), []byte("multisig"))
+		if err != nil {
+			t.Fatalf("timelock %t: %v", useTimelock, err)
+		}
+		if useTimelock && tx.TxIn[0].Sequence != 10 {
+			t.Errorf("sequence %d, want 10", tx.TxIn[0].Sequence)
+		}
+		testVerify(t, tx, builder.Pool)
+	}
+}
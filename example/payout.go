@@ -0,0 +1,127 @@
+package example
+
+import (
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// payoutSequence signals bip125 so every version of a payout can be replaced
+const payoutSequence = wire.MaxTxInSequenceNum - 2
+
+// Payout is a pending payment to many recipients, new recipients are added by replacing it
+// instead of creating another transaction. Every version keeps all the inputs of the previous one,
+// so any two versions conflict and only one of them can confirm.
+type Payout struct {
+	ChangeAddress btcutil.Address
+	// Versions are the signed transactions from the first one to the latest
+	Versions []*PayoutVersion
+	// Confirmed is the version mined, nil while pending
+	Confirmed *PayoutVersion
+}
+
+// PayoutVersion is a signed version of the payout
+type PayoutVersion struct {
+	Tx *wire.MsgTx
+	// Inputs are the utxos in the order of the inputs
+	Inputs []*UTXO
+	// Recipients are the recipients of the previous version followed by the new ones
+	Recipients []*Recipient
+	Fee        int64
+}
+
+// NewPayout builds the first version of the payout from the utxos of the pool, the inputs signal bip125
+func NewPayout(pool []*UTXO, recipients []*Recipient, changeAddress btcutil.Address, feeRate int64) (*Payout, error) {
+	builder := &TxBuilder{
+		Pool:          replaceableUTXOs(pool),
+		Recipients:    recipients,
+		ChangeAddress: changeAddress,
+		FeeRate:       feeRate,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		return nil, err
+	}
+	inputs, err := spentUTXOs(tx, builder.Pool)
+	if err != nil {
+		return nil, err
+	}
+	return &Payout{
+		ChangeAddress: changeAddress,
+		Versions: []*PayoutVersion{{
+			Tx:         tx,
+			Inputs:     inputs,
+			Recipients: slices.Clone(recipients),
+			Fee:        txFee(tx, inputs),
+		}},
+	}, nil
+}
+
+// Latest is the version in the mempool
+func (p *Payout) Latest() *PayoutVersion {
+	return p.Versions[len(p.Versions)-1]
+}
+
+// AddRecipients replaces the latest version by a transaction paying the previous and the new recipients.
+// The change pays them first, then the utxos of the pool are added, they must be confirmed by bip125.
+// The replacement pays the fee rate, raised to the minimum fee of CheckReplacement if it's not enough.
+func (p *Payout) AddRecipients(recipients []*Recipient, pool []*UTXO, feeRate int64) (*wire.MsgTx, error) {
+	if p.Confirmed != nil {
+		return nil, fmt.Errorf("%w: the payout is confirmed by %s", ErrReplacementRejected, p.Confirmed.Tx.TxHash())
+	}
+	latest := p.Latest()
+
+	var extra []*UTXO
+	for _, utxo := range replaceableUTXOs(pool) {
+		if !slices.ContainsFunc(latest.Inputs, func(input *UTXO) bool { return input.OutPoint == utxo.OutPoint }) {
+			extra = append(extra, utxo)
+		}
+	}
+	builder := &TxBuilder{
+		Inputs:        latest.Inputs,
+		Pool:          extra,
+		Recipients:    append(slices.Clone(latest.Recipients), recipients...),
+		ChangeAddress: p.ChangeAddress,
+		FeeRate:       feeRate,
+	}
+
+	tx, inputs, err := buildReplacement(latest.Tx, builder, nil)
+	if err != nil {
+		return nil, err
+	}
+	p.Versions = append(p.Versions, &PayoutVersion{
+		Tx:         tx,
+		Inputs:     inputs,
+		Recipients: builder.Recipients,
+		Fee:        txFee(tx, inputs),
+	})
+	return tx, nil
+}
+
+// Confirm records the version mined, any version can confirm before the latest replaces it in every mempool.
+// It returns the recipients added after the confirmed version, they aren't paid and need another payout.
+func (p *Payout) Confirm(txid chainhash.Hash) ([]*Recipient, error) {
+	for _, version := range p.Versions {
+		if version.Tx.TxHash() == txid {
+			p.Confirmed = version
+			return slices.Clone(p.Latest().Recipients[len(version.Recipients):]), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: %s isn't a version of the payout", ErrInvalidTx, txid)
+}
+
+// replaceableUTXOs copies the utxos, the final sequences are lowered to signal bip125
+func replaceableUTXOs(pool []*UTXO) []*UTXO {
+	utxos := make([]*UTXO, 0, len(pool))
+	for _, utxo := range pool {
+		spend := *utxo
+		if spend.sequence() >= wire.MaxTxInSequenceNum-1 {
+			spend.Sequence = payoutSequence
+		}
+		utxos = append(utxos, &spend)
+	}
+	return utxos
+}
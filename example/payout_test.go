@@ -0,0 +1,96 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+)
+
+func TestPayout(t *testing.T) {
+	utxos := testUTXOs(t, 30000, 40000, 50000)
+	first := []*Recipient{{Address: testAddress(t, 2), Amount: 20000}}
+	payout, err := NewPayout(utxos[:2], first, testAddress(t, 1), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v1 := payout.Latest()
+	testVerify(t, v1.Tx, v1.Inputs)
+	for _, txin := range v1.Tx.TxIn {
+		if txin.Sequence != payoutSequence {
+			t.Errorf("sequence %#x doesn't signal bip125", txin.Sequence)
+		}
+	}
+
+	// the change pays the second recipient
+	tx, err := payout.AddRecipients([]*Recipient{{Address: testAddress(t, 3), Amount: 5000}}, nil, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v2 := payout.Latest()
+	if len(payout.Versions) != 2 || v2.Tx != tx || len(v2.Recipients) != 2 || !conflicts(v1.Tx, v2.Tx) {
+		t.Fatalf("versions %d, recipients %d", len(payout.Versions), len(v2.Recipients))
+	}
+	testVerify(t, v2.Tx, v2.Inputs)
+	if v2.Fee <= v1.Fee {
+		t.Errorf("fee %d, the previous version paid %d", v2.Fee, v1.Fee)
+	}
+
+	// the third recipient needs another utxo of the pool, the inputs of the previous version are kept
+	if _, err := payout.AddRecipients([]*Recipient{{Address: testAddress(t, 4), Amount: 50000}}, utxos, 2); err != nil {
+		t.Fatal(err)
+	}
+	v3 := payout.Latest()
+	if len(v3.Inputs) <= len(v2.Inputs) {
+		t.Fatalf("inputs %d, the previous version has %d", len(v3.Inputs), len(v2.Inputs))
+	}
+	for idx, input := range v2.Inputs {
+		if v3.Inputs[idx].OutPoint != input.OutPoint {
+			t.Errorf("input %d: %s, want %s", idx, v3.Inputs[idx].OutPoint, input.OutPoint)
+		}
+	}
+	testVerify(t, v3.Tx, v3.Inputs)
+	check, err := CheckReplacement(v2.Tx, v3.Tx, prevOutFetcher(v3.Inputs), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Err(); err != nil {
+		t.Errorf("%v\n%s", err, check)
+	}
+}
+
+func TestPayoutConfirm(t *testing.T) {
+	utxos := testUTXOs(t, 30000, 40000, 50000)
+	payout, err := NewPayout(utxos, []*Recipient{{Address: testAddress(t, 2), Amount: 20000}}, testAddress(t, 1), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := byte(3); i < 5; i++ {
+		if _, err := payout.AddRecipients([]*Recipient{{Address: testAddress(t, i), Amount: 10000}}, utxos, 2); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := payout.Confirm(chainhash.Hash{}); !errors.Is(err, ErrInvalidTx) {
+		t.Errorf("unknown txid got %v, want ErrInvalidTx", err)
+	}
+
+	// the first version is mined, the recipients of the replacements aren't paid
+	unpaid, err := payout.Confirm(payout.Versions[0].Tx.TxHash())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(unpaid) != 2 || unpaid[0].Address.String() != testAddress(t, 3).String() ||
+		unpaid[1].Address.String() != testAddress(t, 4).String() {
+		t.Errorf("unpaid %v", unpaid)
+	}
+	if _, err := payout.AddRecipients(unpaid, nil, 2); !errors.Is(err, ErrReplacementRejected) {
+		t.Errorf("a confirmed payout got %v, want ErrReplacementRejected", err)
+	}
+
+	// every recipient is paid by the latest version
+	unpaid, err = payout.Confirm(payout.Latest().Tx.TxHash())
+	if err != nil || len(unpaid) != 0 {
+		t.Errorf("unpaid %v, %v", unpaid, err)
+	}
+}
@@ -0,0 +1,725 @@
+package example
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/sha256"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// the key types of the preimages of an input, the psbt package keeps them as unknown fields
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki
+const (
+	psbtInRipemd160 = 0x0a
+	psbtInSha256    = 0x0b
+	psbtInHash160   = 0x0c
+	psbtInHash256   = 0x0d
+)
+
+// KeyOrigin is the bip32 origin of a pubkey, the fingerprint of the master key and the derivation path
+type KeyOrigin struct {
+	PubKey      *btcec.PublicKey
+	Fingerprint uint32
+	Path        []uint32
+}
+
+// NewPsbt is the creator and the updater of BIP174, the utxos are in the order of the inputs.
+// The segwit inputs get the witness utxo, the legacy p2pkh and p2sh inputs get the previous
+// transaction as the non-witness utxo, so the UTXO of a legacy input must have the PrevTx.
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0174.mediawiki
+func NewPsbt(tx *wire.MsgTx, utxos []*UTXO) (*psbt.Packet, error) {
+	if len(tx.TxIn) != len(utxos) {
+		return nil, fmt.Errorf("%w: %d inputs, %d utxos", ErrInvalidPsbt, len(tx.TxIn), len(utxos))
+	}
+
+	packet, err := psbt.NewFromUnsignedTx(tx)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	for idx, utxo := range utxos {
+		if tx.TxIn[idx].PreviousOutPoint != utxo.OutPoint {
+			return nil, fmt.Errorf("%w: input %d doesn't spend %s", ErrInvalidPsbt, idx, utxo.OutPoint)
+		}
+		if err := updatePsbtInput(&packet.Inputs[idx], utxo); err != nil {
+			return nil, fmt.Errorf("update input %d: %w", idx, err)
+		}
+	}
+	return packet, nil
+}
+
+func updatePsbtInput(pin *psbt.PInput, utxo *UTXO) error {
+	switch utxo.SpendType {
+	case SpendP2PKH, SpendP2SHMultiSig:
+		if err := checkPrevTx(utxo); err != nil {
+			return err
+		}
+		pin.NonWitnessUtxo = utxo.PrevTx
+	default:
+		pin.WitnessUtxo = wire.NewTxOut(utxo.Amount, utxo.PkScript)
+	}
+
+	var leafScript *psbt.TaprootTapLeafScript
+	switch utxo.SpendType {
+	case SpendP2PKH, SpendP2WPKH:
+	case SpendP2SHMultiSig, SpendP2SHP2WPKH:
+		pin.RedeemScript = utxo.Script
+	case SpendP2WSHMultiSig, SpendBip112Timelock, SpendBip112MultiSig:
+		pin.WitnessScript = utxo.Script
+	case SpendP2SHP2WSHMultiSig:
+		pin.RedeemScript = p2wshProgram(utxo.Script)
+		pin.WitnessScript = utxo.Script
+	case SpendP2TRKeyPath, SpendMuSig2:
+		if utxo.TapInternalKey == nil {
+			return fmt.Errorf("%w: no taproot internal key", ErrInvalidKey)
+		}
+		pin.TaprootInternalKey = schnorr.SerializePubKey(utxo.TapInternalKey)
+		pin.TaprootMerkleRoot = utxo.TapMerkleRoot
+		if len(utxo.MuSig2Signers) > 0 {
+			if err := setPsbtMuSig2Signers(pin, utxo.MuSig2Signers); err != nil {
+				return err
+			}
+		}
+	case SpendMiniscript:
+		if utxo.Miniscript == nil {
+			return fmt.Errorf("%w: no miniscript", ErrInvalidMiniscript)
+		}
+		if !utxo.Miniscript.tapscript {
+			pin.WitnessScript = utxo.Script
+			break
+		}
+		fallthrough
+	case SpendP2TRScriptPath:
+		ctrlBlock, err := txscript.ParseControlBlock(utxo.ControlBlock)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		leafScript = &psbt.TaprootTapLeafScript{
+			ControlBlock: utxo.ControlBlock,
+			Script:       utxo.Script,
+			LeafVersion:  ctrlBlock.LeafVersion,
+		}
+		pin.TaprootLeafScript = []*psbt.TaprootTapLeafScript{leafScript}
+		pin.TaprootInternalKey = schnorr.SerializePubKey(ctrlBlock.InternalKey)
+		pin.TaprootMerkleRoot = ctrlBlock.RootHash(utxo.Script)
+	default:
+		return fmt.Errorf("unsupported spend type %s", utxo.SpendType)
+	}
+
+	if utxo.Preimage != nil {
+		pin.Unknowns = append(pin.Unknowns, &psbt.Unknown{
+			Key:   append([]byte{psbtInHash160}, btcutil.Hash160(utxo.Preimage)...),
+			Value: utxo.Preimage,
+		})
+	}
+
+	for _, origin := range utxo.Origins {
+		if txscript.IsPayToTaproot(utxo.PkScript) {
+			derivation := &psbt.TaprootBip32Derivation{
+				XOnlyPubKey:          schnorr.SerializePubKey(origin.PubKey),
+				MasterKeyFingerprint: origin.Fingerprint,
+				Bip32Path:            origin.Path,
+			}
+			if leafScript != nil && scriptHasData(leafScript.Script, derivation.XOnlyPubKey) {
+				leafHash := txscript.NewTapLeaf(leafScript.LeafVersion, leafScript.Script).TapHash()
+				derivation.LeafHashes = [][]byte{leafHash[:]}
+			}
+			pin.TaprootBip32Derivation = append(pin.TaprootBip32Derivation, derivation)
+			continue
+		}
+
+		// the pubkey is serialized as it is in the script
+		pubkey := signingPubKey(orBytes(utxo.Script, utxo.PkScript), origin.PubKey)
+		if pubkey == nil {
+			pubkey = origin.PubKey.SerializeCompressed()
+		}
+		pin.Bip32Derivation = append(pin.Bip32Derivation, &psbt.Bip32Derivation{
+			PubKey:               pubkey,
+			MasterKeyFingerprint: origin.Fingerprint,
+			Bip32Path:            origin.Path,
+		})
+	}
+	return nil
+}
+
+// SignPsbt is the signer of BIP174, every key signs all the inputs it can sign.
+// The cosigners sign their own copies of the psbt and the combiner merges them.
+// It returns the number of the signatures added.
+func SignPsbt(packet *psbt.Packet, keys ...*btcec.PrivateKey) (int, error) {
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return 0, err
+	}
+	tx := packet.UnsignedTx
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+
+	var signed int
+	for idx := range packet.Inputs {
+		pin := &packet.Inputs[idx]
+		if pin.FinalScriptSig != nil || pin.FinalScriptWitness != nil {
+			continue
+		}
+
+		prevOut := fetcher.FetchPrevOutput(tx.TxIn[idx].PreviousOutPoint)
+		for _, prvkey := range keys {
+			var n int
+			if txscript.IsPayToTaproot(prevOut.PkScript) {
+				n, err = signPsbtTaproot(tx, sigHashes, idx, pin, prevOut, prvkey)
+			} else {
+				n, err = signPsbtECDSA(tx, sigHashes, idx, pin, prevOut, prvkey)
+			}
+			if err != nil {
+				return signed, fmt.Errorf("sign input %d: %w", idx, err)
+			}
+			signed += n
+		}
+	}
+	return signed, nil
+}
+
+// checkPrevTx checks the PrevTx has the output of the utxo, the legacy sighash doesn't commit to the amount
+// so the signer must find it in the previous transaction
+func checkPrevTx(utxo *UTXO) error {
+	if utxo.PrevTx == nil {
+		return fmt.Errorf("%w: the legacy input %s needs the previous transaction", ErrInvalidPsbt, utxo.OutPoint)
+	}
+	if utxo.PrevTx.TxHash() != utxo.OutPoint.Hash || int(utxo.OutPoint.Index) >= len(utxo.PrevTx.TxOut) {
+		return fmt.Errorf("%w: the previous transaction %s doesn't have %s", ErrInvalidPsbt,
+			utxo.PrevTx.TxHash(), utxo.OutPoint)
+	}
+	txout := utxo.PrevTx.TxOut[utxo.OutPoint.Index]
+	if txout.Value != utxo.Amount || !bytes.Equal(txout.PkScript, utxo.PkScript) {
+		return fmt.Errorf("%w: %s isn't the output of the previous transaction", ErrInvalidPsbt, utxo.OutPoint)
+	}
+	return nil
+}
+
+// psbtPrevOutFetcher returns the fetcher of the utxos of all the inputs
+func psbtPrevOutFetcher(packet *psbt.Packet) (*txscript.MultiPrevOutFetcher, error) {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for idx, txin := range packet.UnsignedTx.TxIn {
+		pin := packet.Inputs[idx]
+		switch {
+		case pin.WitnessUtxo != nil:
+			fetcher.AddPrevOut(txin.PreviousOutPoint, pin.WitnessUtxo)
+		case pin.NonWitnessUtxo != nil && int(txin.PreviousOutPoint.Index) < len(pin.NonWitnessUtxo.TxOut):
+			fetcher.AddPrevOut(txin.PreviousOutPoint, pin.NonWitnessUtxo.TxOut[txin.PreviousOutPoint.Index])
+		default:
+			return nil, fmt.Errorf("%w: no utxo of input %d", ErrInvalidPsbt, idx)
+		}
+	}
+	return fetcher, nil
+}
+
+// signPsbtECDSA adds the partial signature of the key if the key is in the script of the input
+func signPsbtECDSA(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, pin *psbt.PInput,
+	prevOut *wire.TxOut, prvkey *btcec.PrivateKey) (int, error) {
+	script, witness, err := psbtSigningScript(pin, prevOut.PkScript)
+	if err != nil {
+		return 0, err
+	}
+
+	pubkey := signingPubKey(script, prvkey.PubKey())
+	if pubkey == nil {
+		return 0, nil
+	}
+	for _, partialSig := range pin.PartialSigs {
+		if bytes.Equal(partialSig.PubKey, pubkey) {
+			return 0, nil
+		}
+	}
+
+	var sig []byte
+	if witness {
+		sig, err = txscript.RawTxInWitnessSignature(tx, sigHashes, idx, prevOut.Value,
+			script, txscript.SigHashAll, prvkey)
+	} else {
+		sig, err = txscript.RawTxInSignature(tx, idx, script, txscript.SigHashAll, prvkey)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	pin.PartialSigs = append(pin.PartialSigs, &psbt.PartialSig{PubKey: pubkey, Signature: sig})
+	return 1, nil
+}
+
+// psbtSigningScript returns the script committed by the signature and whether it's a segwit input
+func psbtSigningScript(pin *psbt.PInput, pkScript []byte) ([]byte, bool, error) {
+	script := pkScript
+	if txscript.IsPayToScriptHash(script) {
+		if pin.RedeemScript == nil || !bytes.Equal(script[2:22], btcutil.Hash160(pin.RedeemScript)) {
+			return nil, false, fmt.Errorf("%w: redeem script doesn't match", ErrInvalidPsbt)
+		}
+		script = pin.RedeemScript
+	}
+
+	switch {
+	case txscript.IsPayToWitnessScriptHash(script):
+		witnessProg := sha256.Sum256(pin.WitnessScript)
+		if pin.WitnessScript == nil || !bytes.Equal(script[2:], witnessProg[:]) {
+			return nil, false, fmt.Errorf("%w: witness script doesn't match", ErrInvalidPsbt)
+		}
+		return pin.WitnessScript, true, nil
+	case txscript.IsPayToWitnessPubKeyHash(script):
+		return script, true, nil
+	default:
+		return script, false, nil
+	}
+}
+
+// signPsbtTaproot adds the key path signature if the key is the internal key,
+// and the script path signatures of every leaf having the key
+func signPsbtTaproot(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, pin *psbt.PInput,
+	prevOut *wire.TxOut, prvkey *btcec.PrivateKey) (int, error) {
+	xonly := schnorr.SerializePubKey(prvkey.PubKey())
+
+	var signed int
+	if pin.TaprootKeySpendSig == nil && bytes.Equal(pin.TaprootInternalKey, xonly) {
+		sig, err := txscript.RawTxInTaprootSignature(tx, sigHashes, idx, prevOut.Value, prevOut.PkScript,
+			pin.TaprootMerkleRoot, txscript.SigHashDefault, prvkey)
+		if err != nil {
+			return 0, err
+		}
+		pin.TaprootKeySpendSig = sig
+		signed++
+	}
+
+	for _, leafScript := range pin.TaprootLeafScript {
+		// pkh() of miniscript has the hash of the key
+		if !scriptHasData(leafScript.Script, xonly) && !scriptHasData(leafScript.Script, btcutil.Hash160(xonly)) {
+			continue
+		}
+
+		leaf := txscript.NewTapLeaf(leafScript.LeafVersion, leafScript.Script)
+		leafHash := leaf.TapHash()
+		spendSig := &psbt.TaprootScriptSpendSig{
+			XOnlyPubKey: xonly,
+			LeafHash:    leafHash[:],
+			SigHash:     txscript.SigHashDefault,
+		}
+		if slices.ContainsFunc(pin.TaprootScriptSpendSig, spendSig.EqualKey) {
+			continue
+		}
+
+		sig, err := txscript.RawTxInTapscriptSignature(tx, sigHashes, idx, prevOut.Value, prevOut.PkScript,
+			leaf, txscript.SigHashDefault, prvkey)
+		if err != nil {
+			return 0, err
+		}
+		spendSig.Signature = sig
+		pin.TaprootScriptSpendSig = append(pin.TaprootScriptSpendSig, spendSig)
+		signed++
+	}
+	return signed, nil
+}
+
+// signingPubKey returns the serialization of the pubkey found in the script, either the pubkey or its hash,
+// nil if the script doesn't have it
+func signingPubKey(script []byte, pubkey *btcec.PublicKey) []byte {
+	for _, serialized := range [][]byte{pubkey.SerializeCompressed(), pubkey.SerializeUncompressed()} {
+		if scriptHasData(script, serialized) || scriptHasData(script, btcutil.Hash160(serialized)) {
+			return serialized
+		}
+	}
+	return nil
+}
+
+func scriptHasData(script, data []byte) bool {
+	pushes, err := txscript.PushedData(script)
+	if err != nil {
+		return false
+	}
+	return slices.ContainsFunc(pushes, func(push []byte) bool {
+		return bytes.Equal(push, data)
+	})
+}
+
+// CombinePsbt is the combiner of BIP174, it merges the psbts of the same transaction
+func CombinePsbt(packets ...*psbt.Packet) (*psbt.Packet, error) {
+	if len(packets) == 0 {
+		return nil, fmt.Errorf("%w: nothing to combine", ErrInvalidPsbt)
+	}
+
+	combined, err := copyPsbt(packets[0])
+	if err != nil {
+		return nil, err
+	}
+	txHash := combined.UnsignedTx.TxHash()
+
+	for _, packet := range packets[1:] {
+		if other := packet.UnsignedTx.TxHash(); other != txHash {
+			return nil, fmt.Errorf("%w: can't combine the psbts of %s and %s", ErrInvalidPsbt, txHash, other)
+		}
+		for idx := range combined.Inputs {
+			combinePsbtInput(&combined.Inputs[idx], &packet.Inputs[idx])
+		}
+		for idx := range combined.Outputs {
+			combinePsbtOutput(&combined.Outputs[idx], &packet.Outputs[idx])
+		}
+		combined.XPubs = mergeFields(combined.XPubs, packet.XPubs, func(a, b psbt.XPub) bool {
+			return bytes.Equal(a.ExtendedKey, b.ExtendedKey)
+		})
+		combined.Unknowns = mergeFields(combined.Unknowns, packet.Unknowns, sameUnknown)
+	}
+
+	// the musig2 inputs are signed once the combined psbt has the partial signatures of all the signers
+	for idx := range combined.Inputs {
+		if err := aggregatePsbtMuSig2(combined, idx); err != nil {
+			return nil, fmt.Errorf("combine input %d: %w", idx, err)
+		}
+	}
+	return combined, nil
+}
+
+func copyPsbt(packet *psbt.Packet) (*psbt.Packet, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	copied, err := psbt.NewFromRawBytes(&buf, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	return copied, nil
+}
+
+// mergeFields appends the fields of src which aren't in dst
+func mergeFields[T any](dst, src []T, same func(a, b T) bool) []T {
+	for _, field := range src {
+		if !slices.ContainsFunc(dst, func(f T) bool { return same(f, field) }) {
+			dst = append(dst, field)
+		}
+	}
+	return dst
+}
+
+// orBytes returns a if it's set, otherwise b
+func orBytes(a, b []byte) []byte {
+	if a != nil {
+		return a
+	}
+	return b
+}
+
+func sameUnknown(a, b *psbt.Unknown) bool {
+	return bytes.Equal(a.Key, b.Key)
+}
+
+func sameBip32Derivation(a, b *psbt.Bip32Derivation) bool {
+	return bytes.Equal(a.PubKey, b.PubKey)
+}
+
+func sameTaprootBip32Derivation(a, b *psbt.TaprootBip32Derivation) bool {
+	return bytes.Equal(a.XOnlyPubKey, b.XOnlyPubKey)
+}
+
+func combinePsbtInput(dst, src *psbt.PInput) {
+	dst.NonWitnessUtxo = cmp.Or(dst.NonWitnessUtxo, src.NonWitnessUtxo)
+	dst.WitnessUtxo = cmp.Or(dst.WitnessUtxo, src.WitnessUtxo)
+	dst.SighashType = cmp.Or(dst.SighashType, src.SighashType)
+	dst.RedeemScript = orBytes(dst.RedeemScript, src.RedeemScript)
+	dst.WitnessScript = orBytes(dst.WitnessScript, src.WitnessScript)
+	dst.FinalScriptSig = orBytes(dst.FinalScriptSig, src.FinalScriptSig)
+	dst.FinalScriptWitness = orBytes(dst.FinalScriptWitness, src.FinalScriptWitness)
+	dst.TaprootKeySpendSig = orBytes(dst.TaprootKeySpendSig, src.TaprootKeySpendSig)
+	dst.TaprootInternalKey = orBytes(dst.TaprootInternalKey, src.TaprootInternalKey)
+	dst.TaprootMerkleRoot = orBytes(dst.TaprootMerkleRoot, src.TaprootMerkleRoot)
+
+	dst.PartialSigs = mergeFields(dst.PartialSigs, src.PartialSigs, func(a, b *psbt.PartialSig) bool {
+		return bytes.Equal(a.PubKey, b.PubKey)
+	})
+	dst.Bip32Derivation = mergeFields(dst.Bip32Derivation, src.Bip32Derivation, sameBip32Derivation)
+	dst.TaprootScriptSpendSig = mergeFields(dst.TaprootScriptSpendSig, src.TaprootScriptSpendSig,
+		func(a, b *psbt.TaprootScriptSpendSig) bool {
+			return a.EqualKey(b)
+		})
+	dst.TaprootLeafScript = mergeFields(dst.TaprootLeafScript, src.TaprootLeafScript,
+		func(a, b *psbt.TaprootTapLeafScript) bool {
+			return bytes.Equal(a.ControlBlock, b.ControlBlock)
+		})
+	dst.TaprootBip32Derivation = mergeFields(dst.TaprootBip32Derivation, src.TaprootBip32Derivation,
+		sameTaprootBip32Derivation)
+	dst.Unknowns = mergeFields(dst.Unknowns, src.Unknowns, sameUnknown)
+}
+
+func combinePsbtOutput(dst, src *psbt.POutput) {
+	dst.RedeemScript = orBytes(dst.RedeemScript, src.RedeemScript)
+	dst.WitnessScript = orBytes(dst.WitnessScript, src.WitnessScript)
+	dst.TaprootInternalKey = orBytes(dst.TaprootInternalKey, src.TaprootInternalKey)
+	dst.TaprootTapTree = orBytes(dst.TaprootTapTree, src.TaprootTapTree)
+
+	dst.Bip32Derivation = mergeFields(dst.Bip32Derivation, src.Bip32Derivation, sameBip32Derivation)
+	dst.TaprootBip32Derivation = mergeFields(dst.TaprootBip32Derivation, src.TaprootBip32Derivation,
+		sameTaprootBip32Derivation)
+	dst.Unknowns = mergeFields(dst.Unknowns, src.Unknowns, sameUnknown)
+}
+
+// FinalizePsbt is the finalizer of BIP174, it builds the scriptSig and the witness of every input
+// from the signatures, the same as the builders do in process, then runs the extracted tx through
+// the script engine. The packet is left as it was if any input fails. Call psbt.Extract for the signed tx.
+func FinalizePsbt(packet *psbt.Packet) error {
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return err
+	}
+
+	inputs := slices.Clone(packet.Inputs)
+	for idx := range packet.Inputs {
+		pin := &packet.Inputs[idx]
+		if pin.FinalScriptSig != nil || pin.FinalScriptWitness != nil {
+			continue
+		}
+
+		err := aggregatePsbtMuSig2(packet, idx)
+		var sigScript []byte
+		var witness wire.TxWitness
+		if err == nil {
+			prevOut := fetcher.FetchPrevOutput(packet.UnsignedTx.TxIn[idx].PreviousOutPoint)
+			sigScript, witness, err = finalizePsbtInput(pin, prevOut.PkScript)
+		}
+		if err == nil {
+			err = setPsbtFinal(pin, sigScript, witness)
+		}
+		if err != nil {
+			packet.Inputs = inputs
+			return fmt.Errorf("finalize input %d: %w", idx, err)
+		}
+	}
+
+	if err := verifyPsbt(packet); err != nil {
+		packet.Inputs = inputs
+		return err
+	}
+	return nil
+}
+
+// verifyPsbt runs the extracted tx through the script engine once every input is final,
+// before that only the final inputs
+func verifyPsbt(packet *psbt.Packet) error {
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return err
+	}
+	if packet.IsComplete() {
+		tx, err := psbt.Extract(packet)
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		return VerifyTx(tx, fetcher)
+	}
+
+	// the sighashes don't commit to the scriptSigs and the witnesses of the other inputs
+	tx := packet.UnsignedTx.Copy()
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for idx, pin := range packet.Inputs {
+		if pin.FinalScriptSig == nil && pin.FinalScriptWitness == nil {
+			continue
+		}
+		tx.TxIn[idx].SignatureScript = pin.FinalScriptSig
+		if pin.FinalScriptWitness != nil {
+			if tx.TxIn[idx].Witness, err = readWitness(pin.FinalScriptWitness); err != nil {
+				return fmt.Errorf("%w: final witness of input %d: %v", ErrInvalidPsbt, idx, err)
+			}
+		}
+		if err := verifyInput(tx, fetcher, sigHashes, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setPsbtFinal keeps only the utxo, the final fields and the unknowns of the input
+func setPsbtFinal(pin *psbt.PInput, sigScript []byte, witness wire.TxWitness) error {
+	final := psbt.PInput{
+		NonWitnessUtxo: pin.NonWitnessUtxo,
+		WitnessUtxo:    pin.WitnessUtxo,
+		FinalScriptSig: sigScript,
+		Unknowns:       pin.Unknowns,
+	}
+	if len(witness) > 0 {
+		var buf bytes.Buffer
+		if err := psbt.WriteTxWitness(&buf, witness); err != nil {
+			return err
+		}
+		final.FinalScriptWitness = buf.Bytes()
+	}
+	*pin = final
+	return nil
+}
+
+func finalizePsbtInput(pin *psbt.PInput, pkScript []byte) ([]byte, wire.TxWitness, error) {
+	switch {
+	case txscript.IsPayToTaproot(pkScript):
+		witness, err := finalizeTaproot(pin)
+		return nil, witness, err
+	case txscript.IsPayToScriptHash(pkScript):
+		if pin.RedeemScript == nil {
+			return nil, nil, fmt.Errorf("%w: no redeem script", ErrInvalidPsbt)
+		}
+
+		// nested segwit pushes the witness program only
+		if txscript.IsWitnessProgram(pin.RedeemScript) {
+			witness, err := finalizeWitness(pin, pin.RedeemScript)
+			if err != nil {
+				return nil, nil, err
+			}
+			sigScript, err := txscript.NewScriptBuilder().AddData(pin.RedeemScript).Script()
+			if err != nil {
+				return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+			}
+			return sigScript, witness, nil
+		}
+
+		items, err := finalizeScriptItems(pin, pin.RedeemScript)
+		if err != nil {
+			return nil, nil, err
+		}
+		builder := txscript.NewScriptBuilder()
+		for _, item := range items {
+			builder.AddData(item)
+		}
+		sigScript, err := builder.AddData(pin.RedeemScript).Script()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		return sigScript, nil, nil
+	case txscript.IsWitnessProgram(pkScript):
+		witness, err := finalizeWitness(pin, pkScript)
+		return nil, witness, err
+	case txscript.IsPayToPubKeyHash(pkScript):
+		sig, pubkey, err := pubkeyHashSig(pin, pkScript)
+		if err != nil {
+			return nil, nil, err
+		}
+		sigScript, err := txscript.NewScriptBuilder().AddData(sig).AddData(pubkey).Script()
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		return sigScript, nil, nil
+	default:
+		return nil, nil, fmt.Errorf("%w: unsupported script %x", ErrInvalidPsbt, pkScript)
+	}
+}
+
+// finalizeWitness builds the witness of p2wpkh and p2wsh
+func finalizeWitness(pin *psbt.PInput, witnessProgram []byte) (wire.TxWitness, error) {
+	switch {
+	case txscript.IsPayToWitnessPubKeyHash(witnessProgram):
+		sig, pubkey, err := pubkeyHashSig(pin, witnessProgram)
+		if err != nil {
+			return nil, err
+		}
+		return wire.TxWitness{sig, pubkey}, nil
+	case txscript.IsPayToWitnessScriptHash(witnessProgram):
+		if pin.WitnessScript == nil {
+			return nil, fmt.Errorf("%w: no witness script", ErrInvalidPsbt)
+		}
+		items, err := finalizeScriptItems(pin, pin.WitnessScript)
+		if err != nil {
+			return nil, err
+		}
+		return append(wire.TxWitness(items), pin.WitnessScript), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported witness program %x", ErrInvalidPsbt, witnessProgram)
+	}
+}
+
+// pubkeyHashSig returns the signature of the pubkey whose hash is in the script
+func pubkeyHashSig(pin *psbt.PInput, script []byte) ([]byte, []byte, error) {
+	for _, partialSig := range pin.PartialSigs {
+		if scriptHasData(script, btcutil.Hash160(partialSig.PubKey)) {
+			return partialSig.Signature, partialSig.PubKey, nil
+		}
+	}
+	return nil, nil, fmt.Errorf("%w: no signature of the pubkey hash", ErrInvalidPsbt)
+}
+
+// finalizeScriptItems returns the items before the redeem script or the witness script,
+// it knows the multisig and the bip112 scripts
+func finalizeScriptItems(pin *psbt.PInput, script []byte) ([][]byte, error) {
+	if pubkeys, m, ok := parseMultiSigScript(script); ok {
+		sigs := partialSigsOf(pin, pubkeys, m)
+		if len(sigs) < m {
+			return nil, fmt.Errorf("%w: %d of %d signatures", ErrInvalidPsbt, len(sigs), m)
+		}
+		// OP_0 is a workaround of the off-by-one bug of OP_CHECKMULTISIG
+		return append([][]byte{{}}, sigs...), nil
+	}
+
+	if bip112, ok := parseBip112Script(script); ok {
+		return bip112.witnessItems(pin)
+	}
+	return nil, fmt.Errorf("%w: unsupported script %x", ErrInvalidPsbt, script)
+}
+
+// partialSigsOf returns at most m signatures in the order of the pubkeys
+func partialSigsOf(pin *psbt.PInput, pubkeys [][]byte, m int) [][]byte {
+	sigs := make([][]byte, 0, m)
+	for _, pubkey := range pubkeys {
+		if len(sigs) == m {
+			break
+		}
+		for _, partialSig := range pin.PartialSigs {
+			if bytes.Equal(partialSig.PubKey, pubkey) {
+				sigs = append(sigs, partialSig.Signature)
+				break
+			}
+		}
+	}
+	return sigs
+}
+
+// finalizeTaproot prefers the key path, otherwise it satisfies the first
+// checksig/checksigadd leaf having enough signatures
+func finalizeTaproot(pin *psbt.PInput) (wire.TxWitness, error) {
+	if pin.TaprootKeySpendSig != nil {
+		return wire.TxWitness{schnorrSigWithHashType(pin.TaprootKeySpendSig, pin.SighashType)}, nil
+	}
+
+	for _, leafScript := range pin.TaprootLeafScript {
+		pubkeys, threshold, ok := parseTapscriptMulti(leafScript.Script)
+		if !ok {
+			continue
+		}
+		leafHash := txscript.NewTapLeaf(leafScript.LeafVersion, leafScript.Script).TapHash()
+
+		// every pubkey gets either a signature or an empty vector, in reverse order
+		signed := 0
+		witness := make(wire.TxWitness, len(pubkeys), len(pubkeys)+2)
+		for i, pubkey := range pubkeys {
+			witness[len(pubkeys)-1-i] = []byte{}
+			if signed == threshold {
+				continue
+			}
+			for _, spendSig := range pin.TaprootScriptSpendSig {
+				if bytes.Equal(spendSig.XOnlyPubKey, pubkey) && bytes.Equal(spendSig.LeafHash, leafHash[:]) {
+					witness[len(pubkeys)-1-i] = schnorrSigWithHashType(spendSig.Signature, spendSig.SigHash)
+					signed++
+					break
+				}
+			}
+		}
+		if signed == threshold {
+			return append(witness, leafScript.Script, leafScript.ControlBlock), nil
+		}
+	}
+	return nil, fmt.Errorf("%w: no key path signature or satisfied leaf", ErrInvalidPsbt)
+}
+
+// schnorrSigWithHashType appends the sighash type unless it's SIGHASH_DEFAULT
+func schnorrSigWithHashType(sig []byte, hashType txscript.SigHashType) []byte {
+	if len(sig) == schnorr.SignatureSize && hashType != txscript.SigHashDefault {
+		return append(slices.Clip(sig), byte(hashType))
+	}
+	return sig
+}
@@ -0,0 +1,291 @@
+package example
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// signPsbtCopies signs a copy of the packet by each signer and combines them like the cosigners do
+func signPsbtCopies(t *testing.T, packet *psbt.Packet, signers ...*btcec.PrivateKey) *psbt.Packet {
+	t.Helper()
+	var copies []*psbt.Packet
+	for _, signer := range signers {
+		copied, err := copyPsbt(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n, err := SignPsbt(copied, signer); err != nil || n == 0 {
+			t.Fatalf("signed %d inputs: %v", n, err)
+		}
+		copies = append(copies, copied)
+	}
+	combined, err := CombinePsbt(copies...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return combined
+}
+
+// testExtractPsbt finalizes the packet and runs the script engine on the extracted tx
+func testExtractPsbt(t *testing.T, packet *psbt.Packet) *wire.MsgTx {
+	t.Helper()
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := FinalizePsbt(packet); err != nil {
+		t.Fatal(err)
+	}
+	tx, err := psbt.Extract(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for idx, txin := range tx.TxIn {
+		prevOut := fetcher.FetchPrevOutput(txin.PreviousOutPoint)
+		engine, err := txscript.NewEngine(prevOut.PkScript, tx, idx, txscript.StandardVerifyFlags,
+			nil, sigHashes, prevOut.Value, fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Execute(); err != nil {
+			t.Fatalf("input %d: %v", idx, err)
+		}
+	}
+	return tx
+}
+
+func TestPsbtSingleSigner(t *testing.T) {
+	prvkey := testKey(1)
+	p2pkh, err := btcutil.NewAddressPubKeyHash(btcutil.Hash160(prvkey.PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2pkhScript, err := txscript.PayToAddrScript(p2pkh)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		name  string
+		build func() (*psbt.Packet, error)
+	}{
+		{"p2pkh", func() (*psbt.Packet, error) {
+			return Pay2PubkeyHashPsbt(testNet, prvkey.PubKey(), testFundingTx(p2pkhScript, 60000), 30000, 3)
+		}},
+		{"p2wpkh", func() (*psbt.Packet, error) {
+			return Pay2WitnessPubkeyHashPsbt(testNet, prvkey.PubKey(), testPool(60000, 20000), 70000, 3)
+		}},
+		{"p2sh-p2wpkh", func() (*psbt.Packet, error) {
+			return Pay2NestedWitnessPubkeyHashPsbt(testNet, prvkey.PubKey(), testPool(60000), 30000, 3)
+		}},
+		{"taproot key path", func() (*psbt.Packet, error) {
+			return Pay2TaprootByKeyPathPsbt(testNet, prvkey.PubKey(), testPool(60000), 30000, 3)
+		}},
+	} {
+		packet, err := test.build()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		if n, err := SignPsbt(packet, prvkey); err != nil || n != len(packet.Inputs) {
+			t.Fatalf("%s: signed %d inputs: %v", test.name, n, err)
+		}
+		testExtractPsbt(t, packet)
+	}
+}
+
+func TestPsbtMultiSig(t *testing.T) {
+	alice, bob, cario, god := testKey(1), testKey(2), testKey(3), testKey(4)
+	for _, test := range []struct {
+		name    string
+		build   func() (*psbt.Packet, error)
+		signers []*btcec.PrivateKey
+	}{
+		{"p2wsh", func() (*psbt.Packet, error) {
+			return CreateP2WSHMultiSigPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+				testPool(60000), 30000, 3)
+		}, []*btcec.PrivateKey{alice, cario}},
+		{"p2sh-p2wsh", func() (*psbt.Packet, error) {
+			return Pay2NestedWitnessScriptHashPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+				testPool(60000), 30000, 3)
+		}, []*btcec.PrivateKey{bob, cario}},
+		{"bip112 multisig", func() (*psbt.Packet, error) {
+			return CreateBip112P2wshPsbt(testNet, alice.PubKey(), bob.PubKey(), testPool(60000), 30000, 3,
+				10, false, []byte("timelock"), []byte("multisig"))
+		}, []*btcec.PrivateKey{alice, bob}},
+		{"taproot script path", func() (*psbt.Packet, error) {
+			return PayToTaprootByPathPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(), nil,
+				testPool(60000), 30000, 3)
+		}, []*btcec.PrivateKey{alice, cario}},
+		{"taproot key path of the tree", func() (*psbt.Packet, error) {
+			return PayToTaprootByPathPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(), god.PubKey(),
+				testPool(60000), 30000, 3)
+		}, []*btcec.PrivateKey{god}},
+	} {
+		packet, err := test.build()
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+		testExtractPsbt(t, signPsbtCopies(t, packet, test.signers...))
+	}
+}
+
+func TestPsbtMuSig2(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	packet, err := MuSig2Psbt(testNet, alice.PubKey(), bob.PubKey(), testPool(60000), 30000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignPsbtMuSig2(packet, 0, []*btcec.PrivateKey{alice, testKey(3)}); err == nil {
+		t.Fatal("signed by a key out of the aggregated key")
+	}
+	if err := SignPsbtMuSig2(packet, 0, []*btcec.PrivateKey{alice, bob}); err != nil {
+		t.Fatal(err)
+	}
+	testExtractPsbt(t, packet)
+}
+
+func TestPsbtV2(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	packet, err := CreateP2WSHMultiSigPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		testPool(60000, 20000), 70000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet = signPsbtCopies(t, packet, alice, bob)
+
+	var v0 bytes.Buffer
+	if err := packet.Serialize(&v0); err != nil {
+		t.Fatal(err)
+	}
+	v2, err := EncodePsbtV2(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// both versions decode to the same packet
+	for _, raw := range [][]byte{v0.Bytes(), v2} {
+		decoded, err := DecodePsbt(raw)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := decoded.Serialize(&buf); err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf.Bytes(), v0.Bytes()) {
+			t.Errorf("decoded %x, want %x", buf.Bytes(), v0.Bytes())
+		}
+	}
+
+	b64, err := packet.B64Encode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := DecodePsbt([]byte(b64))
+	if err != nil {
+		t.Fatal(err)
+	}
+	testExtractPsbt(t, decoded)
+}
+
+func TestFinalizePsbtVerify(t *testing.T) {
+	prvkey := testKey(1)
+	packet, err := Pay2WitnessPubkeyHashPsbt(testNet, prvkey.PubKey(), testPool(60000), 30000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, err := Pay2WitnessPubkeyHashPsbt(testNet, prvkey.PubKey(), testPool(60000), 31000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := SignPsbt(other, prvkey); err != nil {
+		t.Fatal(err)
+	}
+
+	// the signature of another tx is well formed, only the script engine rejects it
+	packet.Inputs[0].PartialSigs = other.Inputs[0].PartialSigs
+	if err := FinalizePsbt(packet); !errors.Is(err, ErrScriptVerify) {
+		t.Fatalf("got %v, want ErrScriptVerify", err)
+	}
+	if packet.Inputs[0].FinalScriptWitness != nil || len(packet.Inputs[0].PartialSigs) == 0 {
+		t.Error("the packet is finalized anyway")
+	}
+
+	packet.Inputs[0].PartialSigs = nil
+	if _, err := SignPsbt(packet, prvkey); err != nil {
+		t.Fatal(err)
+	}
+	if err := FinalizePsbt(packet); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := psbt.Extract(packet); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// testFundingTx pays the amounts to the script, the utxos carry it as the previous transaction
+func testFundingTx(pkScript []byte, amounts ...int64) []*UTXO {
+	funding := wire.NewMsgTx(2)
+	funding.AddTxIn(wire.NewTxIn(&wire.OutPoint{Hash: chainhash.DoubleHashH([]byte("coinbase"))}, nil, nil))
+	for _, amount := range amounts {
+		funding.AddTxOut(wire.NewTxOut(amount, pkScript))
+	}
+	pool := make([]*UTXO, 0, len(amounts))
+	for idx, amount := range amounts {
+		pool = append(pool, &UTXO{
+			OutPoint: wire.OutPoint{Hash: funding.TxHash(), Index: uint32(idx)},
+			Amount:   amount,
+			PrevTx:   funding,
+		})
+	}
+	return pool
+}
+
+func TestPsbtP2SHMultiSig(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	_, address, err := multiSigOutput(testNet, MultiSigP2SH, 2,
+		[]*btcec.PublicKey{alice.PubKey(), bob.PubKey(), cario.PubKey()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkScript, err := txscript.PayToAddrScript(address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the legacy input can't be signed safely without the previous transaction
+	if _, err := Pay2ScriptHashPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		testPool(60000), 30000, 3); !errors.Is(err, ErrInvalidPsbt) {
+		t.Fatalf("got %v, want ErrInvalidPsbt", err)
+	}
+
+	packet, err := Pay2ScriptHashPsbt(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(),
+		testFundingTx(pkScript, 60000), 30000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if packet.Inputs[0].NonWitnessUtxo == nil || packet.Inputs[0].WitnessUtxo != nil {
+		t.Fatal("the legacy input needs the non-witness utxo only")
+	}
+
+	// alice and bob sign their own copies, the combiner merges the partial signatures
+	combined := signPsbtCopies(t, packet, alice, bob)
+	if len(combined.Inputs[0].PartialSigs) != 2 {
+		t.Fatalf("%d partial signatures", len(combined.Inputs[0].PartialSigs))
+	}
+	if err := FinalizePsbt(combined); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := psbt.Extract(combined); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,369 @@
+package example
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+// the key types of the musig2 fields of an input, the psbt package keeps them as unknown fields
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0373.mediawiki
+const (
+	psbtInMuSig2Participants = 0x1a
+	psbtInMuSig2PubNonce     = 0x1b
+	psbtInMuSig2PartialSig   = 0x1c
+)
+
+// psbtMuSig2 is the musig2 session of the key path of an input, the psbt has only its public parts
+type psbtMuSig2 struct {
+	// aggKey is the compressed aggregate key of the signers, the x-only key is the taproot internal key
+	aggKey []byte
+	// signers are in the order of the key aggregation
+	signers     []*btcec.PublicKey
+	pubNonces   map[string][musig2.PubNonceSize]byte
+	partialSigs map[string]*musig2.PartialSignature
+}
+
+// AddPsbtMuSig2Signers is the updater of BIP373, it adds the pubkeys aggregated by MuSig2InternalKey
+// to the internal key of the input. The creators of the builders add them if the utxo has the MuSig2Signers,
+// the key path of PayToTaprootTreePsbt needs it before the signers exchange the nonces.
+func AddPsbtMuSig2Signers(packet *psbt.Packet, idx int, signers []*btcec.PublicKey) error {
+	if idx < 0 || idx >= len(packet.Inputs) {
+		return fmt.Errorf("%w: no input %d", ErrInvalidPsbt, idx)
+	}
+	return setPsbtMuSig2Signers(&packet.Inputs[idx], signers)
+}
+
+// setPsbtMuSig2Signers writes the signers sorted like MuSig2InternalKey, so the aggregation
+// in the order of the field is the internal key
+func setPsbtMuSig2Signers(pin *psbt.PInput, signers []*btcec.PublicKey) error {
+	sorted := slices.Clone(signers)
+	slices.SortFunc(sorted, func(a, b *btcec.PublicKey) int {
+		return bytes.Compare(a.SerializeCompressed(), b.SerializeCompressed())
+	})
+	aggKey, _, _, err := musig2.AggregateKeys(sorted, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	if !bytes.Equal(pin.TaprootInternalKey, schnorr.SerializePubKey(aggKey.PreTweakedKey)) {
+		return fmt.Errorf("%w: the keys aren't aggregated to the internal key of the input", ErrInvalidKey)
+	}
+
+	value := make([]byte, 0, len(sorted)*btcec.PubKeyBytesLenCompressed)
+	for _, signer := range sorted {
+		value = append(value, signer.SerializeCompressed()...)
+	}
+	pin.Unknowns = mergeFields(pin.Unknowns, []*psbt.Unknown{{
+		Key:   append([]byte{psbtInMuSig2Participants}, aggKey.PreTweakedKey.SerializeCompressed()...),
+		Value: value,
+	}}, sameUnknown)
+	return nil
+}
+
+// parsePsbtMuSig2 reads the musig2 fields of the key path, the session is nil without the participants
+// of the internal key. The nonces and the partial signatures of a tapscript leaf aren't supported.
+func parsePsbtMuSig2(pin *psbt.PInput) (*psbtMuSig2, error) {
+	var session *psbtMuSig2
+	for _, unknown := range pin.Unknowns {
+		key := unknown.Key
+		if key[0] != psbtInMuSig2Participants || len(key) != 1+btcec.PubKeyBytesLenCompressed {
+			continue
+		}
+		aggKey, err := btcec.ParsePubKey(key[1:])
+		if err != nil {
+			return nil, fmt.Errorf("%w: musig2 aggregate key: %v", ErrInvalidPsbt, err)
+		}
+		if !bytes.Equal(pin.TaprootInternalKey, schnorr.SerializePubKey(aggKey)) {
+			continue
+		}
+
+		if len(unknown.Value) == 0 || len(unknown.Value)%btcec.PubKeyBytesLenCompressed != 0 {
+			return nil, fmt.Errorf("%w: musig2 participants of %d bytes", ErrInvalidPsbt, len(unknown.Value))
+		}
+		session = &psbtMuSig2{
+			aggKey:      key[1:],
+			pubNonces:   make(map[string][musig2.PubNonceSize]byte),
+			partialSigs: make(map[string]*musig2.PartialSignature),
+		}
+		for raw := range slices.Chunk(unknown.Value, btcec.PubKeyBytesLenCompressed) {
+			signer, err := btcec.ParsePubKey(raw)
+			if err != nil {
+				return nil, fmt.Errorf("%w: musig2 participant: %v", ErrInvalidPsbt, err)
+			}
+			session.signers = append(session.signers, signer)
+		}
+		break
+	}
+	if session == nil {
+		return nil, nil
+	}
+
+	// the keys are the signer and the aggregate key, a leaf hash follows for the script path
+	for _, unknown := range pin.Unknowns {
+		key := unknown.Key
+		if len(key) != 1+2*btcec.PubKeyBytesLenCompressed ||
+			!bytes.Equal(key[1+btcec.PubKeyBytesLenCompressed:], session.aggKey) {
+			continue
+		}
+		signer := string(key[1 : 1+btcec.PubKeyBytesLenCompressed])
+		switch key[0] {
+		case psbtInMuSig2PubNonce:
+			if len(unknown.Value) != musig2.PubNonceSize {
+				return nil, fmt.Errorf("%w: musig2 nonce of %d bytes", ErrInvalidPsbt, len(unknown.Value))
+			}
+			session.pubNonces[signer] = [musig2.PubNonceSize]byte(unknown.Value)
+		case psbtInMuSig2PartialSig:
+			if len(unknown.Value) != 32 {
+				return nil, fmt.Errorf("%w: musig2 partial signature of %d bytes", ErrInvalidPsbt,
+					len(unknown.Value))
+			}
+			sig := new(musig2.PartialSignature)
+			if err := sig.Decode(bytes.NewReader(unknown.Value)); err != nil {
+				return nil, fmt.Errorf("%w: musig2 partial signature: %v", ErrInvalidPsbt, err)
+			}
+			session.partialSigs[signer] = sig
+		}
+	}
+	return session, nil
+}
+
+// hasSigner reports whether the pubkey is one of the participants
+func (s *psbtMuSig2) hasSigner(pubkey *btcec.PublicKey) bool {
+	return slices.ContainsFunc(s.signers, pubkey.IsEqual)
+}
+
+// aggNonce aggregates the nonces of all the signers
+func (s *psbtMuSig2) aggNonce() ([musig2.PubNonceSize]byte, error) {
+	pubNonces := make([][musig2.PubNonceSize]byte, 0, len(s.signers))
+	for _, signer := range s.signers {
+		pubNonce, ok := s.pubNonces[string(signer.SerializeCompressed())]
+		if !ok {
+			return [musig2.PubNonceSize]byte{}, fmt.Errorf("%w: no musig2 nonce of %x", ErrInvalidPsbt,
+				signer.SerializeCompressed())
+		}
+		pubNonces = append(pubNonces, pubNonce)
+	}
+	aggNonce, err := musig2.AggregateNonces(pubNonces)
+	if err != nil {
+		return aggNonce, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	return aggNonce, nil
+}
+
+// fieldKey is the key of the nonce or the partial signature of the signer
+func (s *psbtMuSig2) fieldKey(keyType byte, signer *btcec.PublicKey) []byte {
+	key := append([]byte{keyType}, signer.SerializeCompressed()...)
+	return append(key, s.aggKey...)
+}
+
+// psbtMuSig2Input returns the input with its musig2 session, the participants must be in the psbt
+func psbtMuSig2Input(packet *psbt.Packet, idx int) (*psbt.PInput, *psbtMuSig2, error) {
+	if idx < 0 || idx >= len(packet.Inputs) {
+		return nil, nil, fmt.Errorf("%w: no input %d", ErrInvalidPsbt, idx)
+	}
+	pin := &packet.Inputs[idx]
+	session, err := parsePsbtMuSig2(pin)
+	if err != nil {
+		return nil, nil, err
+	}
+	if session == nil {
+		return nil, nil, fmt.Errorf("%w: no musig2 participants of the internal key of input %d", ErrInvalidPsbt, idx)
+	}
+	return pin, session, nil
+}
+
+// PsbtMuSig2Nonce is the first round of BIP373 for the key path of a musig2 input, the signer adds its
+// public nonce to its copy of the psbt and the combiner merges the copies. The secret nonce stays in
+// the memory of the signer for SignPsbtMuSig2Partial, it must never be stored or used twice.
+func PsbtMuSig2Nonce(packet *psbt.Packet, idx int, prvkey *btcec.PrivateKey) (*musig2.Nonces, error) {
+	pin, session, err := psbtMuSig2Input(packet, idx)
+	if err != nil {
+		return nil, err
+	}
+	if !session.hasSigner(prvkey.PubKey()) {
+		return nil, fmt.Errorf("%w: not a musig2 participant of input %d", ErrInvalidKey, idx)
+	}
+
+	nonces, err := musig2.GenNonces(musig2.WithPublicKey(prvkey.PubKey()), musig2.WithNonceSecretKeyAux(prvkey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	key := session.fieldKey(psbtInMuSig2PubNonce, prvkey.PubKey())
+	pin.Unknowns = slices.DeleteFunc(pin.Unknowns, func(unknown *psbt.Unknown) bool {
+		return bytes.Equal(unknown.Key, key)
+	})
+	pin.Unknowns = append(pin.Unknowns, &psbt.Unknown{Key: key, Value: nonces.PubNonce[:]})
+	return nonces, nil
+}
+
+// SignPsbtMuSig2Partial is the second round of BIP373, once the psbt has the nonces of all the signers
+// the signer adds its partial signature with the secret nonce of PsbtMuSig2Nonce, the secret nonce
+// is wiped after. FinalizePsbt aggregates the partial signatures of all the signers.
+func SignPsbtMuSig2Partial(packet *psbt.Packet, idx int, prvkey *btcec.PrivateKey, nonces *musig2.Nonces) error {
+	pin, session, err := psbtMuSig2Input(packet, idx)
+	if err != nil {
+		return err
+	}
+	pubNonce, ok := session.pubNonces[string(prvkey.PubKey().SerializeCompressed())]
+	if !ok || pubNonce != nonces.PubNonce {
+		return fmt.Errorf("%w: the nonce of the signer isn't in input %d", ErrInvalidKey, idx)
+	}
+	aggNonce, err := session.aggNonce()
+	if err != nil {
+		return err
+	}
+	sigHash, err := psbtTaprootSigHash(packet, idx)
+	if err != nil {
+		return err
+	}
+
+	signTweak := musig2.WithBip86SignTweak()
+	if pin.TaprootMerkleRoot != nil {
+		signTweak = musig2.WithTaprootSignTweak(pin.TaprootMerkleRoot)
+	}
+	sig, err := musig2.Sign(nonces.SecNonce, prvkey, aggNonce, session.signers, sigHash, signTweak)
+	nonces.SecNonce = [musig2.SecNonceSize]byte{}
+	if err != nil {
+		return fmt.Errorf("sign input %d: %w: %v", idx, ErrInvalidSignature, err)
+	}
+
+	var buf bytes.Buffer
+	if err := sig.Encode(&buf); err != nil {
+		return err
+	}
+	pin.Unknowns = mergeFields(pin.Unknowns, []*psbt.Unknown{{
+		Key:   session.fieldKey(psbtInMuSig2PartialSig, prvkey.PubKey()),
+		Value: buf.Bytes(),
+	}}, sameUnknown)
+	return nil
+}
+
+// SignPsbtMuSig2 runs both rounds of BIP373 for the signers of a musig2 input in one process,
+// the output key is tweaked by the merkle root of the input or by bip86. The cosigners on their own
+// machines call PsbtMuSig2Nonce, combine the psbts, then SignPsbtMuSig2Partial and combine again.
+func SignPsbtMuSig2(packet *psbt.Packet, idx int, keys []*btcec.PrivateKey) error {
+	pubkeyList := make([]*btcec.PublicKey, 0, len(keys))
+	for _, prvkey := range keys {
+		pubkeyList = append(pubkeyList, prvkey.PubKey())
+	}
+	if err := AddPsbtMuSig2Signers(packet, idx, pubkeyList); err != nil {
+		return err
+	}
+
+	nonces := make([]*musig2.Nonces, 0, len(keys))
+	for _, prvkey := range keys {
+		nonce, err := PsbtMuSig2Nonce(packet, idx, prvkey)
+		if err != nil {
+			return err
+		}
+		nonces = append(nonces, nonce)
+	}
+	for i, prvkey := range keys {
+		if err := SignPsbtMuSig2Partial(packet, idx, prvkey, nonces[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// aggregatePsbtMuSig2 sets the key path signature from the partial signatures of all the signers,
+// the input is left as it is until every signer has signed
+func aggregatePsbtMuSig2(packet *psbt.Packet, idx int) error {
+	pin := &packet.Inputs[idx]
+	if pin.TaprootKeySpendSig != nil || pin.TaprootInternalKey == nil {
+		return nil
+	}
+	session, err := parsePsbtMuSig2(pin)
+	if err != nil || session == nil {
+		return err
+	}
+	partialSigs := make([]*musig2.PartialSignature, 0, len(session.signers))
+	for _, signer := range session.signers {
+		if sig, ok := session.partialSigs[string(signer.SerializeCompressed())]; ok {
+			partialSigs = append(partialSigs, sig)
+		}
+	}
+	if len(partialSigs) < len(session.signers) {
+		return nil
+	}
+
+	aggNonce, err := session.aggNonce()
+	if err != nil {
+		return err
+	}
+	sigHash, err := psbtTaprootSigHash(packet, idx)
+	if err != nil {
+		return err
+	}
+	keyTweak := musig2.WithBIP86KeyTweak()
+	combineTweak := musig2.WithBip86TweakedCombine(sigHash, session.signers, false)
+	if pin.TaprootMerkleRoot != nil {
+		keyTweak = musig2.WithTaprootKeyTweak(pin.TaprootMerkleRoot)
+		combineTweak = musig2.WithTaprootTweakedCombine(sigHash, session.signers, pin.TaprootMerkleRoot, false)
+	}
+	outputKey, _, _, err := musig2.AggregateKeys(session.signers, false, keyTweak)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	nonce, err := musig2FinalNonce(aggNonce, outputKey.FinalKey, sigHash)
+	if err != nil {
+		return err
+	}
+	pin.TaprootKeySpendSig = musig2.CombineSigs(nonce, partialSigs, combineTweak).Serialize()
+	return nil
+}
+
+// musig2FinalNonce is the nonce R of the signature, R1 + b*R2 of the aggregate nonce where b commits to
+// the nonce, the output key and the message. The musig2 package computes it only inside Sign.
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0327.mediawiki#signing
+func musig2FinalNonce(aggNonce [musig2.PubNonceSize]byte, outputKey *btcec.PublicKey,
+	msg [32]byte) (*btcec.PublicKey, error) {
+	var buf bytes.Buffer
+	buf.Write(aggNonce[:])
+	buf.Write(schnorr.SerializePubKey(outputKey))
+	buf.Write(msg[:])
+	var b btcec.ModNScalar
+	b.SetByteSlice(chainhash.TaggedHash(musig2.NonceBlindTag, buf.Bytes())[:])
+
+	r1, err := btcec.ParseJacobian(aggNonce[:btcec.PubKeyBytesLenCompressed])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	r2, err := btcec.ParseJacobian(aggNonce[btcec.PubKeyBytesLenCompressed:])
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	var nonce btcec.JacobianPoint
+	btcec.ScalarMultNonConst(&b, &r2, &r2)
+	btcec.AddNonConst(&r1, &r2, &nonce)
+	// the infinity point is replaced by the generator
+	if (nonce.X.IsZero() && nonce.Y.IsZero()) || nonce.Z.IsZero() {
+		return btcec.Generator(), nil
+	}
+	nonce.ToAffine()
+	return btcec.NewPublicKey(&nonce.X, &nonce.Y), nil
+}
+
+// psbtTaprootSigHash is the sighash of the key path of the input by its sighash type
+func psbtTaprootSigHash(packet *psbt.Packet, idx int) ([32]byte, error) {
+	fetcher, err := psbtPrevOutFetcher(packet)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	sigHashes := txscript.NewTxSigHashes(packet.UnsignedTx, fetcher)
+	sigHash, err := txscript.CalcTaprootSignatureHash(sigHashes, packet.Inputs[idx].SighashType,
+		packet.UnsignedTx, idx, fetcher)
+	if err != nil {
+		return [32]byte{}, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	return [32]byte(sigHash), nil
+}
@@ -0,0 +1,113 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr/musig2"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+)
+
+// testMuSig2Cosigners runs both rounds of BIP373 on the copies of the cosigners,
+// the combiner merges the copies after each round
+func testMuSig2Cosigners(t *testing.T, packet *psbt.Packet, idx int, signers ...*btcec.PrivateKey) *psbt.Packet {
+	t.Helper()
+	copies := make([]*psbt.Packet, len(signers))
+	nonces := make([]*musig2.Nonces, len(signers))
+	for i, signer := range signers {
+		copied, err := copyPsbt(packet)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if nonces[i], err = PsbtMuSig2Nonce(copied, idx, signer); err != nil {
+			t.Fatal(err)
+		}
+		copies[i] = copied
+	}
+	withNonces, err := CombinePsbt(copies...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, signer := range signers {
+		if copies[i], err = copyPsbt(withNonces); err != nil {
+			t.Fatal(err)
+		}
+		if err := SignPsbtMuSig2Partial(copies[i], idx, signer, nonces[i]); err != nil {
+			t.Fatal(err)
+		}
+		if copies[i].Inputs[idx].TaprootKeySpendSig != nil {
+			t.Fatal("a partial signature is the signature of the input")
+		}
+	}
+	combined, err := CombinePsbt(copies...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return combined
+}
+
+func TestPsbtMuSig2Cosigners(t *testing.T) {
+	alice, bob := testKey(1), testKey(2)
+	packet, err := MuSig2Psbt(testNet, alice.PubKey(), bob.PubKey(), testPool(60000), 30000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session, err := parsePsbtMuSig2(&packet.Inputs[0])
+	if err != nil || session == nil || len(session.signers) != 2 {
+		t.Fatalf("participants %+v, %v", session, err)
+	}
+	if _, err := PsbtMuSig2Nonce(packet, 0, testKey(3)); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("nonce of a key out of the participants got %v", err)
+	}
+
+	// the second round needs the nonces of all the signers
+	copied, err := copyPsbt(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	nonces, err := PsbtMuSig2Nonce(copied, 0, alice)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := SignPsbtMuSig2Partial(copied, 0, alice, nonces); !errors.Is(err, ErrInvalidPsbt) {
+		t.Errorf("sign without the nonce of bob got %v", err)
+	}
+
+	// the finalizer can't sign the input before every partial signature is combined
+	combined := testMuSig2Cosigners(t, packet, 0, alice, bob)
+	if combined.Inputs[0].TaprootKeySpendSig == nil {
+		t.Fatal("the partial signatures aren't aggregated")
+	}
+	testExtractPsbt(t, combined)
+}
+
+func TestPsbtMuSig2TreeKeyPath(t *testing.T) {
+	keys := []*btcec.PrivateKey{testKey(1), testKey(2), testKey(3)}
+	pubkeys := []*btcec.PublicKey{keys[0].PubKey(), keys[1].PubKey(), keys[2].PubKey()}
+	internalKey, err := MuSig2InternalKey(pubkeys...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tree, err := NewTapTree(testTapLeaves(t, keys...)...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	packet, err := PayToTaprootTreePsbt(testNet, internalKey, tree, -1, testPool(100000), 50000, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := PsbtMuSig2Nonce(packet, 0, keys[0]); !errors.Is(err, ErrInvalidPsbt) {
+		t.Errorf("nonce without the participants got %v", err)
+	}
+	if err := AddPsbtMuSig2Signers(packet, 0, pubkeys[:2]); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("participants out of the internal key got %v", err)
+	}
+
+	// the signers are added in any order, the field has them sorted like MuSig2InternalKey
+	if err := AddPsbtMuSig2Signers(packet, 0, []*btcec.PublicKey{pubkeys[2], pubkeys[0], pubkeys[1]}); err != nil {
+		t.Fatal(err)
+	}
+	testExtractPsbt(t, testMuSig2Cosigners(t, packet, 0, keys[2], keys[1], keys[0]))
+}
@@ -0,0 +1,344 @@
+package example
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// the key types of BIP370, the psbt package only knows version 0
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0370.mediawiki
+const (
+	psbtGlobalUnsignedTx         = 0x00
+	psbtGlobalTxVersion          = 0x02
+	psbtGlobalFallbackLocktime   = 0x03
+	psbtGlobalInputCount         = 0x04
+	psbtGlobalOutputCount        = 0x05
+	psbtGlobalTxModifiable       = 0x06
+	psbtGlobalVersion            = 0xfb
+	psbtInPreviousTxid           = 0x0e
+	psbtInOutputIndex            = 0x0f
+	psbtInSequence               = 0x10
+	psbtInRequiredTimeLocktime   = 0x11
+	psbtInRequiredHeightLocktime = 0x12
+	psbtOutAmount                = 0x03
+	psbtOutScript                = 0x04
+)
+
+var psbtMagic = []byte{0x70, 0x73, 0x62, 0x74, 0xff}
+
+// psbtKV is a key-value pair of a psbt map, the first byte of the key is the key type
+type psbtKV struct {
+	key, value []byte
+}
+
+// psbtMaps is a psbt as key-value maps, the global map, the input maps and the output maps
+type psbtMaps struct {
+	global  []psbtKV
+	inputs  [][]psbtKV
+	outputs [][]psbtKV
+}
+
+func readPsbtMap(r *bytes.Reader) ([]psbtKV, error) {
+	var kvs []psbtKV
+	for {
+		key, err := wire.ReadVarBytes(r, 0, psbt.MaxPsbtKeyLength, "psbt key")
+		if err != nil {
+			return nil, err
+		}
+		// an empty key is the separator of the maps
+		if len(key) == 0 {
+			return kvs, nil
+		}
+		value, err := wire.ReadVarBytes(r, 0, psbt.MaxPsbtValueLength, "psbt value")
+		if err != nil {
+			return nil, err
+		}
+		kvs = append(kvs, psbtKV{key, value})
+	}
+}
+
+func writePsbtMap(w io.Writer, kvs []psbtKV) error {
+	for _, kv := range kvs {
+		if err := wire.WriteVarBytes(w, 0, kv.key); err != nil {
+			return err
+		}
+		if err := wire.WriteVarBytes(w, 0, kv.value); err != nil {
+			return err
+		}
+	}
+	return wire.WriteVarInt(w, 0, 0)
+}
+
+func (m *psbtMaps) serialize() ([]byte, error) {
+	var buf bytes.Buffer
+	buf.Write(psbtMagic)
+	for _, kvs := range slices.Concat([][]psbtKV{m.global}, m.inputs, m.outputs) {
+		if err := writePsbtMap(&buf, kvs); err != nil {
+			return nil, err
+		}
+	}
+	return buf.Bytes(), nil
+}
+
+// findKV returns the value of the key type without key data
+func findKV(kvs []psbtKV, keyType byte) ([]byte, bool) {
+	for _, kv := range kvs {
+		if len(kv.key) == 1 && kv.key[0] == keyType {
+			return kv.value, true
+		}
+	}
+	return nil, false
+}
+
+// withoutKV removes the key types from the map
+func withoutKV(kvs []psbtKV, keyTypes ...byte) []psbtKV {
+	return slices.DeleteFunc(slices.Clone(kvs), func(kv psbtKV) bool {
+		return slices.Contains(keyTypes, kv.key[0])
+	})
+}
+
+func uint32KV(keyType byte, v uint32) psbtKV {
+	return psbtKV{[]byte{keyType}, binary.LittleEndian.AppendUint32(nil, v)}
+}
+
+func varIntKV(keyType byte, v int) psbtKV {
+	var buf bytes.Buffer
+	_ = wire.WriteVarInt(&buf, 0, uint64(v))
+	return psbtKV{[]byte{keyType}, buf.Bytes()}
+}
+
+// EncodePsbtV2 serializes the psbt as version 2 of BIP370,
+// the unsigned tx is split into the global, the input and the output fields
+func EncodePsbtV2(packet *psbt.Packet) ([]byte, error) {
+	var buf bytes.Buffer
+	if err := packet.Serialize(&buf); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+
+	tx := packet.UnsignedTx
+	maps := &psbtMaps{}
+	r := bytes.NewReader(buf.Bytes()[len(psbtMagic):])
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+	maps.global = append(withoutKV(global, psbtGlobalUnsignedTx, psbtGlobalVersion),
+		uint32KV(psbtGlobalTxVersion, uint32(tx.Version)),
+		uint32KV(psbtGlobalFallbackLocktime, tx.LockTime),
+		varIntKV(psbtGlobalInputCount, len(tx.TxIn)),
+		varIntKV(psbtGlobalOutputCount, len(tx.TxOut)),
+		uint32KV(psbtGlobalVersion, 2),
+	)
+
+	for _, txin := range tx.TxIn {
+		input, err := readPsbtMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		maps.inputs = append(maps.inputs, append(input,
+			psbtKV{[]byte{psbtInPreviousTxid}, txin.PreviousOutPoint.Hash[:]},
+			uint32KV(psbtInOutputIndex, txin.PreviousOutPoint.Index),
+			uint32KV(psbtInSequence, txin.Sequence),
+		))
+	}
+
+	for _, txout := range tx.TxOut {
+		output, err := readPsbtMap(r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		maps.outputs = append(maps.outputs, append(output,
+			psbtKV{[]byte{psbtOutAmount}, binary.LittleEndian.AppendUint64(nil, uint64(txout.Value))},
+			psbtKV{[]byte{psbtOutScript}, txout.PkScript},
+		))
+	}
+	return maps.serialize()
+}
+
+// DecodePsbt parses a psbt of version 0 or 2, in binary or base64
+func DecodePsbt(raw []byte) (*psbt.Packet, error) {
+	if !bytes.HasPrefix(raw, psbtMagic) {
+		decoded, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(raw)))
+		if err != nil || !bytes.HasPrefix(decoded, psbtMagic) {
+			return nil, fmt.Errorf("%w: bad magic bytes", ErrInvalidPsbt)
+		}
+		raw = decoded
+	}
+
+	r := bytes.NewReader(raw[len(psbtMagic):])
+	global, err := readPsbtMap(r)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+	}
+
+	version := uint32(0)
+	if value, ok := findKV(global, psbtGlobalVersion); ok {
+		if len(value) != 4 {
+			return nil, fmt.Errorf("%w: bad version", ErrInvalidPsbt)
+		}
+		version = binary.LittleEndian.Uint32(value)
+	}
+
+	switch version {
+	case 0:
+		packet, err := psbt.NewFromRawBytes(bytes.NewReader(raw), false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		return packet, nil
+	case 2:
+		v0, err := psbtV2ToV0(global, r)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		packet, err := psbt.NewFromRawBytes(bytes.NewReader(v0), false)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidPsbt, err)
+		}
+		return packet, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidPsbt, version)
+	}
+}
+
+// psbtV2ToV0 rebuilds the unsigned tx from the fields of BIP370
+func psbtV2ToV0(global []psbtKV, r *bytes.Reader) ([]byte, error) {
+	readUint32 := func(kvs []psbtKV, keyType byte, fallback uint32, required bool) (uint32, error) {
+		value, ok := findKV(kvs, keyType)
+		switch {
+		case !ok && required:
+			return 0, fmt.Errorf("missing key type 0x%02x", keyType)
+		case !ok:
+			return fallback, nil
+		case len(value) != 4:
+			return 0, fmt.Errorf("bad value of key type 0x%02x", keyType)
+		}
+		return binary.LittleEndian.Uint32(value), nil
+	}
+	readCount := func(keyType byte) (int, error) {
+		value, ok := findKV(global, keyType)
+		if !ok {
+			return 0, fmt.Errorf("missing key type 0x%02x", keyType)
+		}
+		// every map takes at least the separator
+		count, err := wire.ReadVarInt(bytes.NewReader(value), 0)
+		if err != nil || count > uint64(r.Len()) {
+			return 0, fmt.Errorf("bad count of key type 0x%02x", keyType)
+		}
+		return int(count), nil
+	}
+
+	txVersion, err := readUint32(global, psbtGlobalTxVersion, 0, true)
+	if err != nil {
+		return nil, err
+	}
+	fallbackLocktime, err := readUint32(global, psbtGlobalFallbackLocktime, 0, false)
+	if err != nil {
+		return nil, err
+	}
+	inputCount, err := readCount(psbtGlobalInputCount)
+	if err != nil {
+		return nil, err
+	}
+	outputCount, err := readCount(psbtGlobalOutputCount)
+	if err != nil {
+		return nil, err
+	}
+
+	tx := wire.NewMsgTx(int32(txVersion))
+	maps := &psbtMaps{}
+
+	var (
+		heightLocktime, timeLocktime uint32
+		hasHeight, hasTime           bool
+		onlyHeight, onlyTime         bool
+	)
+	for range inputCount {
+		input, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+
+		txid, ok := findKV(input, psbtInPreviousTxid)
+		if !ok || len(txid) != chainhash.HashSize {
+			return nil, fmt.Errorf("bad previous txid")
+		}
+		index, err := readUint32(input, psbtInOutputIndex, 0, true)
+		if err != nil {
+			return nil, err
+		}
+		sequence, err := readUint32(input, psbtInSequence, wire.MaxTxInSequenceNum, false)
+		if err != nil {
+			return nil, err
+		}
+		txin := wire.NewTxIn(wire.NewOutPoint((*chainhash.Hash)(txid), index), nil, nil)
+		txin.Sequence = sequence
+		tx.AddTxIn(txin)
+
+		// an input may require a time or a height locktime, or accept both
+		height, heightErr := readUint32(input, psbtInRequiredHeightLocktime, 0, true)
+		locktime, timeErr := readUint32(input, psbtInRequiredTimeLocktime, 0, true)
+		if heightErr == nil {
+			hasHeight = true
+			heightLocktime = max(heightLocktime, height)
+		}
+		if timeErr == nil {
+			hasTime = true
+			timeLocktime = max(timeLocktime, locktime)
+		}
+		onlyHeight = onlyHeight || (heightErr == nil && timeErr != nil)
+		onlyTime = onlyTime || (timeErr == nil && heightErr != nil)
+
+		maps.inputs = append(maps.inputs, withoutKV(input, psbtInPreviousTxid, psbtInOutputIndex,
+			psbtInSequence, psbtInRequiredTimeLocktime, psbtInRequiredHeightLocktime))
+	}
+
+	// https://github.com/bitcoin/bips/blob/master/bip-0370.mediawiki#determining-lock-time
+	switch {
+	case onlyHeight && onlyTime:
+		return nil, fmt.Errorf("inputs require both height and time locktime")
+	case hasHeight && !onlyTime:
+		tx.LockTime = heightLocktime
+	case hasTime:
+		tx.LockTime = timeLocktime
+	default:
+		tx.LockTime = fallbackLocktime
+	}
+
+	for range outputCount {
+		output, err := readPsbtMap(r)
+		if err != nil {
+			return nil, err
+		}
+
+		amount, ok := findKV(output, psbtOutAmount)
+		if !ok || len(amount) != 8 {
+			return nil, fmt.Errorf("bad output amount")
+		}
+		pkScript, ok := findKV(output, psbtOutScript)
+		if !ok {
+			return nil, fmt.Errorf("missing output script")
+		}
+		tx.AddTxOut(wire.NewTxOut(int64(binary.LittleEndian.Uint64(amount)), pkScript))
+
+		maps.outputs = append(maps.outputs, withoutKV(output, psbtOutAmount, psbtOutScript))
+	}
+
+	var unsignedTx bytes.Buffer
+	if err := tx.SerializeNoWitness(&unsignedTx); err != nil {
+		return nil, err
+	}
+	maps.global = append([]psbtKV{{[]byte{psbtGlobalUnsignedTx}, unsignedTx.Bytes()}},
+		withoutKV(global, psbtGlobalTxVersion, psbtGlobalFallbackLocktime, psbtGlobalInputCount,
+			psbtGlobalOutputCount, psbtGlobalTxModifiable, psbtGlobalVersion)...)
+	return maps.serialize()
+}
@@ -2,79 +2,184 @@ package example
 
 import (
 	"fmt"
+	"slices"
 
 	"github.com/btcsuite/btcd/btcec/v2"
 	"github.com/btcsuite/btcd/btcutil"
 	"github.com/btcsuite/btcd/chaincfg"
-	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
 	"github.com/btcsuite/btcd/txscript"
 	"github.com/btcsuite/btcd/wire"
 )
 
+// maxReplacementAttempts bounds the rebuilds to reach the minimum fee of a replacement,
+// a higher fee can select another input and change the vsize
+const maxReplacementAttempts = 5
+
 // https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
-func ReplaceByFee(netwk *chaincfg.Params, prvkey *btcec.PrivateKey, prevTxHash *chainhash.Hash, prevTxOut uint32, prevAmount, fee int64) {
+func ReplaceByFee(netwk *chaincfg.Params, prvkey *btcec.PrivateKey,
+	pool []*UTXO, amount, feeRate int64) (origin, replacement *wire.MsgTx, err error) {
 	pubkeyHash := btcutil.Hash160(prvkey.PubKey().SerializeCompressed())
 	address, err := btcutil.NewAddressPubKeyHash(pubkeyHash, netwk)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
 	}
 	fmt.Println("p2pkh address:", address)
 
 	subScript, err := txscript.PayToAddrScript(address)
 	if err != nil {
-		panic(err)
+		return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
 	}
 
-	newtx := wire.NewMsgTx(2)
+	utxos := spendFrom(pool, UTXO{
+		PkScript:  subScript,
+		SpendType: SpendP2PKH,
+		// if the 0xfffffffe > nSequence > 0x80000000, the tx is replaceable
+		// the highest bit must be 1 to signal that it doesn't use (bip68)[https://github.com/bitcoin/bips/blob/master/bip-0068.mediawiki]
+		Sequence: 0xfffffff0,
+		Keys:     []*btcec.PrivateKey{prvkey},
+	})
+	recipients := []*Recipient{{Address: address, Amount: amount}}
 
-	// txout to the address
-	{
-		value := prevAmount - fee
-		if value < 546 {
-			panic("the amount is too small")
-		}
-		txout := wire.NewTxOut(prevAmount-fee, subScript)
-		newtx.AddTxOut(txout)
+	origin, err = (&TxBuilder{
+		Pool:          utxos,
+		Recipients:    recipients,
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}).Build()
+	if err != nil {
+		return nil, nil, err
 	}
 
-	// txin
-	{
-		txin := wire.NewTxIn(wire.NewOutPoint(prevTxHash, prevTxOut), nil, nil)
-		// if the 0xfffffffe > nSequence > 0x80000000, the tx is replaceable
-		// the highest bit must be 1 to signal that it doesn't use (bip68)[https://github.com/bitcoin/bips/blob/master/bip-0068.mediawiki]
-		txin.Sequence = 0xfffffff0
-		newtx.AddTxIn(txin)
+	// the default minRelayFeeRate is 1 satoshi per vbyte,
+	// the replacement must pay for its own vsize on top of the original fee
+	minRelayFeeRate := int64(1)
+	inputs, err := spentUTXOs(origin, utxos)
+	if err != nil {
+		return nil, nil, err
 	}
+	originFee := txFee(origin, inputs)
+	originVSize := mempool.GetTxVirtualSize(btcutil.NewTx(origin))
+	replaceFeeRate := (originFee+originVSize-1)/originVSize + minRelayFeeRate
 
-	// sign
-	for txIdx, txIn := range newtx.TxIn {
-		sig, err := txscript.SignatureScript(newtx, txIdx, subScript, txscript.SigHashAll, prvkey, true)
-		if err != nil {
-			panic(err)
-		}
-		txIn.SignatureScript = sig
+	// replace by fee, the change is the last output
+	if len(origin.TxOut) < 2 {
+		return nil, nil, fmt.Errorf("%w: no change output to pay the fee", ErrReplacementRejected)
+	}
+	replacement, err = BumpFee(netwk, origin, utxos, len(origin.TxOut)-1, nil, replaceFeeRate)
+	if err != nil {
+		return nil, nil, err
 	}
+	return origin, replacement, nil
+}
 
-	// Increase the sequence number, but it's optional
-	newtx.TxIn[0].Sequence += 1
+// BumpFee replaces the tx by one paying the fee rate, it works for every spend type of the builders:
+// the inputs are signed again by their spend type with the keys of the utxos, so each one gets its
+// sighash algorithm. Utxos are the outputs spent by the tx like the pool of the builders.
+// The version, the lock time and the sequences of the inputs are kept as they are, including the bip125
+// signal and the bip68 relative locks. The change output at the index pays the fee, the utxos of the pool
+// are added if it's short and it's dropped if it would be dust, the other outputs are kept as they are,
+// even the ones without an address like OP_RETURN. The replacement passes CheckReplacement with full rbf,
+// so the tx doesn't have to signal bip125.
+func BumpFee(netwk *chaincfg.Params, tx *wire.MsgTx, utxos []*UTXO, changeIndex int, pool []*UTXO,
+	feeRate int64) (*wire.MsgTx, error) {
+	if changeIndex < 0 || changeIndex >= len(tx.TxOut) {
+		return nil, fmt.Errorf("%w: no change output %d", ErrReplacementRejected, changeIndex)
+	}
+	inputs, err := spentUTXOs(tx, utxos)
+	if err != nil {
+		return nil, err
+	}
+	sequences := make([]uint32, 0, len(tx.TxIn))
+	for _, txin := range tx.TxIn {
+		sequences = append(sequences, txin.Sequence)
+	}
 
-	// the default minRelayFeeRate is 1 satoshi per byte
-	minRelayFeeRate := int64(1)
-	minRelayFee := int64(newtx.SerializeSize()) * minRelayFeeRate
+	class, addrs, _, err := txscript.ExtractPkScriptAddrs(tx.TxOut[changeIndex].PkScript, netwk)
+	if err != nil || len(addrs) != 1 || class == txscript.MultiSigTy {
+		return nil, fmt.Errorf("%w: the change output %d has no address", ErrReplacementRejected, changeIndex)
+	}
+	outputs := slices.Delete(slices.Clone(tx.TxOut), changeIndex, changeIndex+1)
 
-	// replace by fee
-	fee2 := fee + minRelayFee
-	if prevAmount-fee2 < 546 {
-		panic("the amount is too small")
+	var extra []*UTXO
+	for _, utxo := range pool {
+		if !spendsOutPoint(tx, utxo.OutPoint) {
+			extra = append(extra, utxo)
+		}
 	}
-	newtx.TxOut[0] = wire.NewTxOut(prevAmount-fee2, subScript)
+	replacement, _, err := buildReplacement(tx, &TxBuilder{
+		Version:       tx.Version,
+		LockTime:      tx.LockTime,
+		Inputs:        inputs,
+		Sequences:     sequences,
+		Pool:          extra,
+		Outputs:       outputs,
+		ChangeAddress: addrs[0],
+		FeeRate:       feeRate,
+	}, &ReplacementOptions{FullRBF: true})
+	return replacement, err
+}
 
-	// sign for the rbf
-	for txIdx, txIn := range newtx.TxIn {
-		sig, err := txscript.SignatureScript(newtx, txIdx, subScript, txscript.SigHashAll, prvkey, true)
+// buildReplacement builds the replacement of the original by the builder, the fee rate is raised to the
+// minimum fee of CheckReplacement if it's not enough. It returns the utxos in the order of the inputs.
+func buildReplacement(original *wire.MsgTx, builder *TxBuilder,
+	opts *ReplacementOptions) (*wire.MsgTx, []*UTXO, error) {
+	candidates := append(slices.Clone(builder.Inputs), builder.Pool...)
+	var check *ReplacementCheck
+	for range maxReplacementAttempts {
+		tx, err := builder.Build()
+		if err != nil {
+			return nil, nil, err
+		}
+		inputs, err := spentUTXOs(tx, candidates)
 		if err != nil {
-			panic(err)
+			return nil, nil, err
+		}
+		if check, err = CheckReplacement(original, tx, prevOutFetcher(inputs), opts); err != nil {
+			return nil, nil, err
+		}
+		if check.Err() == nil {
+			return tx, inputs, nil
+		}
+
+		// only the fee rules can be fixed by paying more on top of the fee rate
+		missing := check.MinFee - check.ReplacementFee
+		if missing <= 0 {
+			break
 		}
-		txIn.SignatureScript = sig
+		builder.ExtraFee += missing
+	}
+	return nil, nil, check.Err()
+}
+
+// spentUTXOs returns the copies of the utxos spent by the tx in the order of the inputs
+func spentUTXOs(tx *wire.MsgTx, pool []*UTXO) ([]*UTXO, error) {
+	utxos := make([]*UTXO, 0, len(tx.TxIn))
+	for _, txin := range tx.TxIn {
+		var found *UTXO
+		for _, utxo := range pool {
+			if utxo.OutPoint == txin.PreviousOutPoint {
+				spend := *utxo
+				found = &spend
+				break
+			}
+		}
+		if found == nil {
+			return nil, fmt.Errorf("unknown input %s", txin.PreviousOutPoint)
+		}
+		utxos = append(utxos, found)
+	}
+	return utxos, nil
+}
+
+// txFee is the sum of the inputs minus the sum of the outputs
+func txFee(tx *wire.MsgTx, inputs []*UTXO) int64 {
+	var fee int64
+	for _, utxo := range inputs {
+		fee += utxo.Amount
+	}
+	for _, txout := range tx.TxOut {
+		fee -= txout.Value
 	}
+	return fee
 }
@@ -0,0 +1,116 @@
+package example
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestBumpFee(t *testing.T) {
+	alice, bob, cario := testKey(1), testKey(2), testKey(3)
+	for _, test := range []struct {
+		name    string
+		builder func(pool []*UTXO) (*TxBuilder, error)
+		signers []*btcec.PrivateKey
+	}{
+		{"p2wpkh", func(pool []*UTXO) (*TxBuilder, error) {
+			return newPay2WitnessPubkeyHashBuilder(testNet, alice.PubKey(), pool, 20000, 2)
+		}, []*btcec.PrivateKey{alice}},
+		{"p2wsh multisig", func(pool []*UTXO) (*TxBuilder, error) {
+			return newP2WSHMultiSigBuilder(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(), pool, 20000, 2)
+		}, []*btcec.PrivateKey{alice, bob}},
+		{"taproot key path", func(pool []*UTXO) (*TxBuilder, error) {
+			return newPay2TaprootByKeyPathBuilder(testNet, alice.PubKey(), pool, 20000, 2)
+		}, []*btcec.PrivateKey{alice}},
+		{"taproot script path", func(pool []*UTXO) (*TxBuilder, error) {
+			return newPayToTaprootByPathBuilder(testNet, alice.PubKey(), bob.PubKey(), cario.PubKey(), nil,
+				false, pool, 20000, 2)
+		}, []*btcec.PrivateKey{alice, cario}},
+		{"musig2", func(pool []*UTXO) (*TxBuilder, error) {
+			return newMuSig2Builder(testNet, alice.PubKey(), bob.PubKey(), pool, 20000, 2)
+		}, []*btcec.PrivateKey{alice, bob}},
+		{"bip112 relative lock", func(pool []*UTXO) (*TxBuilder, error) {
+			return newBip112P2wshBuilder(testNet, alice.PubKey(), bob.PubKey(), pool, 20000, 2, 10, true,
+				[]byte("timelock"), []byte("multisig"))
+		}, []*btcec.PrivateKey{alice}},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			builder, err := test.builder(testPool(60000))
+			if err != nil {
+				t.Fatal(err)
+			}
+			withKeys(builder.Pool, test.signers...)
+			tx, err := builder.Build()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			replacement, err := BumpFee(testNet, tx, builder.Pool, len(tx.TxOut)-1, nil, 20)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if replacement.TxIn[0].Sequence != tx.TxIn[0].Sequence {
+				t.Errorf("sequence %x, want %x", replacement.TxIn[0].Sequence, tx.TxIn[0].Sequence)
+			}
+			if replacement.TxOut[0].Value != tx.TxOut[0].Value ||
+				!bytes.Equal(replacement.TxOut[0].PkScript, tx.TxOut[0].PkScript) {
+				t.Errorf("the recipient isn't kept")
+			}
+			check, err := CheckReplacement(tx, replacement, prevOutFetcher(builder.Pool), nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if check.ReplacementFee <= check.OriginalFee {
+				t.Errorf("fee %d, original %d", check.ReplacementFee, check.OriginalFee)
+			}
+		})
+	}
+}
+
+func TestBumpFeeRawOutputs(t *testing.T) {
+	nullData, err := txscript.NullDataScript([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	builder := testP2WPKHBuilder(t, testPool(60000), 20000, 2)
+	builder.Inputs, builder.Pool = builder.Pool, nil
+	builder.Sequences = []uint32{0}
+	builder.Outputs = []*wire.TxOut{wire.NewTxOut(0, nullData)}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if tx.TxIn[0].Sequence != 0 || len(tx.TxOut) != 3 {
+		t.Fatalf("sequence %d, %d outputs", tx.TxIn[0].Sequence, len(tx.TxOut))
+	}
+
+	// the OP_RETURN and the sequence 0 are kept as they are
+	replacement, err := BumpFee(testNet, tx, builder.Inputs, 2, nil, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacement.TxIn[0].Sequence != 0 {
+		t.Errorf("sequence %d", replacement.TxIn[0].Sequence)
+	}
+	if len(replacement.TxOut) != 3 || !bytes.Equal(replacement.TxOut[0].PkScript, nullData) ||
+		replacement.TxOut[1].Value != 20000 {
+		t.Errorf("outputs %v", replacement.TxOut)
+	}
+	if txFee(replacement, builder.Inputs) <= txFee(tx, builder.Inputs) {
+		t.Error("the fee isn't bumped")
+	}
+}
+
+func TestReplaceByFee(t *testing.T) {
+	origin, replacement, err := ReplaceByFee(testNet, testKey(1), testPool(60000), 20000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replacement.TxIn[0].PreviousOutPoint != origin.TxIn[0].PreviousOutPoint ||
+		replacement.TxOut[len(replacement.TxOut)-1].Value >= origin.TxOut[len(origin.TxOut)-1].Value {
+		t.Error("the change of the replacement doesn't pay more fee")
+	}
+}
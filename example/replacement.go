@@ -0,0 +1,249 @@
+package example
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// maxReplacementEvictions is the most transactions a replacement can evict from the mempool
+const maxReplacementEvictions = 100
+
+// ReplacementOptions is the mempool state for CheckReplacement
+type ReplacementOptions struct {
+	// Descendants are the mempool transactions spending the original directly or not, they're evicted too
+	Descendants []*wire.MsgTx
+	// Mempool is the other unconfirmed transactions, an input spending them is unconfirmed.
+	// Without it only the outputs of the original and its descendants are known to be unconfirmed.
+	Mempool []*wire.MsgTx
+	// FullRBF replaces the transactions not signaling bip125 like Bitcoin Core 28 and later
+	FullRBF bool
+	// IncrementalRelayFee in sat/kvB, zero means mempool.DefaultMinRelayTxFee
+	IncrementalRelayFee btcutil.Amount
+}
+
+// ReplacementRule is the result of a replacement rule
+type ReplacementRule struct {
+	Rule   int    `json:"rule"`
+	Name   string `json:"name"`
+	Passed bool   `json:"passed"`
+	Detail string `json:"detail"`
+}
+
+// ReplacementCheck reports the replacement rules of a candidate
+type ReplacementCheck struct {
+	OriginalFee   int64 `json:"original_fee"`
+	OriginalVSize int64 `json:"original_vsize"`
+	// EvictedFee is the fee of the original and its descendants
+	EvictedFee       int64 `json:"evicted_fee"`
+	Evicted          int   `json:"evicted"`
+	ReplacementFee   int64 `json:"replacement_fee"`
+	ReplacementVSize int64 `json:"replacement_vsize"`
+	// MinFee is the lowest fee of a replacement of the same vsize passing the fee rules
+	MinFee int64              `json:"min_fee"`
+	Rules  []*ReplacementRule `json:"rules"`
+}
+
+// CheckReplacement checks the replacement of the original against the rules of bip125 as Bitcoin Core
+// applies them, the fetcher has the confirmed outputs spent by both transactions and the descendants.
+// The rules are numbered like bip125, and the 6th is the fee rate rule Bitcoin Core added:
+//  1. the original signals bip125 by an input sequence below 0xfffffffe, or full rbf is on
+//  2. the replacement only spends the unconfirmed outputs of the parents of the original
+//  3. the replacement pays at least the fee of all the evicted transactions
+//  4. the replacement pays its own vsize at the incremental relay fee on top of that
+//  5. at most 100 transactions are evicted
+//  6. the fee rate of the replacement is higher than the original's
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0125.mediawiki
+// https://github.com/bitcoin/bitcoin/blob/master/doc/policy/mempool-replacements.md
+func CheckReplacement(original, replacement *wire.MsgTx, fetcher txscript.PrevOutputFetcher,
+	opts *ReplacementOptions) (*ReplacementCheck, error) {
+	if opts == nil {
+		opts = new(ReplacementOptions)
+	}
+	if !conflicts(original, replacement) {
+		return nil, fmt.Errorf("%w: %s doesn't spend any input of %s", ErrInvalidTx,
+			replacement.TxHash(), original.TxHash())
+	}
+
+	unconfirmed := make(map[chainhash.Hash]*wire.MsgTx)
+	for _, tx := range append(append([]*wire.MsgTx{original}, opts.Descendants...), opts.Mempool...) {
+		unconfirmed[tx.TxHash()] = tx
+	}
+
+	check := &ReplacementCheck{
+		OriginalVSize:    mempool.GetTxVirtualSize(btcutil.NewTx(original)),
+		ReplacementVSize: mempool.GetTxVirtualSize(btcutil.NewTx(replacement)),
+		Evicted:          1 + len(opts.Descendants),
+	}
+	var err error
+	if check.OriginalFee, err = mempoolTxFee(original, fetcher, unconfirmed); err != nil {
+		return nil, err
+	}
+	if check.ReplacementFee, err = mempoolTxFee(replacement, fetcher, unconfirmed); err != nil {
+		return nil, err
+	}
+	check.EvictedFee = check.OriginalFee
+	for _, tx := range opts.Descendants {
+		fee, err := mempoolTxFee(tx, fetcher, unconfirmed)
+		if err != nil {
+			return nil, err
+		}
+		check.EvictedFee += fee
+	}
+
+	incrementalRelayFee := int64(opts.IncrementalRelayFee)
+	if incrementalRelayFee == 0 {
+		incrementalRelayFee = int64(mempool.DefaultMinRelayTxFee)
+	}
+	// Bitcoin Core rounds the fee of a fee rate up
+	relayFee := (check.ReplacementVSize*incrementalRelayFee + 999) / 1000
+	// the lowest fee of the same vsize strictly above the fee rate of the original
+	feeRateFee := check.OriginalFee*check.ReplacementVSize/check.OriginalVSize + 1
+	check.MinFee = max(check.EvictedFee+relayFee, feeRateFee)
+
+	signaled := signalsReplacement(original)
+	detail := "the original signals bip125"
+	if !signaled {
+		detail = "the original doesn't signal bip125"
+		if opts.FullRBF {
+			detail += ", full rbf replaces it anyway"
+		}
+	}
+	check.add(1, "signaling", signaled || opts.FullRBF, detail)
+
+	newUnconfirmed := newUnconfirmedInputs(original, replacement, unconfirmed)
+	detail = "every unconfirmed input is spent by the original"
+	if len(newUnconfirmed) > 0 {
+		detail = fmt.Sprintf("new unconfirmed inputs %v", newUnconfirmed)
+	}
+	check.add(2, "no new unconfirmed inputs", len(newUnconfirmed) == 0, detail)
+
+	check.add(3, "absolute fee", check.ReplacementFee >= check.EvictedFee,
+		fmt.Sprintf("fee %d, evicted fee %d", check.ReplacementFee, check.EvictedFee))
+
+	check.add(4, "incremental relay fee", check.ReplacementFee-check.EvictedFee >= relayFee,
+		fmt.Sprintf("additional fee %d, %d vbytes at %d sat/kvB need %d",
+			check.ReplacementFee-check.EvictedFee, check.ReplacementVSize, incrementalRelayFee, relayFee))
+
+	check.add(5, "evictions", check.Evicted <= maxReplacementEvictions,
+		fmt.Sprintf("%d evicted, at most %d", check.Evicted, maxReplacementEvictions))
+
+	// compare fee/vsize without the rounding of a division
+	check.add(6, "fee rate", check.ReplacementFee*check.OriginalVSize > check.OriginalFee*check.ReplacementVSize,
+		fmt.Sprintf("%.2f sat/vB, original %.2f sat/vB",
+			float64(check.ReplacementFee)/float64(check.ReplacementVSize),
+			float64(check.OriginalFee)/float64(check.OriginalVSize)))
+	return check, nil
+}
+
+func (c *ReplacementCheck) add(rule int, name string, passed bool, detail string) {
+	c.Rules = append(c.Rules, &ReplacementRule{Rule: rule, Name: name, Passed: passed, Detail: detail})
+}
+
+// Err returns the first failed rule, nil if the replacement is accepted
+func (c *ReplacementCheck) Err() error {
+	for _, rule := range c.Rules {
+		if !rule.Passed {
+			return fmt.Errorf("%w: rule %d %s: %s, min fee %d", ErrReplacementRejected,
+				rule.Rule, rule.Name, rule.Detail, c.MinFee)
+		}
+	}
+	return nil
+}
+
+// String renders the check as text
+func (c *ReplacementCheck) String() string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "original: fee %d, vsize %d\n", c.OriginalFee, c.OriginalVSize)
+	fmt.Fprintf(&buf, "evicted: %d transactions, fee %d\n", c.Evicted, c.EvictedFee)
+	fmt.Fprintf(&buf, "replacement: fee %d, vsize %d, min fee %d\n", c.ReplacementFee, c.ReplacementVSize, c.MinFee)
+	for _, rule := range c.Rules {
+		result := "pass"
+		if !rule.Passed {
+			result = "FAIL"
+		}
+		fmt.Fprintf(&buf, "  rule %d %s: %s, %s\n", rule.Rule, rule.Name, result, rule.Detail)
+	}
+	return buf.String()
+}
+
+// JSON renders the check as indented JSON
+func (c *ReplacementCheck) JSON() ([]byte, error) {
+	return json.MarshalIndent(c, "", "  ")
+}
+
+// signalsReplacement is the explicit signal of bip125, the inherited signal of the ancestors isn't checked
+func signalsReplacement(tx *wire.MsgTx) bool {
+	for _, txin := range tx.TxIn {
+		if txin.Sequence < wire.MaxTxInSequenceNum-1 {
+			return true
+		}
+	}
+	return false
+}
+
+// conflicts tells whether the transactions spend a same output
+func conflicts(a, b *wire.MsgTx) bool {
+	for _, txin := range b.TxIn {
+		if spendsOutPoint(a, txin.PreviousOutPoint) {
+			return true
+		}
+	}
+	return false
+}
+
+func spendsOutPoint(tx *wire.MsgTx, outpoint wire.OutPoint) bool {
+	for _, txin := range tx.TxIn {
+		if txin.PreviousOutPoint == outpoint {
+			return true
+		}
+	}
+	return false
+}
+
+// newUnconfirmedInputs are the inputs of the replacement spending an unconfirmed output of a transaction
+// none of the inputs of the original spends, like HasNoNewUnconfirmed of Bitcoin Core another output of
+// a parent is fine. Spending an output of the original or its descendants is one of them too.
+func newUnconfirmedInputs(original, replacement *wire.MsgTx, unconfirmed map[chainhash.Hash]*wire.MsgTx) []wire.OutPoint {
+	parents := make(map[chainhash.Hash]bool, len(original.TxIn))
+	for _, txin := range original.TxIn {
+		parents[txin.PreviousOutPoint.Hash] = true
+	}
+	var inputs []wire.OutPoint
+	for _, txin := range replacement.TxIn {
+		if _, ok := unconfirmed[txin.PreviousOutPoint.Hash]; ok && !parents[txin.PreviousOutPoint.Hash] {
+			inputs = append(inputs, txin.PreviousOutPoint)
+		}
+	}
+	return inputs
+}
+
+// mempoolTxFee is the fee of the tx, the spent outputs are in the unconfirmed transactions or the fetcher
+func mempoolTxFee(tx *wire.MsgTx, fetcher txscript.PrevOutputFetcher,
+	unconfirmed map[chainhash.Hash]*wire.MsgTx) (int64, error) {
+	var fee int64
+	for idx, txin := range tx.TxIn {
+		outpoint := txin.PreviousOutPoint
+		var prevOut *wire.TxOut
+		if parent, ok := unconfirmed[outpoint.Hash]; ok && int(outpoint.Index) < len(parent.TxOut) {
+			prevOut = parent.TxOut[outpoint.Index]
+		} else if fetcher != nil {
+			prevOut = fetcher.FetchPrevOutput(outpoint)
+		}
+		if prevOut == nil {
+			return 0, fmt.Errorf("%w: no output %s spent by input %d of %s", ErrInvalidTx, outpoint, idx, tx.TxHash())
+		}
+		fee += prevOut.Value
+	}
+	for _, txout := range tx.TxOut {
+		fee -= txout.Value
+	}
+	return fee, nil
+}
@@ -0,0 +1,102 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+func TestCheckReplacement(t *testing.T) {
+	pool := testPool(60000)
+	origin, replacement, err := ReplaceByFee(testNet, testKey(1), pool, 20000, 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := prevOutFetcher(spendFrom(pool, UTXO{PkScript: origin.TxOut[0].PkScript}))
+
+	check, err := CheckReplacement(origin, replacement, fetcher, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Err(); err != nil {
+		t.Fatalf("%v\n%s", err, check)
+	}
+
+	// the original pays less than the replacement
+	check, err = CheckReplacement(replacement, origin, fetcher, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Err(); !errors.Is(err, ErrReplacementRejected) {
+		t.Errorf("got %v, want ErrReplacementRejected", err)
+	}
+	if check.MinFee <= check.EvictedFee {
+		t.Errorf("min fee %d, evicted fee %d", check.MinFee, check.EvictedFee)
+	}
+
+	final := origin.Copy()
+	for _, txin := range final.TxIn {
+		txin.Sequence = wire.MaxTxInSequenceNum
+	}
+	check, err = CheckReplacement(final, replacement, fetcher, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Rules[0].Passed {
+		t.Error("the original doesn't signal bip125")
+	}
+	check, err = CheckReplacement(final, replacement, fetcher, &ReplacementOptions{FullRBF: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !check.Rules[0].Passed {
+		t.Error("full rbf replaces without the signal")
+	}
+
+	if _, err := CheckReplacement(origin, wire.NewMsgTx(2), fetcher, nil); !errors.Is(err, ErrInvalidTx) {
+		t.Errorf("got %v, want ErrInvalidTx", err)
+	}
+}
+
+func TestCheckReplacementUnconfirmedInputs(t *testing.T) {
+	pkScript := []byte{0x51}
+	confirmed := wire.OutPoint{Hash: chainhash.DoubleHashH([]byte("confirmed")), Index: 0}
+	newTx := func(outpoints []wire.OutPoint, values ...int64) *wire.MsgTx {
+		tx := wire.NewMsgTx(2)
+		for _, outpoint := range outpoints {
+			tx.AddTxIn(&wire.TxIn{PreviousOutPoint: outpoint, Sequence: wire.MaxTxInSequenceNum - 2})
+		}
+		for _, value := range values {
+			tx.AddTxOut(wire.NewTxOut(value, pkScript))
+		}
+		return tx
+	}
+	fetcher := prevOutFetcher([]*UTXO{{OutPoint: confirmed, Amount: 200000, PkScript: pkScript}})
+
+	// the unconfirmed parent of the original and another unconfirmed transaction
+	parent := newTx([]wire.OutPoint{confirmed}, 50000, 50000, 50000)
+	other := newTx([]wire.OutPoint{{Hash: chainhash.DoubleHashH([]byte("other"))}}, 50000)
+	opts := &ReplacementOptions{Mempool: []*wire.MsgTx{parent, other}}
+	original := newTx([]wire.OutPoint{{Hash: parent.TxHash(), Index: 0}}, 49000)
+
+	// another output of the parent isn't a new unconfirmed input
+	sibling := newTx([]wire.OutPoint{{Hash: parent.TxHash(), Index: 0}, {Hash: parent.TxHash(), Index: 1}}, 90000)
+	check, err := CheckReplacement(original, sibling, fetcher, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := check.Err(); err != nil {
+		t.Errorf("%v\n%s", err, check)
+	}
+
+	stranger := newTx([]wire.OutPoint{{Hash: parent.TxHash(), Index: 0}, {Hash: other.TxHash(), Index: 0}}, 90000)
+	check, err = CheckReplacement(original, stranger, fetcher, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if check.Rules[1].Passed {
+		t.Errorf("spends the unconfirmed output of a stranger\n%s", check)
+	}
+}
@@ -0,0 +1,466 @@
+package example
+
+import (
+	"bytes"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// SpendType describes how an output is unlocked
+type SpendType uint8
+
+const (
+	SpendP2PKH SpendType = iota + 1
+	SpendP2SHMultiSig
+	SpendP2WPKH
+	SpendP2WSHMultiSig
+	SpendP2TRKeyPath
+	SpendP2TRScriptPath
+	SpendBip112Timelock
+	SpendBip112MultiSig
+	SpendMuSig2
+	SpendP2SHP2WPKH
+	SpendMiniscript
+	SpendP2SHP2WSHMultiSig
+)
+
+func (t SpendType) String() string {
+	switch t {
+	case SpendP2PKH:
+		return "p2pkh"
+	case SpendP2SHMultiSig:
+		return "p2sh-multisig"
+	case SpendP2WPKH:
+		return "p2wpkh"
+	case SpendP2WSHMultiSig:
+		return "p2wsh-multisig"
+	case SpendP2TRKeyPath:
+		return "p2tr-keypath"
+	case SpendP2TRScriptPath:
+		return "p2tr-scriptpath"
+	case SpendBip112Timelock:
+		return "bip112-timelock"
+	case SpendBip112MultiSig:
+		return "bip112-multisig"
+	case SpendMuSig2:
+		return "musig2"
+	case SpendP2SHP2WPKH:
+		return "p2sh-p2wpkh"
+	case SpendMiniscript:
+		return "miniscript"
+	case SpendP2SHP2WSHMultiSig:
+		return "p2sh-p2wsh-multisig"
+	default:
+		return fmt.Sprintf("unknown(%d)", uint8(t))
+	}
+}
+
+// UTXO is an unspent output together with everything needed to sign it
+type UTXO struct {
+	OutPoint  wire.OutPoint
+	Amount    int64
+	PkScript  []byte
+	SpendType SpendType
+
+	// PrevTx is the transaction of the OutPoint, the psbt of the legacy inputs carries it as the non-witness utxo
+	PrevTx *wire.MsgTx
+
+	// Sequence of the txin, zero means wire.MaxTxInSequenceNum
+	Sequence uint32
+
+	// UncompressedPubKey is set if the p2pkh script hashes the uncompressed pubkey,
+	// like the address of a WIF without the compressed flag
+	UncompressedPubKey bool
+
+	// Keys sign the input, multisig scripts only need the keys of the signers,
+	// musig2 needs the keys of all the signers
+	Keys []*btcec.PrivateKey
+
+	// Script is the redeem script of p2sh, the witness script of p2wsh or the tapscript leaf,
+	// p2sh-p2wpkh has the witness program as the redeem script and p2sh-p2wsh has the witness script
+	Script []byte
+
+	// TapInternalKey is the internal key of taproot key path, psbt needs it to find the signer
+	TapInternalKey *btcec.PublicKey
+
+	// MuSig2Signers are the pubkeys aggregated to the internal key of SpendMuSig2,
+	// the psbt carries them as the musig2 participants of BIP373
+	MuSig2Signers []*btcec.PublicKey
+
+	// TapMerkleRoot is the script tree root for taproot key path, nil for bip86 outputs
+	TapMerkleRoot []byte
+
+	// ControlBlock is the serialized control block of the tapscript leaf
+	ControlBlock []byte
+
+	// Preimage selects the branch of the bip112 script, or satisfies a hash of the miniscript
+	Preimage []byte
+
+	// Miniscript is the p2wsh witness script or the tapscript leaf of SpendMiniscript,
+	// the leaf also needs the ControlBlock
+	Miniscript *Miniscript
+
+	// Origins are the bip32 origins of the pubkeys, they're copied into the psbt
+	Origins []*KeyOrigin
+}
+
+func (u *UTXO) sequence() uint32 {
+	if u.Sequence == 0 {
+		return wire.MaxTxInSequenceNum
+	}
+	return u.Sequence
+}
+
+// prevOutFetcher returns the fetcher for all the inputs, taproot sighash commits to every prevout
+func prevOutFetcher(utxos []*UTXO) *txscript.MultiPrevOutFetcher {
+	fetcher := txscript.NewMultiPrevOutFetcher(nil)
+	for _, utxo := range utxos {
+		fetcher.AddPrevOut(utxo.OutPoint, wire.NewTxOut(utxo.Amount, utxo.PkScript))
+	}
+	return fetcher
+}
+
+// signInput signs the txin at idx according to the spend type of the utxo
+func signInput(tx *wire.MsgTx, fetcher txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes,
+	idx int, utxo *UTXO) error {
+	if len(utxo.Keys) == 0 {
+		return fmt.Errorf("%w: no key for input %d", ErrInvalidKey, idx)
+	}
+
+	txin := tx.TxIn[idx]
+	var err error
+	switch utxo.SpendType {
+	case SpendP2PKH:
+		txin.SignatureScript, err = signP2PKH(tx, idx, utxo.PkScript, utxo.Keys[0], !utxo.UncompressedPubKey)
+	case SpendP2SHMultiSig:
+		txin.SignatureScript, err = signP2SHMultiSig(tx, idx, utxo.Script, utxo.Keys)
+	case SpendP2WPKH:
+		txin.Witness, err = signP2WPKH(tx, sigHashes, idx, utxo.Amount, utxo.PkScript, utxo.Keys[0])
+	case SpendP2SHP2WPKH:
+		txin.SignatureScript, txin.Witness, err = signP2SHP2WPKH(tx, sigHashes, idx, utxo.Amount,
+			utxo.Script, utxo.Keys[0])
+	case SpendP2WSHMultiSig:
+		txin.Witness, err = signP2WSHMultiSig(tx, sigHashes, idx, utxo.Amount, utxo.Script, utxo.Keys)
+	case SpendP2SHP2WSHMultiSig:
+		txin.SignatureScript, txin.Witness, err = signP2SHP2WSHMultiSig(tx, sigHashes, idx, utxo.Amount,
+			utxo.Script, utxo.Keys)
+	case SpendP2TRKeyPath:
+		txin.Witness, err = signP2TRKeyPath(tx, sigHashes, idx, utxo.Amount, utxo.PkScript,
+			utxo.TapMerkleRoot, utxo.Keys[0])
+	case SpendP2TRScriptPath:
+		txin.Witness, err = signP2TRScriptPath(tx, sigHashes, idx, utxo.Amount, utxo.PkScript,
+			utxo.Script, utxo.ControlBlock, utxo.Keys)
+	case SpendBip112Timelock:
+		txin.Witness, err = signBip112Timelock(tx, sigHashes, idx, utxo.Amount, utxo.Script,
+			utxo.Preimage, utxo.Keys[0])
+	case SpendBip112MultiSig:
+		txin.Witness, err = signBip112MultiSig(tx, sigHashes, idx, utxo.Amount, utxo.Script,
+			utxo.Preimage, utxo.Keys)
+	case SpendMuSig2:
+		txin.Witness, err = signMuSig2(tx, fetcher, sigHashes, idx, utxo.Keys, utxo.TapMerkleRoot)
+	case SpendMiniscript:
+		txin.Witness, err = signMiniscript(tx, sigHashes, idx, utxo)
+	default:
+		return fmt.Errorf("unsupported spend type %s for input %d", utxo.SpendType, idx)
+	}
+	if err != nil {
+		return fmt.Errorf("sign input %d: %w", idx, err)
+	}
+	return nil
+}
+
+func signP2PKH(tx *wire.MsgTx, idx int, pkScript []byte, prvkey *btcec.PrivateKey, compress bool) ([]byte, error) {
+	return txscript.SignatureScript(tx, idx, pkScript, txscript.SigHashAll, prvkey, compress)
+}
+
+func signP2WPKH(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	pkScript []byte, prvkey *btcec.PrivateKey) (wire.TxWitness, error) {
+	return txscript.WitnessSignature(tx, sigHashes, idx, amount, pkScript, txscript.SigHashAll, prvkey, true)
+}
+
+// signP2SHP2WPKH signs the p2wpkh nested in p2sh, the scriptSig only pushes the witness program
+func signP2SHP2WPKH(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	redeemScript []byte, prvkey *btcec.PrivateKey) ([]byte, wire.TxWitness, error) {
+	witness, err := txscript.WitnessSignature(tx, sigHashes, idx, amount, redeemScript, txscript.SigHashAll, prvkey, true)
+	if err != nil {
+		return nil, nil, err
+	}
+	sigScript, err := txscript.NewScriptBuilder().AddData(redeemScript).Script()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return sigScript, witness, nil
+}
+
+func signP2SHMultiSig(tx *wire.MsgTx, idx int, redeemScript []byte, keys []*btcec.PrivateKey) ([]byte, error) {
+	sigs, err := multisigSignatures(redeemScript, keys, func(prvkey *btcec.PrivateKey) ([]byte, error) {
+		return txscript.RawTxInSignature(tx, idx, redeemScript, txscript.SigHashAll, prvkey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// OP_0 is a workaround of the off-by-one bug of OP_CHECKMULTISIG
+	builder := txscript.NewScriptBuilder().AddOp(txscript.OP_0)
+	for _, sig := range sigs {
+		builder.AddData(sig)
+	}
+	sigScript, err := builder.AddData(redeemScript).Script()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return sigScript, nil
+}
+
+func signP2WSHMultiSig(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	witnessScript []byte, keys []*btcec.PrivateKey) (wire.TxWitness, error) {
+	sigs, err := multisigSignatures(witnessScript, keys, func(prvkey *btcec.PrivateKey) ([]byte, error) {
+		return txscript.RawTxInWitnessSignature(tx, sigHashes, idx, amount,
+			witnessScript, txscript.SigHashAll, prvkey)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// https://github.com/bitcoin/bips/blob/master/bip-0141.mediawiki
+	// A non-witness program (defined hereinafter) txin MUST be associated with an empty witness field, represented by a 0x00.
+	witness := wire.TxWitness{[]byte{}}
+	witness = append(witness, sigs...)
+	return append(witness, witnessScript), nil
+}
+
+// signP2SHP2WSHMultiSig signs the p2wsh multisig nested in p2sh, the scriptSig only pushes the witness program
+func signP2SHP2WSHMultiSig(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	witnessScript []byte, keys []*btcec.PrivateKey) ([]byte, wire.TxWitness, error) {
+	witness, err := signP2WSHMultiSig(tx, sigHashes, idx, amount, witnessScript, keys)
+	if err != nil {
+		return nil, nil, err
+	}
+	sigScript, err := txscript.NewScriptBuilder().AddData(p2wshProgram(witnessScript)).Script()
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return sigScript, witness, nil
+}
+
+func signP2TRKeyPath(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	pkScript, merkleRoot []byte, prvkey *btcec.PrivateKey) (wire.TxWitness, error) {
+	if merkleRoot == nil {
+		return txscript.TaprootWitnessSignature(tx, sigHashes, idx, amount, pkScript,
+			txscript.SigHashDefault, prvkey)
+	}
+
+	sig, err := txscript.RawTxInTaprootSignature(tx, sigHashes, idx, amount, pkScript,
+		merkleRoot, txscript.SigHashDefault, prvkey)
+	if err != nil {
+		return nil, err
+	}
+	return wire.TxWitness{sig}, nil
+}
+
+// signP2TRScriptPath signs a leaf made of `<pubkey> OP_CHECKSIG` and `<pubkey> OP_CHECKSIGADD`,
+// every pubkey in the leaf gets either a signature or an empty vector, in reverse order.
+// Only the threshold of the keys sign a multi_a leaf, the first ones in the order of the pubkeys.
+func signP2TRScriptPath(tx *wire.MsgTx, sigHashes *txscript.TxSigHashes, idx int, amount int64,
+	pkScript, leafScript, controlBlock []byte, keys []*btcec.PrivateKey) (wire.TxWitness, error) {
+	ctrlBlock, err := txscript.ParseControlBlock(controlBlock)
+	if err != nil {
+		return nil, err
+	}
+	leaf := txscript.NewTapLeaf(ctrlBlock.LeafVersion, leafScript)
+
+	pubkeys, err := txscript.PushedData(leafScript)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+
+	var missing int
+	for _, prvkey := range keys {
+		if !scriptHasData(leafScript, schnorr.SerializePubKey(prvkey.PubKey())) {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("%w: %d of %d keys are not in the leaf", ErrInvalidKey, missing, len(keys))
+	}
+	threshold := len(keys)
+	if _, m, ok := parseTapscriptMulti(leafScript); ok {
+		if len(keys) < m {
+			return nil, fmt.Errorf("%w: %d keys of the %d-of-n leaf", ErrInvalidKey, len(keys), m)
+		}
+		threshold = m
+	}
+
+	signed := 0
+	witness := make(wire.TxWitness, 0, len(pubkeys)+2)
+	for _, pubkey := range pubkeys {
+		if len(pubkey) != xonlyPubKeySize {
+			continue
+		}
+
+		sig := []byte{}
+		for _, prvkey := range keys {
+			if signed == threshold || !bytes.Equal(schnorr.SerializePubKey(prvkey.PubKey()), pubkey) {
+				continue
+			}
+			sig, err = txscript.RawTxInTapscriptSignature(tx, sigHashes, idx, amount,
+				pkScript, leaf, txscript.SigHashDefault, prvkey)
+			if err != nil {
+				return nil, err
+			}
+			signed++
+			break
+		}
+		witness = append(witness, sig)
+	}
+	slices.Reverse(witness)
+
+	return append(witness, leafScript, controlBlock), nil
+}
+
+// multisigSignatures signs with the threshold of the keys and orders the signatures like the pubkeys
+// in the script, OP_CHECKMULTISIG requires that order. Any subset of the cosigners can sign,
+// the extra keys beyond the threshold are ignored.
+func multisigSignatures(script []byte, keys []*btcec.PrivateKey,
+	signFn func(*btcec.PrivateKey) ([]byte, error)) ([][]byte, error) {
+	pubkeys, m, ok := parseMultiSigScript(script)
+	if !ok {
+		return nil, fmt.Errorf("%w: %x is not a multisig script", ErrScriptBuild, script)
+	}
+
+	var missing int
+	for _, prvkey := range keys {
+		if signingPubKey(script, prvkey.PubKey()) == nil {
+			missing++
+		}
+	}
+	if missing > 0 {
+		return nil, fmt.Errorf("%w: %d of %d keys are not in the script", ErrInvalidKey, missing, len(keys))
+	}
+	if len(keys) < m {
+		return nil, fmt.Errorf("%w: %d keys of %d-of-%d multisig", ErrInvalidKey, len(keys), m, len(pubkeys))
+	}
+
+	sigs := make([][]byte, 0, m)
+	for _, pubkey := range pubkeys {
+		if len(sigs) == m {
+			break
+		}
+		for _, prvkey := range keys {
+			if !bytes.Equal(prvkey.PubKey().SerializeCompressed(), pubkey) &&
+				!bytes.Equal(prvkey.PubKey().SerializeUncompressed(), pubkey) {
+				continue
+			}
+			sig, err := signFn(prvkey)
+			if err != nil {
+				return nil, err
+			}
+			sigs = append(sigs, sig)
+			break
+		}
+	}
+	return sigs, nil
+}
+
+// parseTapscriptMulti parses a leaf of `<pubkey> OP_CHECKSIG` or
+// `<pubkey_1> OP_CHECKSIG <pubkey_2> OP_CHECKSIGADD ... <pubkey_n> OP_CHECKSIGADD m OP_NUMEQUAL`,
+// it returns the x-only pubkeys and the threshold
+func parseTapscriptMulti(leafScript []byte) ([][]byte, int, bool) {
+	type token struct {
+		op   byte
+		data []byte
+	}
+	var tokens []token
+	tokenizer := txscript.MakeScriptTokenizer(0, leafScript)
+	for tokenizer.Next() {
+		tokens = append(tokens, token{tokenizer.Opcode(), tokenizer.Data()})
+	}
+	if tokenizer.Err() != nil || len(tokens) < 2 {
+		return nil, 0, false
+	}
+
+	var pubkeys [][]byte
+	for i := 0; i+1 < len(tokens); i += 2 {
+		checksig := byte(txscript.OP_CHECKSIGADD)
+		if i == 0 {
+			checksig = txscript.OP_CHECKSIG
+		}
+		if len(tokens[i].data) != xonlyPubKeySize || tokens[i+1].op != checksig {
+			break
+		}
+		pubkeys = append(pubkeys, tokens[i].data)
+	}
+
+	rest := tokens[2*len(pubkeys):]
+	switch {
+	case len(pubkeys) == 0:
+		return nil, 0, false
+	case len(rest) == 0 && len(pubkeys) == 1:
+		return pubkeys, 1, true
+	case len(rest) != 2 || rest[1].op != txscript.OP_NUMEQUAL:
+		return nil, 0, false
+	}
+
+	threshold, ok := scriptNumber(rest[0].op, rest[0].data)
+	if !ok || threshold < 1 || threshold > len(pubkeys) {
+		return nil, 0, false
+	}
+	return pubkeys, threshold, true
+}
+
+// parseMultiSigScript parses `m <pubkey>... n OP_CHECKMULTISIG` and returns the pubkeys and m,
+// unlike txscript.CalcMultiSigStats it knows p2wsh multisig of more than 16 pubkeys
+func parseMultiSigScript(script []byte) ([][]byte, int, bool) {
+	tokenizer := txscript.MakeScriptTokenizer(0, script)
+	if !tokenizer.Next() {
+		return nil, 0, false
+	}
+	threshold, ok := scriptNumber(tokenizer.Opcode(), tokenizer.Data())
+	if !ok {
+		return nil, 0, false
+	}
+
+	var pubkeys [][]byte
+	for tokenizer.Next() {
+		data := tokenizer.Data()
+		if len(data) != compressedPubKeySize && len(data) != uncompressedPubKeySize {
+			break
+		}
+		pubkeys = append(pubkeys, data)
+	}
+	if n, ok := scriptNumber(tokenizer.Opcode(), tokenizer.Data()); !ok || n != len(pubkeys) {
+		return nil, 0, false
+	}
+	if !tokenizer.Next() || tokenizer.Opcode() != txscript.OP_CHECKMULTISIG || tokenizer.Next() || tokenizer.Err() != nil {
+		return nil, 0, false
+	}
+	if threshold < 1 || threshold > len(pubkeys) {
+		return nil, 0, false
+	}
+	return pubkeys, threshold, true
+}
+
+func isMultiSigScript(script []byte) bool {
+	_, _, ok := parseMultiSigScript(script)
+	return ok
+}
+
+// scriptNumber decodes a small int or a minimal number push
+func scriptNumber(op byte, data []byte) (int, bool) {
+	if txscript.IsSmallInt(op) {
+		return txscript.AsSmallInt(op), true
+	}
+	if op > txscript.OP_PUSHDATA4 {
+		return 0, false
+	}
+	num, err := txscript.MakeScriptNum(data, true, 4)
+	if err != nil {
+		return 0, false
+	}
+	return int(num.Int32()), true
+}
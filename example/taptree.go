@@ -0,0 +1,301 @@
+package example
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// TapTree is a taproot script tree, a node is either a leaf or a branch of two subtrees.
+// The leaves are indexed from left to right, see Leaves.
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0341.mediawiki#constructing-and-spending-taproot-outputs
+type TapTree struct {
+	Leaf        *txscript.TapLeaf
+	Left, Right *TapTree
+}
+
+// NewTapTree builds a balanced tree of the leaves in the given order
+func NewTapTree(leaves ...txscript.TapLeaf) (*TapTree, error) {
+	if len(leaves) == 0 {
+		return nil, fmt.Errorf("%w: no tapscript leaf", ErrScriptBuild)
+	}
+	if len(leaves) == 1 {
+		return &TapTree{Leaf: &leaves[0]}, nil
+	}
+
+	half := (len(leaves) + 1) / 2
+	left, err := NewTapTree(leaves[:half]...)
+	if err != nil {
+		return nil, err
+	}
+	right, err := NewTapTree(leaves[half:]...)
+	if err != nil {
+		return nil, err
+	}
+	return &TapTree{Left: left, Right: right}, nil
+}
+
+// NewHuffmanTapTree builds the tree by the spend weights of the leaves, the likely leaves are
+// closer to the root and have smaller control blocks. It merges the two lightest nodes until
+// one is left, the ties are broken by the order of the leaves.
+func NewHuffmanTapTree(leaves []txscript.TapLeaf, weights []int) (*TapTree, error) {
+	if len(leaves) == 0 || len(leaves) != len(weights) {
+		return nil, fmt.Errorf("%w: %d leaves, %d weights", ErrScriptBuild, len(leaves), len(weights))
+	}
+
+	type weighted struct {
+		tree   *TapTree
+		weight int
+		seq    int
+	}
+	queue := make([]weighted, 0, len(leaves))
+	for i := range leaves {
+		if weights[i] <= 0 {
+			return nil, fmt.Errorf("%w: weight %d of leaf %d", ErrScriptBuild, weights[i], i)
+		}
+		queue = append(queue, weighted{tree: &TapTree{Leaf: &leaves[i]}, weight: weights[i], seq: i})
+	}
+
+	for seq := len(queue); len(queue) > 1; seq++ {
+		slices.SortFunc(queue, func(a, b weighted) int {
+			if a.weight != b.weight {
+				return a.weight - b.weight
+			}
+			return a.seq - b.seq
+		})
+		a, b := queue[0], queue[1]
+		queue = append(queue[2:], weighted{
+			tree:   &TapTree{Left: a.tree, Right: b.tree},
+			weight: a.weight + b.weight,
+			seq:    seq,
+		})
+	}
+
+	tree := queue[0].tree
+	if depth := tree.depth(); depth > txscript.ControlBlockMaxNodeCount {
+		return nil, fmt.Errorf("%w: tree depth %d exceeds %d", ErrScriptBuild, depth, txscript.ControlBlockMaxNodeCount)
+	}
+	return tree, nil
+}
+
+func (t *TapTree) depth() int {
+	if t.Leaf != nil {
+		return 0
+	}
+	return 1 + max(t.Left.depth(), t.Right.depth())
+}
+
+// Leaves returns the leaves from left to right, the index of a leaf is the one to spend
+func (t *TapTree) Leaves() []txscript.TapLeaf {
+	proofs := t.leafProofs()
+	leaves := make([]txscript.TapLeaf, 0, len(proofs))
+	for _, proof := range proofs {
+		leaves = append(leaves, proof.leaf)
+	}
+	return leaves
+}
+
+// tapNode returns the txscript node of the tree
+func (t *TapTree) tapNode() txscript.TapNode {
+	if t.Leaf != nil {
+		return *t.Leaf
+	}
+	return txscript.NewTapBranch(t.Left.tapNode(), t.Right.tapNode())
+}
+
+// RootHash is the merkle root of the tree that tweaks the internal key
+func (t *TapTree) RootHash() chainhash.Hash {
+	return t.tapNode().TapHash()
+}
+
+// OutputKey is the internal key tweaked by the merkle root
+func (t *TapTree) OutputKey(internalKey *btcec.PublicKey) *btcec.PublicKey {
+	rootHash := t.RootHash()
+	return txscript.ComputeTaprootOutputKey(internalKey, rootHash[:])
+}
+
+// tapLeafProof is a leaf with the hashes from its sibling up to the root
+type tapLeafProof struct {
+	leaf  txscript.TapLeaf
+	proof []byte
+}
+
+func (t *TapTree) leafProofs() []*tapLeafProof {
+	if t.Leaf != nil {
+		return []*tapLeafProof{{leaf: *t.Leaf}}
+	}
+
+	leftLeaves, rightLeaves := t.Left.leafProofs(), t.Right.leafProofs()
+	leftHash, rightHash := t.Left.tapNode().TapHash(), t.Right.tapNode().TapHash()
+	for _, leaf := range leftLeaves {
+		leaf.proof = append(leaf.proof, rightHash[:]...)
+	}
+	for _, leaf := range rightLeaves {
+		leaf.proof = append(leaf.proof, leftHash[:]...)
+	}
+	return append(leftLeaves, rightLeaves...)
+}
+
+// ControlBlock returns the control block to spend the leaf at the index
+func (t *TapTree) ControlBlock(internalKey *btcec.PublicKey, leaf int) (*txscript.ControlBlock, error) {
+	proofs := t.leafProofs()
+	if leaf < 0 || leaf >= len(proofs) {
+		return nil, fmt.Errorf("%w: no leaf %d of %d", ErrScriptBuild, leaf, len(proofs))
+	}
+	outputKey := t.OutputKey(internalKey)
+	return &txscript.ControlBlock{
+		InternalKey:     internalKey,
+		OutputKeyYIsOdd: outputKey.Y().Bit(0) == 1,
+		LeafVersion:     proofs[leaf].leaf.LeafVersion,
+		InclusionProof:  proofs[leaf].proof,
+	}, nil
+}
+
+// spend returns the utxo template of the key path if leaf is negative, otherwise of the script path of the leaf
+func (t *TapTree) spend(internalKey *btcec.PublicKey, leaf int) (*UTXO, error) {
+	pkScript, err := txscript.PayToTaprootScript(t.OutputKey(internalKey))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+
+	if leaf < 0 {
+		rootHash := t.RootHash()
+		return &UTXO{
+			PkScript:       pkScript,
+			SpendType:      SpendP2TRKeyPath,
+			TapInternalKey: internalKey,
+			TapMerkleRoot:  rootHash[:],
+		}, nil
+	}
+
+	controlBlock, err := t.ControlBlock(internalKey, leaf)
+	if err != nil {
+		return nil, err
+	}
+	controlBlockWitness, err := controlBlock.ToBytes()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return &UTXO{
+		PkScript:     pkScript,
+		SpendType:    SpendP2TRScriptPath,
+		Script:       t.Leaves()[leaf].Script,
+		ControlBlock: controlBlockWitness,
+	}, nil
+}
+
+// tapTreeJSON is a leaf `{"script": "<hex>", "leaf_version": 192}` or a branch `[left, right]`,
+// a leaf without the version is a tapscript of bip342
+type tapTreeJSON struct {
+	Script      string `json:"script"`
+	LeafVersion uint8  `json:"leaf_version"`
+}
+
+// MarshalJSON exports the tree for the spender to rebuild it
+func (t *TapTree) MarshalJSON() ([]byte, error) {
+	if t.Leaf != nil {
+		return json.Marshal(tapTreeJSON{
+			Script:      hex.EncodeToString(t.Leaf.Script),
+			LeafVersion: uint8(t.Leaf.LeafVersion),
+		})
+	}
+	return json.Marshal([2]*TapTree{t.Left, t.Right})
+}
+
+// UnmarshalJSON imports the tree exported by MarshalJSON
+func (t *TapTree) UnmarshalJSON(data []byte) error {
+	data = bytes.TrimSpace(data)
+	if len(data) > 0 && data[0] == '[' {
+		var branch []*TapTree
+		if err := json.Unmarshal(data, &branch); err != nil {
+			return err
+		}
+		if len(branch) != 2 || branch[0] == nil || branch[1] == nil {
+			return fmt.Errorf("%w: a branch has two nodes", ErrScriptBuild)
+		}
+		*t = TapTree{Left: branch[0], Right: branch[1]}
+		return nil
+	}
+
+	leaf := tapTreeJSON{LeafVersion: uint8(txscript.BaseLeafVersion)}
+	if err := json.Unmarshal(data, &leaf); err != nil {
+		return err
+	}
+	script, err := hex.DecodeString(leaf.Script)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	// the leaf version is even, the lowest bit of the control block byte is the parity of the output key
+	if leaf.LeafVersion&1 != 0 {
+		return fmt.Errorf("%w: odd leaf version %#x", ErrScriptBuild, leaf.LeafVersion)
+	}
+	// a witness item starting with 0x50 is the annex, a control block can't start with it
+	if leaf.LeafVersion == txscript.TaprootAnnexTag {
+		return fmt.Errorf("%w: leaf version %#x is the annex tag", ErrScriptBuild, leaf.LeafVersion)
+	}
+	tapLeaf := txscript.NewTapLeaf(txscript.TapscriptLeafVersion(leaf.LeafVersion), script)
+	*t = TapTree{Leaf: &tapLeaf}
+	return nil
+}
+
+// PayToTaprootTreeTx spends the taproot output of the internal key and the tree by the leaf at the index,
+// or by the key path if leaf is negative, then the signer is the internal key or the cosigners of
+// the MuSig2InternalKey. The leaves of the script path are `<pubkey> OP_CHECKSIG` and multi_a of the signers.
+func PayToTaprootTreeTx(netwk *chaincfg.Params, internalKey *btcec.PublicKey, tree *TapTree, leaf int,
+	signers []*btcec.PrivateKey, pool []*UTXO, amount, feeRate int64) (*wire.MsgTx, error) {
+	builder, err := newPayToTaprootTreeBuilder(netwk, internalKey, tree, leaf, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	for _, utxo := range builder.Pool {
+		if utxo.SpendType == SpendP2TRKeyPath && len(signers) > 1 {
+			utxo.SpendType = SpendMuSig2
+		}
+	}
+	withKeys(builder.Pool, signers...)
+	return builder.Build()
+}
+
+// PayToTaprootTreePsbt creates the psbt of PayToTaprootTreeTx
+func PayToTaprootTreePsbt(netwk *chaincfg.Params, internalKey *btcec.PublicKey, tree *TapTree, leaf int,
+	pool []*UTXO, amount, feeRate int64) (*psbt.Packet, error) {
+	builder, err := newPayToTaprootTreeBuilder(netwk, internalKey, tree, leaf, pool, amount, feeRate)
+	if err != nil {
+		return nil, err
+	}
+	return builder.BuildPsbt()
+}
+
+func newPayToTaprootTreeBuilder(netwk *chaincfg.Params, internalKey *btcec.PublicKey, tree *TapTree, leaf int,
+	pool []*UTXO, amount, feeRate int64) (*TxBuilder, error) {
+	spend, err := tree.spend(internalKey, leaf)
+	if err != nil {
+		return nil, err
+	}
+
+	address, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(tree.OutputKey(internalKey)), netwk)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+	fmt.Println("P2TR Address:", address)
+
+	spend.Sequence = wire.MaxTxInSequenceNum - 5 // let it be replaceable
+	return &TxBuilder{
+		Pool:          spendFrom(pool, *spend),
+		Recipients:    []*Recipient{{Address: address, Amount: amount}},
+		ChangeAddress: address,
+		FeeRate:       feeRate,
+	}, nil
+}
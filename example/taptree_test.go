@@ -0,0 +1,124 @@
+package example
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/txscript"
+)
+
+func testTapLeaves(t *testing.T, keys ...*btcec.PrivateKey) []txscript.TapLeaf {
+	t.Helper()
+	leaves := make([]txscript.TapLeaf, 0, len(keys))
+	for _, key := range keys {
+		script, err := txscript.NewScriptBuilder().
+			AddData(schnorr.SerializePubKey(key.PubKey())).AddOp(txscript.OP_CHECKSIG).Script()
+		if err != nil {
+			t.Fatal(err)
+		}
+		leaves = append(leaves, txscript.NewBaseTapLeaf(script))
+	}
+	return leaves
+}
+
+func TestTapTreeJSON(t *testing.T) {
+	keys := []*btcec.PrivateKey{testKey(1), testKey(2), testKey(3), testKey(4)}
+	leaves := testTapLeaves(t, keys...)
+	tree, err := NewHuffmanTapTree(leaves, []int{1, 1, 2, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := json.Marshal(tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var back TapTree
+	if err := json.Unmarshal(data, &back); err != nil {
+		t.Fatal(err)
+	}
+	if back.RootHash() != tree.RootHash() {
+		t.Fatalf("root of %s differs", data)
+	}
+
+	// the heaviest leaf is spent from the imported tree
+	internalKey := testKey(5)
+	for idx, leaf := range back.Leaves() {
+		if string(leaf.Script) != string(leaves[3].Script) {
+			continue
+		}
+		spend, err := back.spend(internalKey.PubKey(), idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tx, err := PayToTaprootTreeTx(testNet, internalKey.PubKey(), &back, idx,
+			[]*btcec.PrivateKey{keys[3]}, testPool(60000), 30000, 3)
+		if err != nil {
+			t.Fatal(err)
+		}
+		testVerify(t, tx, spendFrom(testPool(60000), *spend))
+	}
+}
+
+func TestTapTreeJSONLeafVersion(t *testing.T) {
+	var tree TapTree
+	if err := json.Unmarshal([]byte(`{"script":"51"}`), &tree); err != nil {
+		t.Fatal(err)
+	}
+	if tree.Leaf.LeafVersion != txscript.BaseLeafVersion {
+		t.Errorf("missing leaf version decoded as %#x", tree.Leaf.LeafVersion)
+	}
+
+	for _, bad := range []string{
+		`{"script":"51","leaf_version":193}`,
+		`{"script":"51","leaf_version":80}`,
+		`{"script":"zz"}`,
+		`[{"script":"51"}]`,
+	} {
+		if err := json.Unmarshal([]byte(bad), &tree); !errors.Is(err, ErrScriptBuild) {
+			t.Errorf("%s: got %v, want ErrScriptBuild", bad, err)
+		}
+	}
+}
+
+func TestHuffmanTapTree(t *testing.T) {
+	leaves := testTapLeaves(t, testKey(1), testKey(2), testKey(3), testKey(4))
+	tree, err := NewHuffmanTapTree(leaves, []int{1, 1, 2, 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the heavier leaf has the shorter proof
+	internalKey := testKey(5).PubKey()
+	depths := make(map[string]int)
+	for idx, leaf := range tree.Leaves() {
+		controlBlock, err := tree.ControlBlock(internalKey, idx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		depths[string(leaf.Script)] = len(controlBlock.InclusionProof) / 32
+	}
+	for idx, want := range []int{3, 3, 2, 1} {
+		if got := depths[string(leaves[idx].Script)]; got != want {
+			t.Errorf("leaf %d at depth %d, want %d", idx, got, want)
+		}
+	}
+
+	// the balanced tree of 4 leaves is the one of txscript
+	balanced, err := NewTapTree(leaves...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balanced.RootHash() != txscript.AssembleTaprootScriptTree(leaves...).RootNode.TapHash() {
+		t.Error("another root of the balanced tree")
+	}
+
+	if _, err := NewHuffmanTapTree(leaves, []int{1, 1, 0, 4}); !errors.Is(err, ErrScriptBuild) {
+		t.Errorf("zero weight: got %v, want ErrScriptBuild", err)
+	}
+	if _, err := NewHuffmanTapTree(leaves, []int{1}); !errors.Is(err, ErrScriptBuild) {
+		t.Errorf("missing weights: got %v, want ErrScriptBuild", err)
+	}
+}
@@ -0,0 +1,57 @@
+package example
+
+import (
+	"bytes"
+	"encoding/hex"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+var testNet = &chaincfg.RegressionNetParams
+
+// testKey is a fixed private key, the signatures of ecdsa by rfc6979 are deterministic
+func testKey(i byte) *btcec.PrivateKey {
+	prvkey, _ := btcec.PrivKeyFromBytes(bytes.Repeat([]byte{i}, 32))
+	return prvkey
+}
+
+// testPool is the outputs of a fake funding transaction, the builders fill in the scripts
+func testPool(amounts ...int64) []*UTXO {
+	hash := chainhash.DoubleHashH([]byte("funding"))
+	pool := make([]*UTXO, 0, len(amounts))
+	for idx, amount := range amounts {
+		pool = append(pool, &UTXO{OutPoint: wire.OutPoint{Hash: hash, Index: uint32(idx)}, Amount: amount})
+	}
+	return pool
+}
+
+// testVerify runs the script engine on every input of the tx
+func testVerify(t *testing.T, tx *wire.MsgTx, utxos []*UTXO) {
+	t.Helper()
+	fetcher := prevOutFetcher(utxos)
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for idx, utxo := range utxos {
+		engine, err := txscript.NewEngine(utxo.PkScript, tx, idx, txscript.StandardVerifyFlags,
+			nil, sigHashes, utxo.Amount, fetcher)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := engine.Execute(); err != nil {
+			t.Fatalf("input %d: %v", idx, err)
+		}
+	}
+}
+
+func txHex(t *testing.T, tx *wire.MsgTx) string {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := tx.Serialize(&buf); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(buf.Bytes())
+}
@@ -0,0 +1,275 @@
+package example
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/psbt"
+	"github.com/btcsuite/btcd/mempool"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Recipient is an output of the transaction
+type Recipient struct {
+	Address btcutil.Address
+	Amount  int64
+}
+
+// spendFrom copies the utxos of the pool with the script and the keys of the template,
+// it's for the builders spending the utxos of a single address
+func spendFrom(pool []*UTXO, template UTXO) []*UTXO {
+	utxos := make([]*UTXO, 0, len(pool))
+	for _, utxo := range pool {
+		spend := template
+		spend.OutPoint = utxo.OutPoint
+		spend.Amount = utxo.Amount
+		spend.PrevTx = utxo.PrevTx
+		utxos = append(utxos, &spend)
+	}
+	return utxos
+}
+
+// withKeys sets the signing keys of the utxos
+func withKeys(utxos []*UTXO, keys ...*btcec.PrivateKey) {
+	for _, utxo := range utxos {
+		utxo.Keys = keys
+	}
+}
+
+// TxBuilder builds and signs a transaction spending many utxos to many recipients
+type TxBuilder struct {
+	// Version of the transaction, zero means 2
+	Version  int32
+	LockTime uint32
+
+	// Inputs are always spent
+	Inputs []*UTXO
+	// Sequences override the sequences of the Inputs in order, a zero sequence is kept instead of being final
+	Sequences []uint32
+
+	// Outputs are added before the recipients as they are without the dust check,
+	// like the OP_RETURN and the bare multisig outputs of a transaction being replaced
+	Outputs    []*wire.TxOut
+	Recipients []*Recipient
+
+	// Pool is the candidates of the coin selection, the selected utxos are spent after the Inputs
+	Pool []*UTXO
+	// CoinSelector picks the utxos from the Pool, SelectCoins if nil
+	CoinSelector CoinSelector
+	// LongTermFeeRate in sat/vB is used to compute the waste of the coin selection
+	LongTermFeeRate int64
+
+	// ChangeAddress receives the rest of the inputs, the change is dropped to the fee if it would be dust.
+	// Without a change address the rest must be dust, like the excess of a changeless coin selection.
+	ChangeAddress btcutil.Address
+	// ChangeToFee pays all the rest as fee when there is no change address, it burns the change on purpose
+	ChangeToFee bool
+
+	// FeeRate in sat/vB
+	FeeRate int64
+	// ExtraFee in satoshis is paid on top of the fee rate, like the fee a CPFP child pays for its parent
+	ExtraFee int64
+}
+
+// Build creates the transaction, signs every input according to its spend type and verifies the scripts
+func (b *TxBuilder) Build() (*wire.MsgTx, error) {
+	newtx, inputs, err := b.buildUnsigned()
+	if err != nil {
+		return nil, err
+	}
+
+	// sign
+	fetcher := prevOutFetcher(inputs)
+	sigHashes := txscript.NewTxSigHashes(newtx, fetcher)
+	for txIdx, utxo := range inputs {
+		if err := signInput(newtx, fetcher, sigHashes, txIdx, utxo); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := VerifyTx(newtx, fetcher); err != nil {
+		return nil, err
+	}
+	return newtx, nil
+}
+
+// BuildPsbt creates the transaction as a psbt for the signers, the utxos don't need the Keys
+func (b *TxBuilder) BuildPsbt() (*psbt.Packet, error) {
+	newtx, inputs, err := b.buildUnsigned()
+	if err != nil {
+		return nil, err
+	}
+	return NewPsbt(newtx, inputs)
+}
+
+// buildUnsigned selects the coins and creates the transaction without signatures,
+// it returns the utxos in the order of the inputs
+func (b *TxBuilder) buildUnsigned() (*wire.MsgTx, []*UTXO, error) {
+	if b.FeeRate < 0 {
+		return nil, nil, fmt.Errorf("%w: negative fee rate %d", ErrFeeExceedsInput, b.FeeRate)
+	}
+	if b.ExtraFee < 0 {
+		return nil, nil, fmt.Errorf("%w: negative extra fee %d", ErrFeeExceedsInput, b.ExtraFee)
+	}
+
+	if len(b.Sequences) > len(b.Inputs) {
+		return nil, nil, fmt.Errorf("%d sequences of %d inputs", len(b.Sequences), len(b.Inputs))
+	}
+
+	// txout to the recipients
+	var outputAmount int64
+	txouts := make([]*wire.TxOut, 0, len(b.Outputs)+len(b.Recipients)+1)
+	for _, output := range b.Outputs {
+		txouts = append(txouts, wire.NewTxOut(output.Value, output.PkScript))
+		outputAmount += output.Value
+	}
+	for _, recipient := range b.Recipients {
+		output, err := txscript.PayToAddrScript(recipient.Address)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		txout, err := newTxOut(recipient.Amount, output)
+		if err != nil {
+			return nil, nil, err
+		}
+		txouts = append(txouts, txout)
+		outputAmount += recipient.Amount
+	}
+
+	var changeScript []byte
+	if b.ChangeAddress != nil {
+		var err error
+		changeScript, err = txscript.PayToAddrScript(b.ChangeAddress)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+	}
+
+	inputs := b.Inputs
+	changeless := false
+	if len(b.Pool) > 0 {
+		selection, err := b.selectCoins(txouts, changeScript)
+		if err != nil {
+			return nil, nil, err
+		}
+		if selection != nil {
+			inputs = append(slices.Clone(inputs), selection.Inputs...)
+			changeless = selection.Change == 0
+		}
+	}
+	if len(inputs) == 0 {
+		return nil, nil, errors.New("no inputs")
+	}
+
+	version := b.Version
+	if version == 0 {
+		version = 2
+	}
+	newtx := wire.NewMsgTx(version)
+	newtx.LockTime = b.LockTime
+
+	// txin
+	var inputAmount int64
+	for idx, utxo := range inputs {
+		txin := wire.NewTxIn(&utxo.OutPoint, nil, nil)
+		txin.Sequence = utxo.sequence()
+		if idx < len(b.Sequences) {
+			txin.Sequence = b.Sequences[idx]
+		}
+		newtx.AddTxIn(txin)
+		inputAmount += utxo.Amount
+	}
+
+	estimator := new(TxWeightEstimator)
+	for _, utxo := range inputs {
+		if err := estimator.AddInput(utxo); err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, txout := range txouts {
+		newtx.AddTxOut(txout)
+		estimator.AddOutput(txout.PkScript)
+	}
+
+	fee := estimator.Fee(b.FeeRate) + b.ExtraFee
+	if inputAmount-outputAmount < fee {
+		return nil, nil, fmt.Errorf("%w: fee %d, input %d, output %d", ErrFeeExceedsInput, fee, inputAmount, outputAmount)
+	}
+
+	// txout for the change, it pays the fee of itself
+	switch rest := inputAmount - outputAmount - fee; {
+	case changeScript != nil && !changeless:
+		change := inputAmount - outputAmount - estimator.AddOutput(changeScript).Fee(b.FeeRate) - b.ExtraFee
+		txout := wire.NewTxOut(change, changeScript)
+		if change > 0 && !mempool.IsDust(txout, mempool.DefaultMinRelayTxFee) {
+			newtx.AddTxOut(txout)
+		}
+	case changeScript == nil && !b.ChangeToFee && rest > maxChangelessExcess():
+		return nil, nil, fmt.Errorf("no change address for %d satoshis", rest)
+	}
+	// a transaction without outputs is invalid, all the inputs would go to the fee
+	if len(newtx.TxOut) == 0 {
+		return nil, nil, fmt.Errorf("%w: no output, the change is dust or there is no change address", ErrDustOutput)
+	}
+
+	return newtx, inputs, nil
+}
+
+// selectCoins funds the recipients and the fee of the transaction without the pool,
+// it returns nil if the Inputs are enough
+func (b *TxBuilder) selectCoins(txouts []*wire.TxOut, changeScript []byte) (*CoinSelection, error) {
+	estimator := new(TxWeightEstimator)
+	var target int64
+	for _, utxo := range b.Inputs {
+		if err := estimator.AddInput(utxo); err != nil {
+			return nil, err
+		}
+		target -= utxo.Amount
+	}
+	for _, txout := range txouts {
+		estimator.AddOutput(txout.PkScript)
+		target += txout.Value
+	}
+	// count the segwit marker and flag in case any selected input has witness
+	estimator.hasWitness = true
+	target += estimator.Fee(b.FeeRate) + b.ExtraFee
+
+	if len(b.Inputs) > 0 && target <= 0 {
+		return nil, nil
+	}
+
+	params := &CoinSelectParams{
+		Target:          target,
+		FeeRate:         b.FeeRate,
+		LongTermFeeRate: b.LongTermFeeRate,
+	}
+	if changeScript != nil {
+		changeOutput := wire.NewTxOut(0, changeScript)
+		params.ChangeFee = feeForWeight(outputWeight(changeScript), b.FeeRate)
+		params.CostOfChange = params.ChangeFee + feeForWeight(spendWeight(changeScript), params.longTermFeeRate())
+		params.MinChange = mempool.GetDustThreshold(changeOutput)
+	} else {
+		// no change output, the excess is dropped to the fee
+		params.MinChange = math.MaxInt64 / 2
+		if !b.ChangeToFee {
+			params.CostOfChange = maxChangelessExcess()
+		}
+	}
+
+	selector := b.CoinSelector
+	if selector == nil {
+		selector = SelectCoins
+	}
+	return selector(b.Pool, params)
+}
+
+// maxChangelessExcess is the most a transaction without a change address leaves to the fee,
+// the dust threshold of an output of the shortest script
+func maxChangelessExcess() int64 {
+	return mempool.GetDustThreshold(wire.NewTxOut(0, nil)) - 1
+}
@@ -0,0 +1,221 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// testUTXOs are the outputs of a fake funding transaction to the p2pkh, p2wpkh and p2tr addresses of the key
+func testUTXOs(t *testing.T, amounts ...int64) []*UTXO {
+	t.Helper()
+	prvkey := testKey(1)
+	pubkeyHash := btcutil.Hash160(prvkey.PubKey().SerializeCompressed())
+	p2pkh, err := btcutil.NewAddressPubKeyHash(pubkeyHash, testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2wpkh, err := btcutil.NewAddressWitnessPubKeyHash(pubkeyHash, testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2tr, err := btcutil.NewAddressTaproot(schnorr.SerializePubKey(txscript.ComputeTaprootKeyNoScript(prvkey.PubKey())), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	spends := []struct {
+		address   btcutil.Address
+		spendType SpendType
+	}{{p2pkh, SpendP2PKH}, {p2wpkh, SpendP2WPKH}, {p2tr, SpendP2TRKeyPath}}
+	hash := chainhash.DoubleHashH([]byte("funding"))
+	utxos := make([]*UTXO, 0, len(amounts))
+	for idx, amount := range amounts {
+		spend := spends[idx%len(spends)]
+		pkScript, err := txscript.PayToAddrScript(spend.address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		utxos = append(utxos, &UTXO{
+			OutPoint:  wire.OutPoint{Hash: hash, Index: uint32(idx)},
+			Amount:    amount,
+			PkScript:  pkScript,
+			SpendType: spend.spendType,
+			Keys:      []*btcec.PrivateKey{prvkey},
+		})
+	}
+	return utxos
+}
+
+func testAddress(t *testing.T, i byte) btcutil.Address {
+	t.Helper()
+	address, err := btcutil.NewAddressWitnessPubKeyHash(btcutil.Hash160(testKey(i).PubKey().SerializeCompressed()), testNet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return address
+}
+
+// testP2WPKHBuilder pays the amount back to the p2wpkh address of the key, the inputs are signed by it
+func testP2WPKHBuilder(t *testing.T, pool []*UTXO, amount, feeRate int64) *TxBuilder {
+	t.Helper()
+	prvkey := testKey(1)
+	builder, err := newPay2WitnessPubkeyHashBuilder(testNet, prvkey.PubKey(), pool, amount, feeRate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	withKeys(builder.Pool, prvkey)
+	return builder
+}
+
+func TestTxBuilder(t *testing.T) {
+	utxos := testUTXOs(t, 30000, 40000, 50000)
+	builder := &TxBuilder{
+		Inputs: utxos,
+		Recipients: []*Recipient{
+			{Address: testAddress(t, 2), Amount: 60000},
+			{Address: testAddress(t, 3), Amount: 50000},
+		},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxIn) != 3 || len(tx.TxOut) != 3 || tx.TxOut[2].Value < 9000 {
+		t.Fatalf("outputs %v", tx.TxOut)
+	}
+	// every input is signed by its spend type
+	testVerify(t, tx, utxos)
+}
+
+func TestTxBuilderDustChange(t *testing.T) {
+	builder := &TxBuilder{
+		Inputs:        testUTXOs(t, 30000),
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 29750}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       1,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the change of less than 100 satoshis is dust, it goes to the fee
+	if len(tx.TxOut) != 1 {
+		t.Fatalf("outputs %v", tx.TxOut)
+	}
+}
+
+func TestTxBuilderFeeExceedsInput(t *testing.T) {
+	builder := &TxBuilder{
+		Inputs:     testUTXOs(t, 30000),
+		Recipients: []*Recipient{{Address: testAddress(t, 2), Amount: 29900}},
+		FeeRate:    1,
+	}
+	if _, err := builder.Build(); !errors.Is(err, ErrFeeExceedsInput) {
+		t.Errorf("got %v, want ErrFeeExceedsInput", err)
+	}
+}
+
+func TestTxBuilderPool(t *testing.T) {
+	pool := testUTXOs(t, 10000, 20000, 50000)
+	builder := &TxBuilder{
+		Pool:          pool,
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 25000}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the selected utxos are spent
+	utxos := make([]*UTXO, 0, len(tx.TxIn))
+	for _, txin := range tx.TxIn {
+		for _, utxo := range pool {
+			if utxo.OutPoint == txin.PreviousOutPoint {
+				utxos = append(utxos, utxo)
+			}
+		}
+	}
+	if len(utxos) != len(tx.TxIn) || len(utxos) == len(pool) {
+		t.Fatalf("inputs %v", tx.TxIn)
+	}
+	testVerify(t, tx, utxos)
+
+	builder.Recipients[0].Amount = 80000
+	if _, err := builder.Build(); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestTxBuilderChange(t *testing.T) {
+	builder := testP2WPKHBuilder(t, testPool(60000), 30000, 3)
+	builder.Inputs, builder.Pool = builder.Pool, nil
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxOut) != 2 || tx.TxOut[0].Value != 30000 {
+		t.Fatalf("outputs %v", tx.TxOut)
+	}
+	if fee := txFee(tx, builder.Inputs); fee <= 0 || fee > 1000 {
+		t.Errorf("fee %d", fee)
+	}
+}
+
+func TestTxBuilderNoChangeAddress(t *testing.T) {
+	builder := testP2WPKHBuilder(t, testPool(60000), 30000, 3)
+	builder.Inputs, builder.Pool = builder.Pool, nil
+	builder.ChangeAddress = nil
+	if _, err := builder.Build(); err == nil {
+		t.Fatal("the change is burnt without a change address")
+	}
+
+	// burning the change is an explicit choice
+	builder.ChangeToFee = true
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(tx.TxOut) != 1 || txFee(tx, builder.Inputs) != 30000 {
+		t.Errorf("outputs %v", tx.TxOut)
+	}
+
+	// a dust excess is left to the fee like a changeless selection
+	builder = testP2WPKHBuilder(t, testPool(60000), 59300, 3)
+	builder.Inputs, builder.Pool = builder.Pool, nil
+	builder.ChangeAddress = nil
+	tx, err = builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fee := txFee(tx, builder.Inputs); fee != 700 {
+		t.Errorf("fee %d", fee)
+	}
+}
+
+func TestTxBuilderInsufficientFunds(t *testing.T) {
+	builder := testP2WPKHBuilder(t, testPool(1000), 70000, 3)
+	if _, err := builder.Build(); !errors.Is(err, ErrInsufficientFunds) {
+		t.Errorf("got %v, want ErrInsufficientFunds", err)
+	}
+}
+
+func TestTxBuilderNoOutput(t *testing.T) {
+	// the change of the only output is dust
+	builder := testP2WPKHBuilder(t, testPool(1000), 0, 1)
+	builder.Inputs, builder.Pool, builder.Recipients = builder.Pool, nil, nil
+	builder.ExtraFee = 800
+	if _, err := builder.Build(); !errors.Is(err, ErrDustOutput) {
+		t.Errorf("got %v, want ErrDustOutput", err)
+	}
+}
@@ -0,0 +1,42 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// VerifyTx runs every input through the script engine with the standard verification flags,
+// so a bad scriptSig or witness fails here with the input and the reason instead of being
+// rejected by the node. The fetcher has the outputs spent by all the inputs.
+func VerifyTx(tx *wire.MsgTx, fetcher txscript.PrevOutputFetcher) error {
+	// the sighashes of taproot need all the spent outputs
+	for idx, txin := range tx.TxIn {
+		if fetcher.FetchPrevOutput(txin.PreviousOutPoint) == nil {
+			return fmt.Errorf("%w: no output %s spent by input %d", ErrScriptVerify, txin.PreviousOutPoint, idx)
+		}
+	}
+
+	sigHashes := txscript.NewTxSigHashes(tx, fetcher)
+	for idx := range tx.TxIn {
+		if err := verifyInput(tx, fetcher, sigHashes, idx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func verifyInput(tx *wire.MsgTx, fetcher txscript.PrevOutputFetcher, sigHashes *txscript.TxSigHashes, idx int) error {
+	txin := tx.TxIn[idx]
+	prevOut := fetcher.FetchPrevOutput(txin.PreviousOutPoint)
+	vm, err := txscript.NewEngine(prevOut.PkScript, tx, idx, txscript.StandardVerifyFlags, nil,
+		sigHashes, prevOut.Value, fetcher)
+	if err != nil {
+		return fmt.Errorf("%w: input %d: %v", ErrScriptVerify, idx, err)
+	}
+	if err := vm.Execute(); err != nil {
+		return fmt.Errorf("%w: input %d spending %s: %v", ErrScriptVerify, idx, txin.PreviousOutPoint, err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package example
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+)
+
+func TestVerifyTx(t *testing.T) {
+	utxos := testUTXOs(t, 30000, 40000, 50000)
+	builder := &TxBuilder{
+		Inputs:        utxos,
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 60000}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	fetcher := prevOutFetcher(utxos)
+	if err := VerifyTx(tx, fetcher); err != nil {
+		t.Fatal(err)
+	}
+
+	// the output value is signed by every input
+	tampered := tx.Copy()
+	tampered.TxOut[0].Value++
+	if err := VerifyTx(tampered, fetcher); !errors.Is(err, ErrScriptVerify) {
+		t.Errorf("tampered output: got %v, want ErrScriptVerify", err)
+	}
+
+	// the sighashes of taproot need all the spent outputs
+	if err := VerifyTx(tx, prevOutFetcher(utxos[:2])); !errors.Is(err, ErrScriptVerify) {
+		t.Errorf("missing spent output: got %v, want ErrScriptVerify", err)
+	}
+}
+
+func TestBuildVerifyWrongKey(t *testing.T) {
+	// the p2wpkh utxo of key 1 signed by key 2
+	utxo := testUTXOs(t, 0, 30000)[1]
+	utxo.Keys = []*btcec.PrivateKey{testKey(2)}
+	builder := &TxBuilder{
+		Inputs:        []*UTXO{utxo},
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 20000}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	if _, err := builder.Build(); !errors.Is(err, ErrScriptVerify) {
+		t.Errorf("got %v, want ErrScriptVerify", err)
+	}
+}
@@ -0,0 +1,209 @@
+package example
+
+import (
+	"fmt"
+
+	"github.com/btcsuite/btcd/btcec/v2"
+	"github.com/btcsuite/btcd/btcec/v2/schnorr"
+	"github.com/btcsuite/btcd/btcutil"
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/txscript"
+	"github.com/btcsuite/btcd/wire"
+)
+
+// Purpose is the first level of the bip43 path, it decides the address type of the account
+type Purpose uint32
+
+const (
+	// PurposeBip44 is p2pkh, m/44'/coin'/account'
+	PurposeBip44 Purpose = 44
+	// PurposeBip49 is p2wpkh nested in p2sh, m/49'/coin'/account'
+	PurposeBip49 Purpose = 49
+	// PurposeBip84 is p2wpkh, m/84'/coin'/account'
+	PurposeBip84 Purpose = 84
+	// PurposeBip86 is p2tr of key path only, m/86'/coin'/account'
+	PurposeBip86 Purpose = 86
+
+	// DefaultGapLimit is the number of the consecutive unused addresses before the scan stops
+	DefaultGapLimit = 20
+)
+
+// SpendType returns how the addresses of the purpose are signed
+func (p Purpose) SpendType() (SpendType, error) {
+	switch p {
+	case PurposeBip44:
+		return SpendP2PKH, nil
+	case PurposeBip49:
+		return SpendP2SHP2WPKH, nil
+	case PurposeBip84:
+		return SpendP2WPKH, nil
+	case PurposeBip86:
+		return SpendP2TRKeyPath, nil
+	default:
+		return 0, fmt.Errorf("%w: unknown purpose %d", ErrInvalidDerivationPath, uint32(p))
+	}
+}
+
+// Account is a bip44 style account, the receive and the change addresses are
+// m/purpose'/coin'/account'/0/index and m/purpose'/coin'/account'/1/index
+type Account struct {
+	netwk       *chaincfg.Params
+	purpose     Purpose
+	path        []uint32
+	fingerprint uint32
+	key         *hdkeychain.ExtendedKey
+}
+
+// NewAccount derives the account from the master key, the coin type is the one of the network.
+// The index is hardened by the path, so it must be below hdkeychain.HardenedKeyStart.
+func NewAccount(master *hdkeychain.ExtendedKey, netwk *chaincfg.Params, purpose Purpose, index uint32) (*Account, error) {
+	if _, err := purpose.SpendType(); err != nil {
+		return nil, err
+	}
+	if index >= hdkeychain.HardenedKeyStart {
+		return nil, fmt.Errorf("%w: account index %d overflows the hardened index", ErrInvalidKey, index)
+	}
+	if !master.IsForNet(netwk) {
+		return nil, fmt.Errorf("%w: not a key of %s", ErrInvalidKey, netwk.Name)
+	}
+
+	fingerprint, err := Fingerprint(master)
+	if err != nil {
+		return nil, err
+	}
+	path := []uint32{
+		hdkeychain.HardenedKeyStart + uint32(purpose),
+		hdkeychain.HardenedKeyStart + netwk.HDCoinType,
+		hdkeychain.HardenedKeyStart + index,
+	}
+	key, err := DeriveKey(master, path)
+	if err != nil {
+		return nil, err
+	}
+	return &Account{netwk: netwk, purpose: purpose, path: path, fingerprint: fingerprint, key: key}, nil
+}
+
+// Path returns the derivation path of the account
+func (a *Account) Path() string {
+	return FormatDerivationPath(a.path)
+}
+
+// WalletAddress is an address of the account with its bip32 origin
+type WalletAddress struct {
+	Address   btcutil.Address
+	PkScript  []byte
+	SpendType SpendType
+	Change    bool
+	Index     uint32
+	Origin    *KeyOrigin
+
+	// the redeem script of bip49
+	script []byte
+	prvkey *btcec.PrivateKey
+}
+
+// DeriveAddress derives the receive or the change address at the index
+func (a *Account) DeriveAddress(change bool, index uint32) (*WalletAddress, error) {
+	var branch uint32
+	if change {
+		branch = 1
+	}
+	key, err := DeriveKey(a.key, []uint32{branch, index})
+	if err != nil {
+		return nil, err
+	}
+	pubkey, err := key.ECPubKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+	prvkey, err := key.ECPrivKey()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidKey, err)
+	}
+
+	spendType, err := a.purpose.SpendType()
+	if err != nil {
+		return nil, err
+	}
+	walletAddr := &WalletAddress{
+		SpendType: spendType,
+		Change:    change,
+		Index:     index,
+		Origin: &KeyOrigin{
+			PubKey:      pubkey,
+			Fingerprint: a.fingerprint,
+			Path:        append(append([]uint32(nil), a.path...), branch, index),
+		},
+		prvkey: prvkey,
+	}
+
+	pubkeyHash := btcutil.Hash160(pubkey.SerializeCompressed())
+	switch a.purpose {
+	case PurposeBip44:
+		walletAddr.Address, err = btcutil.NewAddressPubKeyHash(pubkeyHash, a.netwk)
+	case PurposeBip49:
+		walletAddr.script, err = txscript.NewScriptBuilder().AddOp(txscript.OP_0).AddData(pubkeyHash).Script()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+		}
+		walletAddr.Address, err = btcutil.NewAddressScriptHash(walletAddr.script, a.netwk)
+	case PurposeBip84:
+		walletAddr.Address, err = btcutil.NewAddressWitnessPubKeyHash(pubkeyHash, a.netwk)
+	case PurposeBip86:
+		tapKey := txscript.ComputeTaprootKeyNoScript(pubkey)
+		walletAddr.Address, err = btcutil.NewAddressTaproot(schnorr.SerializePubKey(tapKey), a.netwk)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidAddress, err)
+	}
+
+	walletAddr.PkScript, err = txscript.PayToAddrScript(walletAddr.Address)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrScriptBuild, err)
+	}
+	return walletAddr, nil
+}
+
+// Scan derives the addresses of the chain until gapLimit consecutive addresses are unused,
+// it returns the used addresses and the index of the next unused address
+func (a *Account) Scan(change bool, gapLimit int, used func(*WalletAddress) (bool, error)) ([]*WalletAddress, uint32, error) {
+	if gapLimit <= 0 {
+		gapLimit = DefaultGapLimit
+	}
+
+	var found []*WalletAddress
+	var next uint32
+	for index := uint32(0); index < next+uint32(gapLimit); index++ {
+		walletAddr, err := a.DeriveAddress(change, index)
+		if err != nil {
+			return nil, 0, err
+		}
+		ok, err := used(walletAddr)
+		if err != nil {
+			return nil, 0, err
+		}
+		if ok {
+			found = append(found, walletAddr)
+			next = index + 1
+		}
+	}
+	return found, next, nil
+}
+
+// UTXO returns the utxo of the address for the TxBuilder, it's signed by the derived key
+func (w *WalletAddress) UTXO(outpoint wire.OutPoint, amount int64) *UTXO {
+	utxo := &UTXO{
+		OutPoint:  outpoint,
+		Amount:    amount,
+		PkScript:  w.PkScript,
+		SpendType: w.SpendType,
+		Keys:      []*btcec.PrivateKey{w.prvkey},
+		Script:    w.script,
+		Origins:   []*KeyOrigin{w.Origin},
+	}
+	if w.SpendType == SpendP2TRKeyPath {
+		utxo.TapInternalKey = w.Origin.PubKey
+	}
+	return utxo
+}
@@ -0,0 +1,153 @@
+package example
+
+import (
+	"errors"
+	"math"
+	"testing"
+
+	"github.com/btcsuite/btcd/btcutil/hdkeychain"
+	"github.com/btcsuite/btcd/chaincfg"
+	"github.com/btcsuite/btcd/chaincfg/chainhash"
+	"github.com/btcsuite/btcd/wire"
+)
+
+const testMnemonic = "abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon abandon about"
+
+func testMasterKey(t *testing.T, netwk *chaincfg.Params) *hdkeychain.ExtendedKey {
+	t.Helper()
+	seed, err := MnemonicToSeed(testMnemonic, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	master, err := NewMasterKey(seed, netwk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return master
+}
+
+// the test vectors of bip44, bip49, bip84 and bip86 share the same mnemonic
+//
+// https://github.com/bitcoin/bips/blob/master/bip-0049.mediawiki#test-vectors
+// https://github.com/bitcoin/bips/blob/master/bip-0084.mediawiki#test-vectors
+// https://github.com/bitcoin/bips/blob/master/bip-0086.mediawiki#test-vectors
+func TestAccountVectors(t *testing.T) {
+	for _, v := range []struct {
+		netwk   *chaincfg.Params
+		purpose Purpose
+		path    string
+		change  bool
+		index   uint32
+		address string
+	}{
+		{&chaincfg.MainNetParams, PurposeBip44, "m/44'/0'/0'", false, 0, "1LqBGSKuX5yYUonjxT5qGfpUsXKYYWeabA"},
+		{&chaincfg.TestNet3Params, PurposeBip49, "m/49'/1'/0'", false, 0, "2Mww8dCYPUpKHofjgcXcBCEGmniw9CoaiD2"},
+		{&chaincfg.MainNetParams, PurposeBip84, "m/84'/0'/0'", false, 0, "bc1qcr8te4kr609gcawutmrza0j4xv80jy8z306fyu"},
+		{&chaincfg.MainNetParams, PurposeBip84, "m/84'/0'/0'", false, 1, "bc1qnjg0jd8228aq7egyzacy8cys3knf9xvrerkf9g"},
+		{&chaincfg.MainNetParams, PurposeBip84, "m/84'/0'/0'", true, 0, "bc1q8c6fshw2dlwun7ekn9qwf37cu2rn755upcp6el"},
+		{&chaincfg.MainNetParams, PurposeBip86, "m/86'/0'/0'", false, 0, "bc1p5cyxnuxmeuwuvkwfem96lqzszd02n6xdcjrs20cac6yqjjwudpxqkedrcr"},
+		{&chaincfg.MainNetParams, PurposeBip86, "m/86'/0'/0'", false, 1, "bc1p4qhjn9zdvkux4e44uhx8tc55attvtyu358kutcqkudyccelu0was9fqzwh"},
+		{&chaincfg.MainNetParams, PurposeBip86, "m/86'/0'/0'", true, 0, "bc1p3qkhfews2uk44qtvauqyr2ttdsw7svhkl9nkm9s9c3x4ax5h60wqwruhk7"},
+	} {
+		account, err := NewAccount(testMasterKey(t, v.netwk), v.netwk, v.purpose, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if account.Path() != v.path {
+			t.Errorf("path %s, want %s", account.Path(), v.path)
+		}
+		walletAddr, err := account.DeriveAddress(v.change, v.index)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if walletAddr.Address.String() != v.address {
+			t.Errorf("%s change %t index %d: got %s, want %s", v.path, v.change, v.index, walletAddr.Address, v.address)
+		}
+	}
+}
+
+func TestNewAccountInvalid(t *testing.T) {
+	master := testMasterKey(t, &chaincfg.MainNetParams)
+	if _, err := NewAccount(master, &chaincfg.MainNetParams, 45, 0); err == nil {
+		t.Error("unknown purpose")
+	}
+	if _, err := NewAccount(master, testNet, PurposeBip84, 0); err == nil {
+		t.Error("mainnet key on regtest")
+	}
+	// the hardened index would wrap around to the account 0
+	for _, index := range []uint32{hdkeychain.HardenedKeyStart, hdkeychain.HardenedKeyStart + 1, math.MaxUint32} {
+		if _, err := NewAccount(master, &chaincfg.MainNetParams, PurposeBip84, index); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("account index %d got %v", index, err)
+		}
+	}
+}
+
+func TestAccountScan(t *testing.T) {
+	account, err := NewAccount(testMasterKey(t, testNet), testNet, PurposeBip84, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		used     []uint32
+		gapLimit int
+		found    int
+		next     uint32
+	}{
+		{nil, 0, 0, 0},
+		// 25 is beyond the gap of 20 after 3
+		{[]uint32{0, 3, 25}, 0, 2, 4},
+		{[]uint32{0, 3, 22, 25}, 0, 4, 26},
+		{[]uint32{0, 3, 22, 25}, 5, 2, 4},
+	} {
+		var derived int
+		found, next, err := account.Scan(false, test.gapLimit, func(walletAddr *WalletAddress) (bool, error) {
+			derived++
+			for _, index := range test.used {
+				if walletAddr.Index == index {
+					return true, nil
+				}
+			}
+			return false, nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		gapLimit := test.gapLimit
+		if gapLimit == 0 {
+			gapLimit = DefaultGapLimit
+		}
+		if len(found) != test.found || next != test.next || derived != int(next)+gapLimit {
+			t.Errorf("used %v: found %d, next %d, derived %d", test.used, len(found), next, derived)
+		}
+	}
+}
+
+func TestAccountUTXO(t *testing.T) {
+	master := testMasterKey(t, testNet)
+	var utxos []*UTXO
+	for idx, purpose := range []Purpose{PurposeBip44, PurposeBip49, PurposeBip84, PurposeBip86} {
+		account, err := NewAccount(master, testNet, purpose, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		walletAddr, err := account.DeriveAddress(false, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		outpoint := wire.OutPoint{Hash: chainhash.DoubleHashH([]byte("funding")), Index: uint32(idx)}
+		utxos = append(utxos, walletAddr.UTXO(outpoint, 20000))
+	}
+
+	builder := &TxBuilder{
+		Inputs:        utxos,
+		Recipients:    []*Recipient{{Address: testAddress(t, 2), Amount: 70000}},
+		ChangeAddress: testAddress(t, 1),
+		FeeRate:       2,
+	}
+	tx, err := builder.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	testVerify(t, tx, utxos)
+}